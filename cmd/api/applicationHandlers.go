@@ -0,0 +1,456 @@
+// Filename: cmd/api/applicationHandlers.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// createApplicationHandler handles POST /v1/applications
+func (a *app) createApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	a.createApplication(w, r, 0)
+}
+
+// createApplication starts a draft application. A non-zero teacherID takes
+// the place of the teacher_id in the request body.
+func (a *app) createApplication(w http.ResponseWriter, r *http.Request, teacherID int) {
+	var input struct {
+		TeacherID     int    `json:"teacher_id"`
+		LicenseTypeID int    `json:"license_type_id"`
+		Remarks       string `json:"remarks,omitempty"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if teacherID > 0 {
+		input.TeacherID = teacherID
+	}
+
+	application := &data.Application{
+		TeacherID:     input.TeacherID,
+		LicenseTypeID: input.LicenseTypeID,
+		Status:        data.ApplicationStatusDraft,
+		Remarks:       input.Remarks,
+	}
+
+	v := validator.New()
+	if data.ValidateApplication(v, application); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	// Make sure the referenced teacher and license type exist so the client
+	// gets a validation error instead of a foreign key violation
+	_, err = a.modelsFor(r).Teachers.Get(application.TeacherID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("teacher_id", "teacher does not exist")
+		default:
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	licenseType, err := a.models.LicenseTypes.Get(application.LicenseTypeID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("license_type_id", "license type does not exist")
+		default:
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.modelsFor(r).Applications.Insert(application)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	application.LicenseClass = licenseType.LicenseClass
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/applications/%d", application.ID))
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"application": application}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getApplicationHandler handles GET /v1/applications/:id
+func (a *app) getApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"application": application}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listApplicationsHandler handles GET /v1/applications
+func (a *app) listApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TeacherID int
+		Status    string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.TeacherID = a.getSingleIntegerParameter(qs, "teacher_id", 0, v)
+	input.Status = a.getSingleQueryParameter(qs, "status", "")
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.ApplicationStatuses...), "status", "invalid application status")
+	}
+
+	input.Filters.Page = a.getSingleIntegerParameter(qs, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(qs, "page_size", 20, v)
+	input.Filters.Sort = a.getSingleQueryParameter(qs, "sort", "application_id")
+	input.Filters.SortSafelist = data.ApplicationSortSafelist
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	applications, metadata, err := a.modelsFor(r).Applications.GetAll(input.TeacherID, input.Status, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"applications": applications, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateApplicationHandler handles PATCH /v1/applications/:id
+func (a *app) updateApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	// Only drafts can be edited; everything after that goes through the
+	// approval workflow
+	if application.Status != data.ApplicationStatusDraft {
+		a.invalidTransitionResponse(w, r, errors.New("the application can only be edited while it is a draft"))
+		return
+	}
+
+	var input struct {
+		LicenseTypeID *int    `json:"license_type_id"`
+		Remarks       *string `json:"remarks"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.LicenseTypeID != nil {
+		licenseType, err := a.models.LicenseTypes.Get(*input.LicenseTypeID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("license_type_id", "license type does not exist")
+			default:
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		} else {
+			application.LicenseTypeID = licenseType.ID
+			application.LicenseClass = licenseType.LicenseClass
+		}
+	}
+	if input.Remarks != nil {
+		application.Remarks = *input.Remarks
+	}
+
+	if data.ValidateApplication(v, application); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.modelsFor(r).Applications.Update(application)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"application": application}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// createApplicationTransitionHandler handles POST /v1/applications/:id/transitions
+func (a *app) createApplicationTransitionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Action  string `json:"action"`
+		Comment string `json:"comment,omitempty"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Action != "", "action", "must be provided")
+	v.Check(validator.PermittedValue(input.Action, data.ApplicationActions...), "action", "invalid application action")
+	v.Check(len(input.Comment) <= 1000, "comment", "must not be more than 1000 characters long")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	// Teachers may only move their own applications
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	// An application cannot be submitted until every required document has
+	// been uploaded
+	if input.Action == data.ApplicationActionSubmit {
+		checklist, err := a.applicationChecklist(application)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if !checklist.Complete {
+			v.AddError("documents", "required documents are missing or were rejected: "+strings.Join(checklist.Missing(), ", "))
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	transition, err := a.modelsFor(r).Applications.Transition(application, input.Action, int(user.ID), user.RoleName, a.contextGetPermissions(r), input.Comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			a.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrTransitionNotPermitted):
+			a.notPermittedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"application": application, "transition": transition}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getApplicationTransitionsHandler handles GET /v1/applications/:id/transitions
+func (a *app) getApplicationTransitionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	transitions, err := a.modelsFor(r).Applications.GetTransitions(application.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := envelope{
+		"transitions":       transitions,
+		"available_actions": data.AvailableApplicationActions(application.State(), a.contextGetPermissions(r)),
+	}
+
+	err = a.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getApplicationChecklistHandler handles GET /v1/applications/:id/checklist
+func (a *app) getApplicationChecklistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, application.TeacherID) {
+		return
+	}
+
+	checklist, err := a.applicationChecklist(application)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"checklist": checklist}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// applicationChecklist builds the required documents checklist for the
+// application's license type
+func (a *app) applicationChecklist(application *data.Application) (*data.Checklist, error) {
+	required, err := a.models.DocumentTypes.GetRequiredFor(application.LicenseTypeID)
+	if err != nil {
+		return nil, err
+	}
+	return a.models.Documents.GetChecklist(application, required)
+}
+
+// deleteApplicationHandler handles DELETE /v1/applications/:id
+func (a *app) deleteApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.modelsFor(r).Applications.Delete(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "application successfully deleted"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAllLicenseTypesHandler handles GET /v1/license-types
+func (a *app) getAllLicenseTypesHandler(w http.ResponseWriter, r *http.Request) {
+	licenseTypes, err := a.models.LicenseTypes.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"license_types": licenseTypes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,51 @@
+// Filename: cmd/api/auditHandlers.go
+package main
+
+import (
+	"net/http"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// listAuditEventsHandler handles GET /v1/audit. The audit trail is read
+// only; events are written alongside the changes they describe.
+func (a *app) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.AuditCriteria
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.ActorID = int64(a.getSingleIntegerParameter(qs, "actor_id", 0, v))
+	input.EntityType = a.getSingleQueryParameter(qs, "entity_type", "")
+	if input.EntityType != "" {
+		v.Check(validator.PermittedValue(input.EntityType, data.AuditEntityTypes...), "entity_type", "invalid entity type")
+	}
+	input.EntityID = int64(a.getSingleIntegerParameter(qs, "entity_id", 0, v))
+	input.From = a.getOptionalTimeParameter(qs, "from", v)
+	input.To = a.getOptionalTimeParameter(qs, "to", v)
+	if input.From != nil && input.To != nil {
+		v.Check(input.To.After(*input.From), "to", "must be after from")
+	}
+
+	input.Filters = a.readFilters(qs, "-created_at", data.AuditSortSafelist, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := a.models.Audit.GetAll(input.AuditCriteria, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"audit_events": events, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
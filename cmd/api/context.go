@@ -10,6 +10,9 @@ import (
 type contextKey string
 
 const userContextKey = contextKey("user")
+const tokenContextKey = contextKey("token")
+const districtScopeContextKey = contextKey("districtScope")
+const permissionsContextKey = contextKey("permissions")
 
 func (a *app) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	// WithValue() expects the original context along with the new
@@ -26,3 +29,43 @@ func (a *app) contextGetUser(r *http.Request) *data.User {
 
     return user
 }
+
+// contextSetToken stores the authentication token the request was made with
+func (a *app) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the request's authentication token, or an empty
+// string for anonymous requests
+func (a *app) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// contextSetDistrictScope stores the districts the user's queries are
+// limited to
+func (a *app) contextSetDistrictScope(r *http.Request, scope data.DistrictScope) *http.Request {
+	ctx := context.WithValue(r.Context(), districtScopeContextKey, scope)
+	return r.WithContext(ctx)
+}
+
+// contextGetDistrictScope returns the request's district scope, which is
+// unrestricted if none was stored
+func (a *app) contextGetDistrictScope(r *http.Request) data.DistrictScope {
+	scope, _ := r.Context().Value(districtScopeContextKey).(data.DistrictScope)
+	return scope
+}
+
+// contextSetPermissions stores the permissions the user's role grants
+func (a *app) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the request's permissions, which are empty
+// for anonymous requests
+func (a *app) contextGetPermissions(r *http.Request) data.Permissions {
+	permissions, _ := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions
+}
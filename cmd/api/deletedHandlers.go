@@ -0,0 +1,156 @@
+// Filename: cmd/api/deletedHandlers.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Deleting a user, teacher or document only marks it as deleted. These
+// handlers let admins see what has been deleted and restore it, or purge
+// it from the database for good.
+
+// readDeletedParams reads the entity type and id of a deleted record from
+// the path. If either is invalid, it writes a 404 response and returns
+// false.
+func (a *app) readDeletedParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	entityType := httprouter.ParamsFromContext(r.Context()).ByName("entity_type")
+	id, err := a.readIDParam(r)
+	if err != nil || !validator.PermittedValue(entityType, data.DeletableEntityTypes...) {
+		a.notFoundResponse(w, r)
+		return "", 0, false
+	}
+	return entityType, int(id), true
+}
+
+// listDeletedHandler handles GET /v1/deleted. entity_type picks whether
+// users, teachers or documents are listed.
+func (a *app) listDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	entityType := a.getSingleQueryParameter(qs, "entity_type", "")
+	v.Check(entityType != "", "entity_type", "must be provided")
+	v.Check(validator.PermittedValue(entityType, data.DeletableEntityTypes...), "entity_type", "invalid entity type")
+
+	filters := a.readFilters(qs, "-deleted_at", data.DeletedSortSafelist, v)
+
+	if data.ValidateFilters(v, filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var (
+		records  []*data.DeletedRecord
+		metadata data.Metadata
+		err      error
+	)
+	models := a.modelsFor(r)
+	switch entityType {
+	case data.AuditEntityUser:
+		records, metadata, err = models.Users.GetDeleted(filters)
+	case data.AuditEntityTeacher:
+		records, metadata, err = models.Teachers.GetDeleted(filters)
+	case data.AuditEntityDocument:
+		records, metadata, err = models.Documents.GetDeleted(filters)
+	}
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"deleted": records, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreDeletedHandler handles POST /v1/deleted/:entity_type/:id/restore
+func (a *app) restoreDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	entityType, id, ok := a.readDeletedParams(w, r)
+	if !ok {
+		return
+	}
+
+	var err error
+	models := a.modelsFor(r)
+	switch entityType {
+	case data.AuditEntityUser:
+		err = models.Users.Restore(id)
+	case data.AuditEntityTeacher:
+		err = models.Teachers.Restore(id)
+	case data.AuditEntityDocument:
+		err = models.Documents.Restore(id)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	message := fmt.Sprintf("%s successfully restored", entityType)
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeDeletedHandler handles DELETE /v1/deleted/:entity_type/:id. Only
+// records that have already been deleted can be purged. Uploaded files of
+// purged documents are removed from storage too.
+func (a *app) purgeDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	entityType, id, ok := a.readDeletedParams(w, r)
+	if !ok {
+		return
+	}
+
+	var files []string
+	var err error
+	models := a.modelsFor(r)
+	switch entityType {
+	case data.AuditEntityUser:
+		err = models.Users.Purge(id)
+	case data.AuditEntityTeacher:
+		files, err = models.Teachers.Purge(id)
+	case data.AuditEntityDocument:
+		files, err = models.Documents.Purge(id)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrInUse):
+			a.errorResponseJSON(w, r, http.StatusConflict, "the user still has a teacher profile, which must be purged first")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The records are gone, so a file that cannot be removed is only
+	// logged rather than failing the request
+	for _, key := range files {
+		if a.storage == nil {
+			break
+		}
+		if err := a.storage.Delete(context.Background(), key); err != nil {
+			a.logger.Error("unable to remove purged upload", "key", key, "error", err.Error())
+		}
+	}
+
+	message := fmt.Sprintf("%s permanently deleted", entityType)
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
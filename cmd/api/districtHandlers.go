@@ -27,17 +27,20 @@ func (a *app) createDistrictHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v := validator.New()
-	v.Check(district.Name != "", "name", "must be provided")
-	v.Check(len(district.Name) <= 50, "name", "must not be more than 50 characters long")
-
-	if !v.IsEmpty() {
+	if data.ValidateDistrict(v, district); !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	err = a.models.Districts.Insert(district)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "a district with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -77,21 +80,83 @@ func (a *app) getDistrictHandler(w http.ResponseWriter, r *http.Request) {
 
 // getAllDistrictsHandler handles GET /v1/districts
 func (a *app) getAllDistrictsHandler(w http.ResponseWriter, r *http.Request) {
-	districts, err := a.models.Districts.GetAll()
+	v := validator.New()
+	qs := r.URL.Query()
+
+	name := a.getSingleQueryParameter(qs, "name", "")
+	filters := a.readFilters(qs, "name", data.DistrictSortSafelist, v)
+
+	if data.ValidateFilters(v, filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	districts, metadata, err := a.models.Districts.GetAll(name, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	metadata := data.Metadata{
-		CurrentPage:  1,
-		PageSize:     len(districts),
-		FirstPage:    1,
-		LastPage:     1,
-		TotalRecords: len(districts),
+	err = a.writeJSON(w, http.StatusOK, envelope{"districts": districts, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
 	}
+}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"districts": districts, "metadata": metadata}, nil)
+// updateDistrictHandler handles PATCH /v1/districts/:id
+func (a *app) updateDistrictHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	district, err := a.models.Districts.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		district.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateDistrict(v, district); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.Districts.Update(district)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "a district with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"district": district}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
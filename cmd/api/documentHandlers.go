@@ -2,80 +2,190 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/storage"
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
-// createDocumentHandler handles POST /v1/documents
+// createDocumentHandler handles POST /v1/documents. Documents are only
+// created by uploading the file itself as multipart/form-data, so every
+// document has a stored, checked file behind it.
 func (a *app) createDocumentHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		TeacherID     int    `json:"teacher_id"`
-		DocType       string `json:"doc_type"`
-		FilePath      string `json:"file_path"`
-		UploadedBy    int    `json:"uploaded_by,omitempty"`
-		Verified      bool   `json:"verified,omitempty"`
-		VerifiedBy    int    `json:"verified_by,omitempty"`
-		Remarks       string `json:"remarks,omitempty"`
-		ApplicationID int    `json:"application_id,omitempty"`
+	a.createDocument(w, r, 0)
+}
+
+// createDocument adds a document. A non-zero teacherID takes the place of
+// the teacher_id in the request.
+func (a *app) createDocument(w http.ResponseWriter, r *http.Request, teacherID int) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		a.unsupportedMediaTypeResponse(w, r, "documents must be uploaded as multipart/form-data with a file part")
+		return
 	}
+	a.uploadDocument(w, r, teacherID)
+}
 
-	err := a.readJSON(w, r, &input)
+// getDocumentHandler handles GET /v1/documents/:id
+func (a *app) getDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
 	if err != nil {
-		a.badRequestResponse(w, r, err)
+		a.notFoundResponse(w, r)
 		return
 	}
 
-	document := &data.Document{
-		TeacherID:     input.TeacherID,
-		DocType:       input.DocType,
-		FilePath:      input.FilePath,
-		UploadedBy:    input.UploadedBy,
-		Verified:      input.Verified,
-		VerifiedBy:    input.VerifiedBy,
-		Remarks:       input.Remarks,
-		ApplicationID: input.ApplicationID,
+	document, err := a.modelsFor(r).Documents.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, document.TeacherID) {
+		return
 	}
 
+	err = a.writeJSON(w, http.StatusOK, envelope{"document": document}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getDocumentsByTeacherHandler handles GET /v1/teachers/:id/documents
+func (a *app) getDocumentsByTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	teacherID, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, int(teacherID)) {
+		return
+	}
+
+	a.listDocuments(w, r, int(teacherID))
+}
+
+// listDocuments writes a page of the teacher's documents
+func (a *app) listDocuments(w http.ResponseWriter, r *http.Request, teacherID int) {
 	v := validator.New()
-	v.Check(document.TeacherID > 0, "teacher_id", "must be provided")
-	v.Check(document.DocType != "", "doc_type", "must be provided")
-	v.Check(len(document.DocType) <= 100, "doc_type", "must not be more than 100 characters long")
-	v.Check(document.FilePath != "", "file_path", "must be provided")
-	v.Check(len(document.FilePath) <= 255, "file_path", "must not be more than 255 characters long")
+	filters := a.readFilters(r.URL.Query(), "-uploaded_at", data.DocumentSortSafelist, v)
 
-	if !v.IsEmpty() {
+	if data.ValidateFilters(v, filters); !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = a.models.Documents.Insert(document)
+	documents, metadata, err := a.modelsFor(r).Documents.GetByTeacher(teacherID, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/documents/%d", document.ID))
+	err = a.writeJSON(w, http.StatusOK, envelope{"documents": documents, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
 
-	err = a.writeJSON(w, http.StatusCreated, envelope{"document": document}, headers)
+// deleteDocumentHandler handles DELETE /v1/documents/:id
+func (a *app) deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	document, err := a.modelsFor(r).Documents.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, document.TeacherID) {
+		return
+	}
+
+	err = a.modelsFor(r).Documents.Delete(document.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "document successfully deleted"}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
-// getDocumentHandler handles GET /v1/documents/:id
-func (a *app) getDocumentHandler(w http.ResponseWriter, r *http.Request) {
+// verifyDocumentHandler handles POST /v1/documents/:id/verify
+func (a *app) verifyDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	a.reviewDocument(w, r, data.DocumentStatusVerified)
+}
+
+// rejectDocumentHandler handles POST /v1/documents/:id/reject
+func (a *app) rejectDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	a.reviewDocument(w, r, data.DocumentStatusRejected)
+}
+
+// reviewDocument records a reviewer's decision on a pending document.
+// Remarks are optional when verifying but required when rejecting so the
+// teacher knows what to fix.
+func (a *app) reviewDocument(w http.ResponseWriter, r *http.Request, status string) {
 	id, err := a.readIDParam(r)
 	if err != nil {
 		a.notFoundResponse(w, r)
 		return
 	}
 
-	document, err := a.models.Documents.Get(int(id))
+	var input struct {
+		Remarks string `json:"remarks"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if status == data.DocumentStatusRejected {
+		v.Check(strings.TrimSpace(input.Remarks) != "", "remarks", "must be provided when rejecting a document")
+	}
+	v.Check(len(input.Remarks) <= 1000, "remarks", "must not be more than 1000 characters long")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	document, err := a.modelsFor(r).Documents.Get(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -86,41 +196,236 @@ func (a *app) getDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := a.contextGetUser(r)
+	err = a.modelsFor(r).Documents.Review(document, status, int(user.ID), input.Remarks)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			a.invalidTransitionResponse(w, r, errors.New("the document has already been reviewed"))
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = a.writeJSON(w, http.StatusOK, envelope{"document": document}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
-// getDocumentsByTeacherHandler handles GET /v1/teachers/:teacher_id/documents
-func (a *app) getDocumentsByTeacherHandler(w http.ResponseWriter, r *http.Request) {
-	teacherID, err := a.readIDParam(r)
+// listVerificationQueueHandler handles GET /v1/verification-queue
+func (a *app) listVerificationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DistrictID int
+		DocType    string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.DistrictID = a.getSingleIntegerParameter(qs, "district_id", 0, v)
+	input.DocType = a.getSingleQueryParameter(qs, "doc_type", "")
+
+	input.Filters.Page = a.getSingleIntegerParameter(qs, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(qs, "page_size", 20, v)
+	input.Filters.Sort = a.getSingleQueryParameter(qs, "sort", "uploaded_at")
+	input.Filters.SortSafelist = data.VerificationQueueSortSafelist
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	documents, metadata, err := a.modelsFor(r).Documents.GetVerificationQueue(input.DistrictID, input.DocType, input.Filters)
 	if err != nil {
-		a.notFoundResponse(w, r)
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"documents": documents, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadDocument handles a multipart POST /v1/documents. The form has a
+// "file" part plus teacher_id, doc_type and optional application_id and
+// remarks fields, in any order. The file is streamed straight to storage
+// while its size and SHA-256 are computed. A non-zero teacherID takes the
+// place of the teacher_id field.
+func (a *app) uploadDocument(w http.ResponseWriter, r *http.Request, teacherID int) {
+	if a.storage == nil {
+		a.serverErrorResponse(w, r, errors.New("document storage is not configured"))
+		return
+	}
+
+	// leave some room for the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, a.config.storage.maxUploadBytes+64_000)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	fields := map[string]string{}
+	var file *storedFile
+
+	// remove the stored file if the document is never recorded
+	recorded := false
+	defer func() {
+		if file != nil && !recorded {
+			if err := a.storage.Delete(context.Background(), file.key); err != nil {
+				a.logger.Error("unable to remove orphaned upload", "key", file.key, "error", err.Error())
+			}
+		}
+	}()
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			a.uploadErrorResponse(w, r, err)
+			return
+		}
+
+		name := part.FormName()
+		switch {
+		case name == "file":
+			if file != nil {
+				a.badRequestResponse(w, r, errors.New("only one file may be uploaded per document"))
+				return
+			}
+			file, err = a.storeUpload(r.Context(), part)
+			if err != nil {
+				a.uploadErrorResponse(w, r, err)
+				return
+			}
+		case name != "":
+			value, err := io.ReadAll(io.LimitReader(part, 4_096))
+			if err != nil {
+				a.uploadErrorResponse(w, r, err)
+				return
+			}
+			fields[name] = string(value)
+		}
+		part.Close()
+	}
+
+	v := validator.New()
+	v.Check(file != nil, "file", "must be provided")
+	v.Check(file == nil || file.size > 0, "file", "must not be empty")
+
+	if teacherID == 0 {
+		teacherID, err = strconv.Atoi(fields["teacher_id"])
+		v.Check(err == nil && teacherID > 0, "teacher_id", "must be provided")
+	}
+
+	applicationID := 0
+	if fields["application_id"] != "" {
+		applicationID, err = strconv.Atoi(fields["application_id"])
+		v.Check(err == nil && applicationID > 0, "application_id", "must be a positive integer")
+	}
+
+	document := &data.Document{
+		TeacherID:     teacherID,
+		DocType:       fields["doc_type"],
+		Remarks:       fields["remarks"],
+		ApplicationID: applicationID,
+		UploadedBy:    int(a.contextGetUser(r).ID),
+	}
+	v.Check(document.DocType != "", "doc_type", "must be provided")
+	v.Check(len(document.DocType) <= 100, "doc_type", "must not be more than 100 characters long")
+	v.Check(len(document.Remarks) <= 1000, "remarks", "must not be more than 1000 characters long")
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, document.TeacherID) {
+		return
+	}
+
+	_, err = a.modelsFor(r).Teachers.Get(document.TeacherID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("teacher_id", "teacher does not exist")
+		default:
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Each document type limits what may be uploaded for it
+	documentType, err := a.models.DocumentTypes.GetByCode(document.DocType)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("doc_type", "unknown document type")
+		default:
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		v.Check(slices.Contains(documentType.AllowedMIMETypes, file.contentType), "file", fmt.Sprintf("%s files are not accepted for %s", file.contentType, documentType.Name))
+		v.Check(file.size <= documentType.MaxSizeBytes, "file", fmt.Sprintf("must not be larger than %d bytes for %s", documentType.MaxSizeBytes, documentType.Name))
+	}
+
+	if document.ApplicationID > 0 {
+		_, err = a.modelsFor(r).Applications.Get(document.ApplicationID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("application_id", "application does not exist")
+			default:
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	documents, err := a.models.Documents.GetByTeacher(int(teacherID))
+	document.FilePath = file.key
+	document.FileName = file.name
+	document.ContentType = file.contentType
+	document.FileSize = file.size
+	document.SHA256 = file.sha256
+
+	err = a.modelsFor(r).Documents.Insert(document)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
+	recorded = true
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/documents/%d", document.ID))
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"documents": documents}, nil)
+	err = a.writeJSON(w, http.StatusCreated, envelope{"document": document}, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
-// deleteDocumentHandler handles DELETE /v1/documents/:id
-func (a *app) deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
+// getDocumentFileHandler handles GET /v1/documents/:id/file
+func (a *app) getDocumentFileHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := a.readIDParam(r)
 	if err != nil {
 		a.notFoundResponse(w, r)
 		return
 	}
 
-	err = a.models.Documents.Delete(int(id))
+	document, err := a.modelsFor(r).Documents.Get(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -131,8 +436,121 @@ func (a *app) deleteDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"message": "document successfully deleted"}, nil)
+	if !a.requireTeacherOwner(w, r, document.TeacherID) {
+		return
+	}
+
+	// Documents recorded by path, before uploads were required, have no
+	// stored file
+	if document.SHA256 == "" || a.storage == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	file, err := a.storage.Get(r.Context(), document.FilePath)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, storage.ErrObjectNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	filename := document.FileName
+	if filename == "" {
+		filename = fmt.Sprintf("document-%d", document.ID)
+	}
+
+	w.Header().Set("Content-Type", document.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(document.FileSize, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(w, file)
+	if err != nil {
+		a.logError(r, err)
+	}
+}
+
+// errFileTooLarge is returned while streaming an upload over the size limit
+var errFileTooLarge = errors.New("file too large")
+
+// storedFile describes an upload that has been written to storage
+type storedFile struct {
+	key         string
+	name        string
+	contentType string
+	size        int64
+	sha256      string
+}
+
+// storeUpload streams one multipart file part to storage under a random
+// key. The content type is sniffed from the file itself rather than trusted
+// from the client.
+func (a *app) storeUpload(ctx context.Context, part *multipart.Part) (*storedFile, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	key := fmt.Sprintf("documents/%d/%02d/%s", now.Year(), now.Month(), hex.EncodeToString(random))
+
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head)
+
+	hash := sha256.New()
+	counter := &limitedCounter{r: io.TeeReader(buffered, hash), max: a.config.storage.maxUploadBytes}
+
+	err = a.storage.Put(ctx, key, counter, -1, contentType)
+	if err != nil {
+		// the backend may wrap the reader's error
+		if counter.n > counter.max {
+			return nil, errFileTooLarge
+		}
+		return nil, err
+	}
+
+	return &storedFile{
+		key:         key,
+		name:        part.FileName(),
+		contentType: contentType,
+		size:        counter.n,
+		sha256:      hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// limitedCounter counts the bytes read through it and fails once more than
+// max have been read
+type limitedCounter struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (c *limitedCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n > c.max {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// uploadErrorResponse maps errors raised while reading a multipart body
+func (a *app) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	switch {
+	case errors.Is(err, errFileTooLarge), errors.As(err, &maxBytesError):
+		a.fileTooLargeResponse(w, r)
+	default:
+		a.badRequestResponse(w, r, err)
 	}
 }
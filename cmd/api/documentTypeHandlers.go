@@ -0,0 +1,151 @@
+// Filename: cmd/api/documentTypeHandlers.go
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// createDocumentTypeHandler handles POST /v1/document-types
+func (a *app) createDocumentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code             string   `json:"code"`
+		Name             string   `json:"name"`
+		Description      string   `json:"description,omitempty"`
+		AllowedMIMETypes []string `json:"allowed_mime_types"`
+		MaxSizeBytes     int64    `json:"max_size_bytes"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	documentType := &data.DocumentType{
+		Code:             input.Code,
+		Name:             input.Name,
+		Description:      input.Description,
+		AllowedMIMETypes: input.AllowedMIMETypes,
+		MaxSizeBytes:     input.MaxSizeBytes,
+	}
+
+	v := validator.New()
+	if data.ValidateDocumentType(v, documentType); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.DocumentTypes.Insert(documentType)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateDocumentType):
+			v.AddError("code", "a document type with this code already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/document-types/%d", documentType.ID))
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"document_type": documentType}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listDocumentTypesHandler handles GET /v1/document-types
+func (a *app) listDocumentTypesHandler(w http.ResponseWriter, r *http.Request) {
+	documentTypes, err := a.models.DocumentTypes.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"document_types": documentTypes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateDocumentTypeHandler handles PATCH /v1/document-types/:id
+func (a *app) updateDocumentTypeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	documentType, err := a.models.DocumentTypes.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Code             *string  `json:"code"`
+		Name             *string  `json:"name"`
+		Description      *string  `json:"description"`
+		AllowedMIMETypes []string `json:"allowed_mime_types"`
+		MaxSizeBytes     *int64   `json:"max_size_bytes"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		documentType.Code = *input.Code
+	}
+	if input.Name != nil {
+		documentType.Name = *input.Name
+	}
+	if input.Description != nil {
+		documentType.Description = *input.Description
+	}
+	if input.AllowedMIMETypes != nil {
+		documentType.AllowedMIMETypes = input.AllowedMIMETypes
+	}
+	if input.MaxSizeBytes != nil {
+		documentType.MaxSizeBytes = *input.MaxSizeBytes
+	}
+
+	v := validator.New()
+	if data.ValidateDocumentType(v, documentType); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.DocumentTypes.Update(documentType)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateDocumentType):
+			v.AddError("code", "a document type with this code already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"document_type": documentType}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -12,6 +12,12 @@ import (
 
 // createEducationHandler handles POST /v1/education
 func (a *app) createEducationHandler(w http.ResponseWriter, r *http.Request) {
+	a.createEducation(w, r, 0)
+}
+
+// createEducation adds an education record. A non-zero teacherID takes the
+// place of the teacher_id in the request body.
+func (a *app) createEducation(w http.ResponseWriter, r *http.Request, teacherID int) {
 	var input struct {
 		TeacherID     int    `json:"teacher_id"`
 		Institution   string `json:"institution"`
@@ -28,6 +34,10 @@ func (a *app) createEducationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if teacherID > 0 {
+		input.TeacherID = teacherID
+	}
+
 	education := &data.Education{
 		TeacherID:     input.TeacherID,
 		Institution:   input.Institution,
@@ -39,18 +49,15 @@ func (a *app) createEducationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v := validator.New()
-	v.Check(education.TeacherID > 0, "teacher_id", "must be provided")
-	v.Check(education.Institution != "", "institution", "must be provided")
-	v.Check(len(education.Institution) <= 150, "institution", "must not be more than 150 characters long")
-	v.Check(len(education.Level) <= 50, "level", "must not be more than 50 characters long")
-	v.Check(len(education.Program) <= 100, "program", "must not be more than 100 characters long")
-	v.Check(len(education.Degree) <= 100, "degree", "must not be more than 100 characters long")
-
-	if !v.IsEmpty() {
+	if data.ValidateEducation(v, education); !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	if !a.requireTeacherOwner(w, r, education.TeacherID) {
+		return
+	}
+
 	err = a.models.Education.Insert(education)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
@@ -85,13 +92,17 @@ func (a *app) getEducationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !a.requireTeacherOwner(w, r, education.TeacherID) {
+		return
+	}
+
 	err = a.writeJSON(w, http.StatusOK, envelope{"education": education}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
-// getEducationByTeacherHandler handles GET /v1/teachers/:teacher_id/education
+// getEducationByTeacherHandler handles GET /v1/teachers/:id/education
 func (a *app) getEducationByTeacherHandler(w http.ResponseWriter, r *http.Request) {
 	teacherID, err := a.readIDParam(r)
 	if err != nil {
@@ -99,13 +110,110 @@ func (a *app) getEducationByTeacherHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	educations, err := a.models.Education.GetByTeacher(int(teacherID))
+	if !a.requireTeacherOwner(w, r, int(teacherID)) {
+		return
+	}
+
+	a.listEducation(w, r, int(teacherID))
+}
+
+// listEducation writes a page of the teacher's education records
+func (a *app) listEducation(w http.ResponseWriter, r *http.Request, teacherID int) {
+	v := validator.New()
+	filters := a.readFilters(r.URL.Query(), "-year_obtained", data.EducationSortSafelist, v)
+
+	if data.ValidateFilters(v, filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	educations, metadata, err := a.models.Education.GetByTeacher(teacherID, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"education": educations}, nil)
+	err = a.writeJSON(w, http.StatusOK, envelope{"education": educations, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateEducationHandler handles PATCH /v1/education/:id
+func (a *app) updateEducationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	education, err := a.models.Education.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, education.TeacherID) {
+		return
+	}
+
+	var input struct {
+		Institution   *string `json:"institution"`
+		Level         *string `json:"level"`
+		Program       *string `json:"program"`
+		Degree        *string `json:"degree"`
+		YearObtained  *int    `json:"year_obtained"`
+		InstitutionID *int    `json:"institution_id"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Institution != nil {
+		education.Institution = *input.Institution
+	}
+	if input.Level != nil {
+		education.Level = *input.Level
+	}
+	if input.Program != nil {
+		education.Program = *input.Program
+	}
+	if input.Degree != nil {
+		education.Degree = *input.Degree
+	}
+	if input.YearObtained != nil {
+		education.YearObtained = *input.YearObtained
+	}
+	if input.InstitutionID != nil {
+		education.InstitutionID = *input.InstitutionID
+	}
+
+	v := validator.New()
+	if data.ValidateEducation(v, education); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.Education.Update(education)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"education": education}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -119,7 +227,22 @@ func (a *app) deleteEducationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.models.Education.Delete(int(id))
+	education, err := a.models.Education.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, education.TeacherID) {
+		return
+	}
+
+	err = a.models.Education.Delete(education.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // log an error message
@@ -71,6 +74,14 @@ func (a *app) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request)
 	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
 }
 
+// 429 when an account must wait before trying to log in again
+func (a *app) loginThrottledResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many failed login attempts, please try again later"
+	a.errorResponseJSON(w, r, http.StatusTooManyRequests, message)
+}
+
 func (a *app) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
 	a.errorResponseJSON(w, r, http.StatusConflict, message)
@@ -106,3 +117,19 @@ func (a *app) notPermittedResponse(w http.ResponseWriter,
 
     a.errorResponseJSON(w, r, http.StatusForbidden, message)
 }
+
+// 409 Conflict when a workflow action is not legal from the record's current state
+func (a *app) invalidTransitionResponse(w http.ResponseWriter, r *http.Request, err error) {
+	a.errorResponseJSON(w, r, http.StatusConflict, err.Error())
+}
+
+// 413 when an uploaded file is over the configured size limit
+func (a *app) fileTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the file must not be larger than %d bytes", a.config.storage.maxUploadBytes)
+	a.errorResponseJSON(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+// 415 when a request body is not in a format the endpoint accepts
+func (a *app) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, message string) {
+	a.errorResponseJSON(w, r, http.StatusUnsupportedMediaType, message)
+}
@@ -1,16 +1,37 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/amilcar-vasquez/impartBelize/internal/certificate"
 	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
+	"github.com/amilcar-vasquez/impartBelize/internal/signer"
+	"github.com/amilcar-vasquez/impartBelize/internal/storage"
+	"github.com/amilcar-vasquez/impartBelize/internal/totp"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+	"github.com/julienschmidt/httprouter"
 )
 
 // newTestApp creates a new application instance for testing
@@ -38,6 +59,36 @@ func executeRequest(t *testing.T, app *app, method, url string, body io.Reader)
 	return rr
 }
 
+// executeHandlerRequest routes a request to a single handler registered at
+// pattern, with the given user stored in the request context and allowed
+// to see every district. This bypasses the authentication middleware so
+// handlers can be exercised as a specific user.
+func executeHandlerRequest(t *testing.T, app *app, user *data.User, method, pattern, url string, handler http.HandlerFunc, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set("Content-Type", "application/json")
+	req = app.contextSetUser(req, user)
+	req = app.contextSetDistrictScope(req, data.AllDistricts())
+
+	// Tests with a database see the permissions the user's role grants, as
+	// the authentication middleware would load them
+	if app.models.Permissions.DB != nil {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = app.contextSetPermissions(req, permissions)
+	}
+
+	router := httprouter.New()
+	router.Handler(method, pattern, handler)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	return rr
+}
+
 // checkResponseCode checks if the response status code matches expected
 func checkResponseCode(t *testing.T, expected, actual int) {
 	t.Helper()
@@ -46,6 +97,117 @@ func checkResponseCode(t *testing.T, expected, actual int) {
 	}
 }
 
+// newTestDBApp returns a test app whose models use the database named by
+// TEST_DB_DSN, which must have every migration applied. Tests that need
+// real queries are skipped when it is not set.
+func newTestDBApp(t *testing.T) *app {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	var cfg configuration
+	cfg.db.dsn = dsn
+	db, err := openDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), 32))
+	keyring, err := encryption.New("test:"+key, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t)
+	app.models = data.NewModels(db, keyring)
+	return app
+}
+
+// createTestUser adds an activated user with the named role, creating the
+// role if the database does not have it yet. The email is unique to the
+// run, so tests can share a database.
+func createTestUser(t *testing.T, app *app, roleName, password string) *data.User {
+	t.Helper()
+	db := app.models.Users.DB
+
+	var roleID int
+	err := db.QueryRow(`
+		WITH created AS (
+			INSERT INTO roles (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING role_id
+		)
+		SELECT role_id FROM created
+		UNION ALL
+		SELECT role_id FROM roles WHERE name = $1`, roleName).Scan(&roleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("%s-%d", strings.ToLower(roleName), time.Now().UnixNano())
+	user := &data.User{
+		Username:    name,
+		Email:       name + "@example.com",
+		RoleID:      roleID,
+		RoleName:    roleName,
+		IsActive:    true,
+		IsActivated: true,
+	}
+	if err := user.Password.Set(password); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Users.Insert(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestTeacher adds a teacher profile linked to the user
+func createTestTeacher(t *testing.T, app *app, user *data.User) *data.Teacher {
+	t.Helper()
+
+	var districtID int
+	err := app.models.Users.DB.QueryRow(`SELECT min(district_id) FROM districts`).Scan(&districtID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	teacher := &data.Teacher{
+		UserID:        int(user.ID),
+		FirstName:     "Test",
+		LastName:      user.Username,
+		Email:         user.Email,
+		DistrictID:    districtID,
+		ProfileStatus: "active",
+	}
+	if err := app.models.Teachers.Insert(teacher); err != nil {
+		t.Fatal(err)
+	}
+	return teacher
+}
+
+// createTestLicense adds an active license held by the teacher
+func createTestLicense(t *testing.T, app *app, teacher *data.Teacher) *data.License {
+	t.Helper()
+
+	var id int
+	number := fmt.Sprintf("TST-%d-%09d", time.Now().Year(), time.Now().UnixNano()%1e9)
+	err := app.models.Users.DB.QueryRow(`
+		INSERT INTO licenses (license_number, teacher_id, license_class, level, issue_date, expiry_date)
+		VALUES ($1, $2, 'full', 'primary', CURRENT_DATE, CURRENT_DATE + 365)
+		RETURNING license_id`, number, teacher.ID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	license, err := app.models.Unscoped().Licenses.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return license
+}
+
 // TestMain runs before all tests
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
@@ -211,9 +373,281 @@ func TestCreateDocumentHandler(t *testing.T) {
 	}
 }
 
-// Notification Handler Tests
-func TestCreateNotificationHandler(t *testing.T) {
+func TestReviewDocumentHandler(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 2, RoleID: 2, RoleName: "DEC", IsActive: true, IsActivated: true}
+
+	t.Run("Documents cannot be recorded by path", func(t *testing.T) {
+		payload := `{"teacher_id": 1, "doc_type": "degree_certificate", "file_path": "degree.pdf", "verified": true, "verified_by": 1}`
+		rr := executeHandlerRequest(t, app, user, "POST", "/v1/documents", "/v1/documents", app.createDocumentHandler, bytes.NewBufferString(payload))
+		checkResponseCode(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+
+	t.Run("Rejecting requires remarks", func(t *testing.T) {
+		rr := executeHandlerRequest(t, app, user, "POST", "/v1/documents/:id/reject", "/v1/documents/1/reject", app.rejectDocumentHandler, bytes.NewBufferString(`{"remarks": " "}`))
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Unknown queue sort", func(t *testing.T) {
+		rr := executeHandlerRequest(t, app, user, "GET", "/v1/verification-queue", "/v1/verification-queue?sort=ssn", app.listVerificationQueueHandler, nil)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestUploadDocumentHandler(t *testing.T) {
+	dir := t.TempDir()
+	local, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApp(t)
+	app.storage = local
+	app.config.storage.maxUploadBytes = 1024
+	user := &data.User{ID: 1, RoleID: 3, RoleName: "Teacher", IsActive: true, IsActivated: true}
+
+	upload := func(fields map[string]string, file []byte) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		if file != nil {
+			fw, _ := mw.CreateFormFile("file", "degree.pdf")
+			fw.Write(file)
+		}
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/documents", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = app.contextSetUser(req, user)
+
+		rr := httptest.NewRecorder()
+		app.createDocumentHandler(rr, req)
+		return rr
+	}
+
+	// stored files left behind in the storage directory
+	storedFiles := func() int {
+		count := 0
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				count++
+			}
+			return nil
+		})
+		return count
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		rr := upload(map[string]string{"teacher_id": "1", "doc_type": "degree_certificate"}, nil)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("Invalid fields remove the stored file", func(t *testing.T) {
+		rr := upload(map[string]string{"doc_type": "degree_certificate"}, []byte("%PDF-1.4 test"))
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		if n := storedFiles(); n != 0 {
+			t.Errorf("expected the upload to be removed, found %d stored files", n)
+		}
+	})
+
+	t.Run("File too large", func(t *testing.T) {
+		rr := upload(map[string]string{"teacher_id": "1", "doc_type": "degree_certificate"}, bytes.Repeat([]byte("a"), 2048))
+		checkResponseCode(t, http.StatusRequestEntityTooLarge, rr.Code)
+		if n := storedFiles(); n != 0 {
+			t.Errorf("expected no stored files, found %d", n)
+		}
+	})
+}
+
+// fakeS3 is an in-memory stand-in for an S3-compatible service. It serves
+// just enough of the API for the S3 storage backend: bucket checks, single
+// and multipart object uploads, reads and deletes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	uploads map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]map[string][]byte{}, uploads: map[string][]byte{}}
+}
+
+// readS3Body returns the payload of an upload, unwrapping the aws-chunked
+// encoding the client uses over plain HTTP
+func readS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	body := bufio.NewReader(r.Body)
+	payload := new(bytes.Buffer)
+	for {
+		header, err := body.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(header), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return payload.Bytes(), nil
+		}
+		if _, err := io.CopyN(payload, body, size); err != nil {
+			return nil, err
+		}
+		if _, err := body.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	objects, exists := f.buckets[bucket]
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodPut:
+			f.buckets[bucket] = map[string][]byte{}
+		case !exists:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID = strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[uploadID] = nil
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, uploadID)
+	case r.Method == http.MethodPost && uploadID != "":
+		objects[key] = f.uploads[uploadID]
+		delete(f.uploads, uploadID)
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"object"</ETag></CompleteMultipartUploadResult>`, bucket, key)
+	case r.Method == http.MethodPut:
+		payload, err := readS3Body(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if uploadID != "" {
+			f.uploads[uploadID] = append(f.uploads[uploadID], payload...)
+		} else {
+			objects[key] = payload
+		}
+		w.Header().Set("ETag", `"object"`)
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		payload, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"object"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		if r.Method == http.MethodGet {
+			w.Write(payload)
+		}
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	endpoint := strings.TrimPrefix(server.URL, "http://")
+	s3, err := storage.NewS3(ctx, endpoint, "access", "secret", "impart-documents", "us-east-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.buckets["impart-documents"]; !ok {
+		t.Fatal("expected the bucket to be created")
+	}
+
+	for _, size := range []int64{-1, 13} {
+		t.Run(fmt.Sprintf("Round trip with size %d", size), func(t *testing.T) {
+			key := fmt.Sprintf("teachers/1/%d.pdf", size)
+			content := []byte("%PDF-1.4 test")
+			err := s3.Put(ctx, key, bytes.NewReader(content), size, "application/pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			object, err := s3.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored, err := io.ReadAll(object)
+			object.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored, content) {
+				t.Errorf("expected %q, got %q", content, stored)
+			}
+
+			if err := s3.Delete(ctx, key); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s3.Get(ctx, key); !errors.Is(err, storage.ErrObjectNotFound) {
+				t.Errorf("expected ErrObjectNotFound after delete, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Invalid upload is removed from the bucket", func(t *testing.T) {
+		app := newTestApp(t)
+		app.storage = s3
+		app.config.storage.maxUploadBytes = 1024
+		user := &data.User{ID: 1, RoleID: 3, RoleName: "Teacher", IsActive: true, IsActivated: true}
+
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		mw.WriteField("doc_type", "degree_certificate")
+		fw, _ := mw.CreateFormFile("file", "degree.pdf")
+		fw.Write([]byte("%PDF-1.4 test"))
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/documents", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = app.contextSetUser(req, user)
+		rr := httptest.NewRecorder()
+		app.createDocumentHandler(rr, req)
+
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		if n := len(fake.buckets["impart-documents"]); n != 0 {
+			t.Errorf("expected the upload to be removed, found %d stored objects", n)
+		}
+	})
+}
+
+func TestCreateDocumentTypeHandler(t *testing.T) {
 	app := newTestApp(t)
+	user := &data.User{ID: 1, RoleID: 1, RoleName: "Admin", IsActive: true, IsActivated: true}
 
 	tests := []struct {
 		name           string
@@ -221,28 +655,106 @@ func TestCreateNotificationHandler(t *testing.T) {
 		expectedStatus int
 	}{
 		{
-			name:           "Missing user_id",
-			payload:        `{"user_id": 0, "message": "test"}`,
+			name:           "Code with spaces",
+			payload:        `{"code": "Degree Cert", "name": "Degree Certificate", "allowed_mime_types": ["application/pdf"], "max_size_bytes": 1048576}`,
 			expectedStatus: http.StatusUnprocessableEntity,
 		},
 		{
-			name:           "Missing message",
-			payload:        `{"user_id": 1, "message": ""}`,
+			name:           "No MIME types",
+			payload:        `{"code": "degree_certificate", "name": "Degree Certificate", "allowed_mime_types": [], "max_size_bytes": 1048576}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Invalid MIME type",
+			payload:        `{"code": "degree_certificate", "name": "Degree Certificate", "allowed_mime_types": ["pdf"], "max_size_bytes": 1048576}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Missing max size",
+			payload:        `{"code": "degree_certificate", "name": "Degree Certificate", "allowed_mime_types": ["application/pdf"]}`,
 			expectedStatus: http.StatusUnprocessableEntity,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rr := executeRequest(t, app, "POST", "/v1/notifications", bytes.NewBufferString(tt.payload))
+			rr := executeHandlerRequest(t, app, user, "POST", "/v1/document-types", "/v1/document-types", app.createDocumentTypeHandler, bytes.NewBufferString(tt.payload))
 			checkResponseCode(t, tt.expectedStatus, rr.Code)
 		})
 	}
+
+	t.Run("Checklist is incomplete while documents are missing or rejected", func(t *testing.T) {
+		checklist := &data.Checklist{Items: []*data.ChecklistItem{
+			{DocType: "birth_certificate", Status: data.ChecklistVerified},
+			{DocType: "police_record", Status: data.ChecklistRejected},
+			{DocType: "academic_transcript", Status: data.ChecklistUploaded},
+			{DocType: "degree_certificate", Status: data.ChecklistMissing},
+		}}
+		missing := checklist.Missing()
+		if len(missing) != 2 || missing[0] != "police_record" || missing[1] != "degree_certificate" {
+			t.Errorf("unexpected missing documents %v", missing)
+		}
+	})
 }
 
-// Token Handler Tests
-func TestCreateAuthTokenHandler(t *testing.T) {
+func TestChecklistIgnoresDocumentsWithoutFiles(t *testing.T) {
+	app := newTestDBApp(t)
+	models := app.models.Unscoped()
+
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-checklist")
+	teacher := createTestTeacher(t, app, user)
+
+	licenseType, err := models.LicenseTypes.GetByClass("provisional")
+	if err != nil {
+		t.Fatal(err)
+	}
+	application := &data.Application{TeacherID: teacher.ID, LicenseTypeID: licenseType.ID, Status: data.ApplicationStatusDraft}
+	if err := models.Applications.Insert(application); err != nil {
+		t.Fatal(err)
+	}
+
+	// A document recorded by path alone has nothing behind it
+	pathOnly := &data.Document{TeacherID: teacher.ID, DocType: "birth_certificate", FilePath: "birth.pdf"}
+	uploaded := &data.Document{
+		TeacherID:   teacher.ID,
+		DocType:     "identification",
+		FilePath:    "documents/identification.pdf",
+		FileName:    "identification.pdf",
+		ContentType: "application/pdf",
+		FileSize:    13,
+		SHA256:      strings.Repeat("ab", 32),
+	}
+	for _, document := range []*data.Document{pathOnly, uploaded} {
+		if err := models.Documents.Insert(document); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	required, err := models.DocumentTypes.GetRequiredFor(licenseType.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checklist, err := models.Documents.GetChecklist(application, required)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := map[string]string{}
+	for _, item := range checklist.Items {
+		statuses[item.DocType] = item.Status
+	}
+	if statuses["birth_certificate"] != data.ChecklistMissing {
+		t.Errorf("expected a document without a file to leave the item missing, got %q", statuses["birth_certificate"])
+	}
+	if statuses["identification"] != data.ChecklistUploaded {
+		t.Errorf("expected the uploaded document to count, got %q", statuses["identification"])
+	}
+}
+
+// Application Handler Tests
+func TestCreateApplicationHandler(t *testing.T) {
 	app := newTestApp(t)
+	user := &data.User{ID: 1, RoleID: 3, RoleName: "Teacher", IsActive: true, IsActivated: true}
 
 	tests := []struct {
 		name           string
@@ -250,24 +762,1388 @@ func TestCreateAuthTokenHandler(t *testing.T) {
 		expectedStatus int
 	}{
 		{
-			name:           "Missing user_id",
-			payload:        `{"user_id": 0}`,
+			name:           "Missing teacher_id",
+			payload:        `{"teacher_id": 0, "license_type_id": 1}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Missing license_type_id",
+			payload:        `{"teacher_id": 1, "license_type_id": 0}`,
 			expectedStatus: http.StatusUnprocessableEntity,
 		},
+		{
+			name:           "Client cannot set status",
+			payload:        `{"teacher_id": 1, "license_type_id": 1, "status": "approved"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rr := executeRequest(t, app, "POST", "/v1/tokens/authentication", bytes.NewBufferString(tt.payload))
+			rr := executeHandlerRequest(t, app, user, "POST", "/v1/applications", "/v1/applications", app.createApplicationHandler, bytes.NewBufferString(tt.payload))
 			checkResponseCode(t, tt.expectedStatus, rr.Code)
 		})
 	}
+
+	t.Run("Anonymous user", func(t *testing.T) {
+		rr := executeRequest(t, app, "POST", "/v1/applications", bytes.NewBufferString(`{}`))
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
 }
 
-// Test 404 Not Found
-func TestNotFoundResponse(t *testing.T) {
+func TestCreateApplicationTransitionHandler(t *testing.T) {
 	app := newTestApp(t)
+	user := &data.User{ID: 2, RoleID: 2, RoleName: "DEC", IsActive: true, IsActivated: true}
 
-	rr := executeRequest(t, app, "GET", "/v1/nonexistent", nil)
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing action",
+			payload:        `{"comment": "looks good"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Unknown action",
+			payload:        `{"action": "fast_track"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Comment too long",
+			payload:        `{"action": "forward", "comment": "` + strings.Repeat("c", 1001) + `"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "POST", "/v1/applications/:id/transitions", "/v1/applications/1/transitions", app.createApplicationTransitionHandler, bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestApplicationWorkflow(t *testing.T) {
+	draft := data.ApplicationState{Status: data.ApplicationStatusDraft}
+	submitted := data.ApplicationState{Status: data.ApplicationStatusSubmitted}
+	decReview := data.ApplicationState{Status: data.ApplicationStatusUnderReview, Stage: data.ReviewStageDEC}
+	tscReview := data.ApplicationState{Status: data.ApplicationStatusUnderReview, Stage: data.ReviewStageTSC}
+	ceoReview := data.ApplicationState{Status: data.ApplicationStatusUnderReview, Stage: data.ReviewStageCEO}
+	approved := data.ApplicationState{Status: data.ApplicationStatusApproved}
+	rejected := data.ApplicationState{Status: data.ApplicationStatusRejected}
+	withdrawn := data.ApplicationState{Status: data.ApplicationStatusWithdrawn}
+
+	// The permissions migration 000032 grants each role
+	teacher := data.Permissions{data.PermissionApplicationsSubmit, data.PermissionApplicationsWithdraw}
+	dec := data.Permissions{data.PermissionApplicationsSubmit, data.PermissionApplicationsReviewDEC}
+	tsc := data.Permissions{data.PermissionApplicationsReviewTSC}
+	ceo := data.Permissions{data.PermissionApplicationsApprove}
+	admin := data.Permissions{data.PermissionApplicationsRead, data.PermissionTeachersManage, data.PermissionUsersManage}
+
+	tests := []struct {
+		name        string
+		from        data.ApplicationState
+		action      string
+		permissions data.Permissions
+		to          data.ApplicationState
+		err         error
+	}{
+		{name: "Teacher submits", from: draft, action: data.ApplicationActionSubmit, permissions: teacher, to: submitted},
+		{name: "DEC starts review", from: submitted, action: data.ApplicationActionStartReview, permissions: dec, to: decReview},
+		{name: "DEC forwards to TSC", from: decReview, action: data.ApplicationActionForward, permissions: dec, to: tscReview},
+		{name: "TSC forwards to CEO", from: tscReview, action: data.ApplicationActionForward, permissions: tsc, to: ceoReview},
+		{name: "CEO approves", from: ceoReview, action: data.ApplicationActionApprove, permissions: ceo, to: approved},
+		{name: "TSC rejects", from: tscReview, action: data.ApplicationActionReject, permissions: tsc, to: rejected},
+		{name: "CEO returns to draft", from: ceoReview, action: data.ApplicationActionReturn, permissions: ceo, to: draft},
+		{name: "Teacher withdraws during review", from: tscReview, action: data.ApplicationActionWithdraw, permissions: teacher, to: withdrawn},
+		{name: "Any role granted a stage can act on it", from: submitted, action: data.ApplicationActionStartReview, permissions: data.Permissions{data.PermissionApplicationsReviewDEC}, to: decReview},
+
+		{name: "DEC cannot skip to CEO approval", from: decReview, action: data.ApplicationActionApprove, permissions: dec, err: data.ErrInvalidTransition},
+		{name: "Approved applications are final", from: approved, action: data.ApplicationActionReturn, permissions: ceo, err: data.ErrInvalidTransition},
+		{name: "Withdrawn applications cannot be submitted", from: withdrawn, action: data.ApplicationActionSubmit, permissions: teacher, err: data.ErrInvalidTransition},
+		{name: "TSC cannot forward at the DEC stage", from: decReview, action: data.ApplicationActionForward, permissions: tsc, err: data.ErrTransitionNotPermitted},
+		{name: "Teacher cannot approve", from: ceoReview, action: data.ApplicationActionApprove, permissions: teacher, err: data.ErrTransitionNotPermitted},
+		{name: "Admin has no workflow permission", from: submitted, action: data.ApplicationActionStartReview, permissions: admin, err: data.ErrTransitionNotPermitted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to, err := data.NextApplicationState(tt.from, tt.action, tt.permissions)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v. Got %v", tt.err, err)
+			}
+			if to != tt.to {
+				t.Errorf("Expected state %+v. Got %+v", tt.to, to)
+			}
+		})
+	}
+
+	actions := data.AvailableApplicationActions(ceoReview, ceo)
+	slices.Sort(actions)
+	if want := []string{data.ApplicationActionApprove, data.ApplicationActionReject, data.ApplicationActionReturn}; !slices.Equal(actions, want) {
+		t.Errorf("Expected CEO actions %v. Got %v", want, actions)
+	}
+	if actions := data.AvailableApplicationActions(approved, ceo); len(actions) != 0 {
+		t.Errorf("Expected no actions on an approved application. Got %v", actions)
+	}
+}
+
+// License Handler Tests
+func TestIssueLicenseHandler(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 5, RoleID: 5, RoleName: "CEO", IsActive: true, IsActivated: true}
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing application_id",
+			payload:        `{"level": "primary", "reason": "Approved by the CEO"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Invalid level",
+			payload:        `{"application_id": 1, "level": "tertiary", "reason": "Approved by the CEO"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Missing reason",
+			payload:        `{"application_id": 1, "level": "primary", "reason": "  "}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "POST", "/v1/licenses", "/v1/licenses", app.issueLicenseHandler, bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+
+	t.Run("Revoke requires a reason", func(t *testing.T) {
+		rr := executeHandlerRequest(t, app, user, "POST", "/v1/licenses/:id/revoke", "/v1/licenses/1/revoke", app.revokeLicenseHandler, bytes.NewBufferString(`{}`))
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestLicenseCertificate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := certificate.Render(buf, certificate.License{
+		Name:             "José Martínez",
+		LicenseNumber:    "CYO-2025-00042",
+		LicenseClass:     "full",
+		Level:            "primary",
+		IssueDate:        "1 September 2025",
+		ExpiryDate:       "1 September 2035",
+		VerifyURL:        "https://impart.example.bz/v1/verify/CYO-2025-00042",
+		VerificationCode: "payload.signature",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Errorf("expected a PDF document, got %q", buf.Bytes()[:8])
+	}
+}
+
+func TestLicenseOwnership(t *testing.T) {
+	app := newTestDBApp(t)
+	holder := createTestUser(t, app, data.RoleTeacher, "pa55word-holder")
+	other := createTestUser(t, app, data.RoleTeacher, "pa55word-other")
+	license := createTestLicense(t, app, createTestTeacher(t, app, holder))
+	createTestTeacher(t, app, other)
+
+	url := fmt.Sprintf("/v1/licenses/%d", license.ID)
+
+	rr := executeHandlerRequest(t, app, holder, "GET", "/v1/licenses/:id", url, app.getLicenseHandler, nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	// Another teacher can neither read the license nor print its certificate
+	rr = executeHandlerRequest(t, app, other, "GET", "/v1/licenses/:id", url, app.getLicenseHandler, nil)
+	checkResponseCode(t, http.StatusForbidden, rr.Code)
+
+	rr = executeHandlerRequest(t, app, other, "GET", "/v1/licenses/:id/certificate.pdf", url+"/certificate.pdf", app.getLicenseCertificateHandler, nil)
+	checkResponseCode(t, http.StatusForbidden, rr.Code)
+}
+
+func TestTeacherLicenseStatusFilter(t *testing.T) {
+	app := newTestDBApp(t)
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-lapsed")
+	teacher := createTestTeacher(t, app, user)
+	license := createTestLicense(t, app, teacher)
+
+	// The license lapsed without its status being updated
+	_, err := app.models.Users.DB.Exec(`
+		UPDATE licenses SET issue_date = CURRENT_DATE - 730, expiry_date = CURRENT_DATE - 1
+		WHERE license_id = $1`, license.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "teacher_id", SortSafelist: data.TeacherSortSafelist}
+	for status, want := range map[string]int{data.LicenseStatusExpired: 1, data.LicenseStatusActive: 0} {
+		criteria := data.TeacherCriteria{LicenseStatus: status, Search: user.Username}
+		teachers, _, err := app.models.Unscoped().Teachers.GetAll(criteria, filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(teachers) != want {
+			t.Errorf("Expected %d teachers with an %s license. Got %d", want, status, len(teachers))
+		}
+	}
+}
+
+func TestDeletedTeacherRecordsHidden(t *testing.T) {
+	app := newTestDBApp(t)
+	models := app.models.Unscoped()
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-deleted")
+	teacher := createTestTeacher(t, app, user)
+	license := createTestLicense(t, app, teacher)
+
+	url := "/v1/verify/" + license.LicenseNumber
+	rr := executeHandlerRequest(t, app, user, "GET", "/v1/verify/:license_number", url, app.verifyLicenseHandler, nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	// The license goes with its teacher
+	if err := models.Teachers.Delete(teacher.ID); err != nil {
+		t.Fatal(err)
+	}
+	rr = executeHandlerRequest(t, app, user, "GET", "/v1/verify/:license_number", url, app.verifyLicenseHandler, nil)
 	checkResponseCode(t, http.StatusNotFound, rr.Code)
+	if _, err := models.Licenses.Get(license.ID); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("Expected ErrRecordNotFound. Got %v", err)
+	}
+
+	// Deleting a user deletes their teacher profile, and restoring the user
+	// brings it back
+	other := createTestUser(t, app, data.RoleTeacher, "pa55word-linked")
+	linked := createTestTeacher(t, app, other)
+	if err := models.Users.Delete(int(other.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Teachers.Get(linked.ID); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Errorf("Expected the teacher to be deleted with the user. Got %v", err)
+	}
+	if err := models.Users.Restore(int(other.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.Teachers.Get(linked.ID); err != nil {
+		t.Errorf("Expected the teacher to be restored with the user. Got %v", err)
+	}
+}
+
+// License Verification Tests
+func TestVerifyLicenseHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	t.Run("Malformed license number", func(t *testing.T) {
+		rr := executeRequest(t, app, "GET", "/v1/verify/not-a-license", nil)
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Stricter rate limit", func(t *testing.T) {
+		limited := newTestApp(t)
+		limited.config.limiter.enabled = true
+		limited.config.limiter.rps = 100
+		limited.config.limiter.burst = 100
+		limited.config.limiter.verifyRPS = 0.001
+		limited.config.limiter.verifyBurst = 1
+
+		handler := limited.routes()
+		codes := []int{}
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("GET", "/v1/verify/not-a-license", nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			codes = append(codes, rr.Code)
+		}
+		checkResponseCode(t, http.StatusNotFound, codes[0])
+		checkResponseCode(t, http.StatusTooManyRequests, codes[1])
+	})
+
+	t.Run("Verification code detects tampering", func(t *testing.T) {
+		s, err := signer.New("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		license := &data.LicenseVerification{LicenseNumber: "CYO-2025-00042", Name: "Jane Doe", LicenseClass: "full", Level: "primary"}
+		code := s.Encode(license.SigningPayload())
+		if !s.Matches(code, license.SigningPayload()) {
+			t.Error("expected code to match the license it was signed for")
+		}
+
+		license.LicenseClass = "trained"
+		if s.Matches(code, license.SigningPayload()) {
+			t.Error("expected code not to match a modified license")
+		}
+
+		// Pair the modified payload with the original signature
+		forgedPayload, _, _ := strings.Cut(s.Encode(license.SigningPayload()), ".")
+		_, signature, _ := strings.Cut(code, ".")
+		if _, err := s.Decode(forgedPayload + "." + signature); err == nil {
+			t.Error("expected a forged code to be rejected")
+		}
+	})
+
+	t.Run("Only active licenses are signed", func(t *testing.T) {
+		for _, status := range []string{data.LicenseStatusExpired, data.LicenseStatusSuspended, data.LicenseStatusRevoked} {
+			license := &data.LicenseVerification{LicenseNumber: "CYO-2025-00042", Status: status}
+			if license.Signed() {
+				t.Errorf("expected a %s license not to be signed", status)
+			}
+		}
+		license := &data.LicenseVerification{LicenseNumber: "CYO-2025-00042", Status: data.LicenseStatusActive}
+		if !license.Signed() {
+			t.Error("expected an active license to be signed")
+		}
+	})
+}
+
+// Notification Handler Tests
+func TestCreateNotificationHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing user_id",
+			payload:        `{"user_id": 0, "message": "test"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Missing message",
+			payload:        `{"user_id": 1, "message": ""}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeRequest(t, app, "POST", "/v1/notifications", bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+// Token Handler Tests
+func TestCreateAuthTokenHandler(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing user_id",
+			payload:        `{"user_id": 0}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeRequest(t, app, "POST", "/v1/tokens/authentication", bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestRolePermissionHandlers(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	permissions := data.Permissions{data.PermissionTeachersCreate, data.PermissionLicensesIssue}
+	if !permissions.Include(data.PermissionLicensesIssue) {
+		t.Errorf("Expected permissions to include %s", data.PermissionLicensesIssue)
+	}
+	if permissions.Include(data.PermissionDocumentsVerify) {
+		t.Errorf("Expected permissions not to include %s", data.PermissionDocumentsVerify)
+	}
+
+	rr := executeRequest(t, app, "PUT", "/v1/roles/1/permissions", bytes.NewBufferString(`{"permissions": []}`))
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	tests := []struct {
+		name           string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Missing permissions",
+			payload:        `{}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Duplicate permissions",
+			payload:        `{"permissions": ["teachers:create", "teachers:create"]}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Invalid JSON",
+			payload:        `{"permissions": "teachers:create"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "PUT", "/v1/roles/:id/permissions", "/v1/roles/1/permissions", app.updateRolePermissionsHandler, bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestRecordOwnership(t *testing.T) {
+	tests := []struct {
+		name      string
+		owner     recordOwner
+		teacherID int
+		expected  bool
+	}{
+		{
+			name:      "Staff can act on any teacher",
+			owner:     recordOwner{staff: true},
+			teacherID: 7,
+			expected:  true,
+		},
+		{
+			name:      "Teacher can act on their own records",
+			owner:     recordOwner{teacherID: 7},
+			teacherID: 7,
+			expected:  true,
+		},
+		{
+			name:      "Teacher cannot act on another teacher's records",
+			owner:     recordOwner{teacherID: 7},
+			teacherID: 8,
+			expected:  false,
+		},
+		{
+			name:      "User without a teacher profile owns nothing",
+			owner:     recordOwner{},
+			teacherID: 0,
+			expected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.owner.owns(tt.teacherID); got != tt.expected {
+				t.Errorf("Expected owns(%d) to be %v. Got %v", tt.teacherID, tt.expected, got)
+			}
+		})
+	}
+
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleTeacher}
+
+	// Malformed ids are rejected before ownership is looked up
+	rr := executeHandlerRequest(t, app, user, "DELETE", "/v1/education/:id", "/v1/education/abc", app.deleteEducationHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "DELETE", "/v1/qualifications/:id", "/v1/qualifications/abc", app.deleteQualificationHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "DELETE", "/v1/documents/:id", "/v1/documents/abc", app.deleteDocumentHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "POST", "/v1/qualifications", "/v1/qualifications", app.createQualificationHandler, bytes.NewBufferString(`{"teacher_id": 0}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestReferenceDataHandlers(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(v *validator.Validator)
+		errors   []string
+	}{
+		{
+			name:     "District without a name",
+			validate: func(v *validator.Validator) { data.ValidateDistrict(v, &data.District{}) },
+			errors:   []string{"name"},
+		},
+		{
+			name: "Institution name too long",
+			validate: func(v *validator.Validator) {
+				data.ValidateInstitution(v, &data.Institution{Name: strings.Repeat("a", 201)})
+			},
+			errors: []string{"name"},
+		},
+		{
+			name:     "Education without an institution",
+			validate: func(v *validator.Validator) { data.ValidateEducation(v, &data.Education{TeacherID: 1}) },
+			errors:   []string{"institution"},
+		},
+		{
+			name: "Qualification with a negative year",
+			validate: func(v *validator.Validator) {
+				data.ValidateQualification(v, &data.Qualification{TeacherID: 1, YearObtained: -1})
+			},
+			errors: []string{"year_obtained"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			tt.validate(v)
+			if len(v.Errors) != len(tt.errors) {
+				t.Errorf("Expected %d errors. Got %v", len(tt.errors), v.Errors)
+			}
+			for _, key := range tt.errors {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("Expected an error for %s. Got %v", key, v.Errors)
+				}
+			}
+		})
+	}
+
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	rr := executeHandlerRequest(t, app, user, "GET", "/v1/districts", "/v1/districts?sort=region_name", app.getAllDistrictsHandler, nil)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "GET", "/v1/institutions", "/v1/institutions?district_id=x&page_size=0", app.getAllInstitutionsHandler, nil)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	for _, route := range []struct {
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"/v1/districts/:id", app.updateDistrictHandler},
+		{"/v1/institutions/:id", app.updateInstitutionHandler},
+		{"/v1/education/:id", app.updateEducationHandler},
+		{"/v1/qualifications/:id", app.updateQualificationHandler},
+	} {
+		rr = executeHandlerRequest(t, app, user, "PATCH", route.pattern, strings.Replace(route.pattern, ":id", "abc", 1), route.handler, bytes.NewBufferString(`{}`))
+		checkResponseCode(t, http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestListTeachersHandler(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "Unknown sort", url: "/v1/teachers?sort=course_id"},
+		{name: "Unknown license status", url: "/v1/teachers?license_status=pending"},
+		{name: "Page out of range", url: "/v1/teachers?page=0"},
+		{name: "Page size too large", url: "/v1/teachers?page_size=1000"},
+		{name: "Non-numeric district", url: "/v1/teachers?district_id=cayo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "GET", "/v1/teachers", tt.url, app.listTeachersHandler, nil)
+			checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		})
+	}
+
+	for _, sort := range []string{"last_name", "-last_name", "created_at", "-teacher_id"} {
+		if !slices.Contains(data.TeacherSortSafelist, sort) {
+			t.Errorf("Expected %q in the teacher sort safelist", sort)
+		}
+	}
+}
+
+func TestListUsersHandler(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "Column from another schema", url: "/v1/users?sort=last_name"},
+		{name: "Unknown sort", url: "/v1/users?sort=password_hash"},
+		{name: "Invalid activation flag", url: "/v1/users?is_activated=maybe"},
+		{name: "Non-numeric role", url: "/v1/users?role_id=admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "GET", "/v1/users", tt.url, app.getAllUsersHandler, nil)
+			checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		})
+	}
+
+	// Sort values that skip handler validation are refused rather than panicking
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "region_id", SortSafelist: []string{"region_id"}}
+	_, _, err := app.models.Licenses.GetAll(0, "", "", filters)
+	if !errors.Is(err, data.ErrInvalidSort) {
+		t.Errorf("Expected ErrInvalidSort. Got %v", err)
+	}
+}
+
+func TestListAuditEventsHandler(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "Unknown entity type", url: "/v1/audit?entity_type=licence"},
+		{name: "Non-numeric actor", url: "/v1/audit?actor_id=admin"},
+		{name: "Malformed date", url: "/v1/audit?from=01/02/2026"},
+		{name: "Empty date range", url: "/v1/audit?from=2026-02-01&to=2026-01-01"},
+		{name: "Unknown sort", url: "/v1/audit?sort=before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "GET", "/v1/audit", tt.url, app.listAuditEventsHandler, nil)
+			checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		})
+	}
+
+	// Scoping the models must not lose the actor their changes are audited as
+	models := data.NewTestModels().WithActor(data.Actor{UserID: 7, IP: "192.0.2.1"}).WithDistrictScope(data.InDistricts(1))
+	if models.Teachers.Actor.UserID != 7 || models.Documents.Actor.IP != "192.0.2.1" {
+		t.Errorf("Expected the actor to survive scoping. Got %+v", models.Teachers.Actor)
+	}
+}
+
+func TestDeletedRecordsHandlers(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	lists := []struct {
+		name string
+		url  string
+	}{
+		{name: "Missing entity type", url: "/v1/deleted"},
+		{name: "Unknown entity type", url: "/v1/deleted?entity_type=role"},
+		{name: "Unknown sort", url: "/v1/deleted?entity_type=user&sort=label"},
+	}
+
+	for _, tt := range lists {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeHandlerRequest(t, app, user, "GET", "/v1/deleted", tt.url, app.listDeletedHandler, nil)
+			checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+		})
+	}
+
+	// Only users, teachers and documents are soft deleted
+	rr := executeHandlerRequest(t, app, user, "POST", "/v1/deleted/:entity_type/:id/restore", "/v1/deleted/role/1/restore", app.restoreDeletedHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "DELETE", "/v1/deleted/:entity_type/:id", "/v1/deleted/teacher/abc", app.purgeDeletedHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAuditEventHash(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	event := data.AuditEvent{
+		ActorID:    1,
+		EntityType: data.AuditEntityTeacher,
+		EntityID:   42,
+		Action:     data.AuditActionUpdate,
+		Before:     json.RawMessage(`{"phone": "610-0000"}`),
+		After:      json.RawMessage(`{"phone": "610-1111"}`),
+		CreatedAt:  created,
+	}
+	hash := event.ComputeHash()
+
+	// The same moment read back in another time zone hashes the same
+	event.CreatedAt = created.In(time.FixedZone("CST", -6*60*60))
+	if event.ComputeHash() != hash {
+		t.Errorf("Expected the hash not to depend on the time zone")
+	}
+
+	edits := map[string]func(e *data.AuditEvent){
+		"previous hash": func(e *data.AuditEvent) { e.PrevHash = hash },
+		"actor":         func(e *data.AuditEvent) { e.ActorID = 2 },
+		"after":         func(e *data.AuditEvent) { e.After = json.RawMessage(`{"phone": "610-2222"}`) },
+		"created at":    func(e *data.AuditEvent) { e.CreatedAt = created.Add(time.Second) },
+	}
+	for name, edit := range edits {
+		t.Run(name, func(t *testing.T) {
+			edited := event
+			edit(&edited)
+			if edited.ComputeHash() == hash {
+				t.Errorf("Expected editing the %s to change the hash", name)
+			}
+		})
+	}
+}
+
+func TestFieldEncryption(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	indexKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32))
+
+	oldRing, err := encryption.New("k1:"+oldKey, indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := oldRing.Encrypt("teachers.ssn", "000-123-456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "123") || !strings.HasPrefix(sealed, "k1:") {
+		t.Errorf("Expected ciphertext sealed with k1. Got %q", sealed)
+	}
+
+	// After rotation new values use k2 and old ones stay readable
+	ring, err := encryption.New("k2:"+newKey+",k1:"+oldKey, indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ring.Decrypt("teachers.ssn", sealed)
+	if err != nil || plaintext != "000-123-456" {
+		t.Errorf("Expected the old value to decrypt. Got %q, %v", plaintext, err)
+	}
+	resealed, _ := ring.Encrypt("teachers.ssn", plaintext)
+	if !strings.HasPrefix(resealed, "k2:") {
+		t.Errorf("Expected new values sealed with k2. Got %q", resealed)
+	}
+
+	// A value copied into another column does not decrypt
+	if _, err := ring.Decrypt("teachers.address", sealed); !errors.Is(err, encryption.ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt. Got %v", err)
+	}
+
+	// Blind indexes ignore formatting and survive key rotation
+	if ring.BlindIndex("teachers.ssn", "000-123-456") != oldRing.BlindIndex("teachers.ssn", "000 123456") {
+		t.Errorf("Expected matching blind indexes")
+	}
+
+	if _, err := encryption.New("k1:"+base64.StdEncoding.EncodeToString([]byte("short")), indexKey); err == nil {
+		t.Errorf("Expected a short key to be refused")
+	}
+}
+
+func TestTeacherFieldsBoundToTeacher(t *testing.T) {
+	app := newTestDBApp(t)
+	teachers := app.models.Unscoped().Teachers
+
+	holder := createTestTeacher(t, app, createTestUser(t, app, data.RoleTeacher, "pa55word-holder"))
+	other := createTestTeacher(t, app, createTestUser(t, app, data.RoleTeacher, "pa55word-other"))
+
+	holder.SSN = fmt.Sprintf("%09d", time.Now().UnixNano()%1e9)
+	if err := teachers.Update(holder); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := teachers.Get(holder.ID)
+	if err != nil || stored.SSN != holder.SSN {
+		t.Fatalf("Expected the SSN to read back. Got %q, %v", stored.SSN, err)
+	}
+
+	// A sealed value copied to another teacher does not decrypt
+	_, err = app.models.Users.DB.Exec(`
+		UPDATE teachers SET ssn_encrypted = (SELECT ssn_encrypted FROM teachers WHERE teacher_id = $1)
+		WHERE teacher_id = $2`, holder.ID, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := teachers.Get(other.ID); !errors.Is(err, encryption.ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt. Got %v", err)
+	}
+
+	// Leave nothing behind that other tests listing teachers cannot read
+	_, err = app.models.Users.DB.Exec(`UPDATE teachers SET ssn_encrypted = NULL WHERE teacher_id = $1`, other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireResealed(t *testing.T) {
+	app := newTestDBApp(t)
+	teacher := createTestTeacher(t, app, createTestUser(t, app, data.RoleTeacher, "pa55word-legacy"))
+
+	// A row written before encryption keeps its address in plaintext
+	_, err := app.models.Users.DB.Exec(`UPDATE teachers SET address = '1 Legacy St', address_encrypted = NULL WHERE teacher_id = $1`, teacher.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := requireResealed(app.models); err == nil {
+		t.Error("expected the API to refuse to start while plaintext remains")
+	}
+
+	for {
+		n, err := app.models.Teachers.Reseal(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	for {
+		n, err := app.models.TwoFactor.Reseal(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if err := requireResealed(app.models); err != nil {
+		t.Errorf("expected the API to start once rekey has run. Got %v", err)
+	}
+
+	stored, err := app.models.Unscoped().Teachers.Get(teacher.ID)
+	if err != nil || stored.Address != "1 Legacy St" {
+		t.Errorf("expected the resealed address to read back. Got %+v, %v", stored, err)
+	}
+}
+
+func TestTeacherViews(t *testing.T) {
+	dob := time.Date(1990, 5, 1, 0, 0, 0, 0, time.UTC)
+	profile := data.Teacher{
+		ID: 7, UserID: 3, FirstName: "Jane", LastName: "Doe", Gender: "F", DOB: &dob, SSN: "000-123-456",
+		MaritalStatus: "single", Email: "jdoe@example.com", Address: "1 Main St", DistrictID: 2,
+		Phone: "610-0000", ProfileStatus: "active", Version: 4,
+	}
+
+	tests := []struct {
+		name    string
+		viewer  teacherViewer
+		ssn     string
+		dob     bool
+		address string
+		phone   string
+	}{
+		{name: "Sensitive fields permission", viewer: teacherViewer{readPII: true}, ssn: "000-123-456", dob: true, address: "1 Main St", phone: "610-0000"},
+		{name: "Owner", viewer: teacherViewer{teacherID: 7}, ssn: "***-***-456", dob: true, address: "1 Main St", phone: "610-0000"},
+		{name: "Staff", viewer: teacherViewer{staff: true}, ssn: "***-***-456", phone: "610-0000"},
+		{name: "Another teacher", viewer: teacherViewer{teacherID: 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			teacher := tt.viewer.present(&profile)
+
+			if teacher.SSN != tt.ssn || (teacher.DOB != nil) != tt.dob || teacher.Address != tt.address || teacher.Phone != tt.phone {
+				t.Errorf("Unexpected view %+v", teacher)
+			}
+			if teacher.FirstName != "Jane" || teacher.Email != "jdoe@example.com" || teacher.DistrictID != 2 {
+				t.Errorf("Expected the directory fields to be kept. Got %+v", teacher)
+			}
+		})
+	}
+
+	if profile.SSN != "000-123-456" || profile.Address != "1 Main St" {
+		t.Errorf("Expected presenting a view to leave the teacher unchanged. Got %+v", profile)
+	}
+
+	// A teacher written out without a view gives nothing away
+	raw, err := json.Marshal(profile)
+	if err != nil || string(raw) != "{}" {
+		t.Errorf("Expected a teacher to have no JSON encoding. Got %s, %v", raw, err)
+	}
+
+	if masked := data.MaskSSN("12"); masked != "**" {
+		t.Errorf("Expected short SSNs to be fully masked. Got %q", masked)
+	}
+}
+
+func TestUpdateTeacherHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		teacher data.Teacher
+		errors  []string
+	}{
+		{
+			name:    "Valid teacher",
+			teacher: data.Teacher{FirstName: "Jane", LastName: "Doe", Email: "jdoe@example.com"},
+		},
+		{
+			name:    "Missing names and email",
+			teacher: data.Teacher{},
+			errors:  []string{"first_name", "last_name", "email"},
+		},
+		{
+			name:    "SSN too long",
+			teacher: data.Teacher{FirstName: "Jane", LastName: "Doe", Email: "jdoe@example.com", SSN: "0000000000000000"},
+			errors:  []string{"ssn"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			data.ValidateTeacher(v, &tt.teacher)
+			if len(v.Errors) != len(tt.errors) {
+				t.Errorf("Expected %d errors. Got %v", len(tt.errors), v.Errors)
+			}
+			for _, key := range tt.errors {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("Expected an error for %s. Got %v", key, v.Errors)
+				}
+			}
+		})
+	}
+
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleTeacher}
+
+	rr := executeHandlerRequest(t, app, user, "PATCH", "/v1/teachers/:id", "/v1/teachers/abc", app.updateTeacherHandler, bytes.NewBufferString(`{"phone": "610-0000"}`))
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+
+	// user_id cannot be reassigned through an update
+	rr = executeHandlerRequest(t, app, user, "PATCH", "/v1/teachers/:id", "/v1/teachers/1", app.updateTeacherHandler, bytes.NewBufferString(`{"user_id": 2}`))
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMeHandlers(t *testing.T) {
+	// The caller's teacher replaces any teacher_id the client sent
+	req := httptest.NewRequest("GET", "/v1/me/applications?teacher_id=8&status=draft", nil)
+	qs := withTeacherQuery(req, 7).URL.Query()
+	if qs.Get("teacher_id") != "7" || qs.Get("status") != "draft" {
+		t.Errorf("Expected teacher_id=7 and status=draft. Got %q", qs.Encode())
+	}
+	if req.URL.Query().Get("teacher_id") != "8" {
+		t.Error("Expected the original request to be left unchanged")
+	}
+
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleTeacher}
+
+	// Role and activation are not self-service fields
+	rr := executeHandlerRequest(t, app, user, "PATCH", "/v1/me", "/v1/me", app.updateMeHandler, bytes.NewBufferString(`{"role_id": 1}`))
+	checkResponseCode(t, http.StatusBadRequest, rr.Code)
+
+	// Users cannot skip the current password by changing their own
+	// credentials through the user endpoint
+	for _, body := range []string{`{"password": "pa55word-taken"}`, `{"email": "taken@example.com"}`} {
+		rr = executeHandlerRequest(t, app, user, "PATCH", "/v1/users/:id", "/v1/users/1", app.updateUserHandler, bytes.NewBufferString(body))
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestUpdateOtherUserCredentials(t *testing.T) {
+	app := newTestApp(t)
+	dec := &data.User{ID: 2, IsActive: true, IsActivated: true, RoleName: data.RoleDEC}
+
+	// Staff without users:manage cannot move another account's email, and
+	// nobody can set another user's password
+	for _, body := range []string{`{"email": "taken@example.com"}`, `{"password": "pa55word-taken"}`} {
+		req := httptest.NewRequest("PATCH", "/v1/users/1", bytes.NewBufferString(body))
+		req = app.contextSetUser(req, dec)
+		req = app.contextSetPermissions(req, data.Permissions{data.PermissionUsersUpdate})
+
+		router := httprouter.New()
+		router.HandlerFunc("PATCH", "/v1/users/:id", app.updateUserHandler)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	}
+}
+
+func TestUpdateMeHandler(t *testing.T) {
+	app := newTestDBApp(t)
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-current")
+
+	current, err := app.models.Tokens.NewSession(user.ID, sessionTTL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := app.models.Tokens.NewSession(user.ID, sessionTTL, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	updateMe := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/v1/me", bytes.NewBufferString(body))
+		req = app.contextSetUser(req, user)
+		req = app.contextSetToken(req, current.Plaintext)
+		rr := httptest.NewRecorder()
+		app.updateMeHandler(rr, req)
+		return rr
+	}
+
+	// Changing the email needs the current password
+	rr := updateMe(`{"email": "changed-` + user.Email + `"}`)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+	rr = updateMe(`{"email": "changed-` + user.Email + `", "current_password": "wrong-password"}`)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	// A new password ends every session but the current one
+	rr = updateMe(`{"password": "pa55word-changed", "current_password": "pa55word-current"}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	sessions, err := app.models.Tokens.GetSessions(user.ID, current.Plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("Expected only the current session to remain. Got %d sessions", len(sessions))
+	}
+
+	// A new email has to be activated again
+	rr = updateMe(`{"email": "changed-` + user.Email + `", "current_password": "pa55word-changed"}`)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	changed, err := app.models.Users.Get(int(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.IsActivated {
+		t.Error("Expected the user to need activating after changing their email")
+	}
+	app.wg.Wait()
+}
+
+func TestDistrictScope(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleDEC}
+
+	if scope := (data.DistrictScope{}); !scope.Restricted() || scope.Allows(3) {
+		t.Error("Expected the zero scope to allow nothing")
+	}
+	if scope := data.AllDistricts(); scope.Restricted() || !scope.Allows(3) {
+		t.Error("Expected AllDistricts to be unrestricted")
+	}
+	scope := data.InDistricts(4)
+	if !scope.Allows(4) || scope.Allows(3) {
+		t.Error("Expected the scope to allow only district 4")
+	}
+	if data.InDistricts().Allows(4) {
+		t.Error("Expected a scope with no districts to allow nothing")
+	}
+
+	// A DEC officer for Cayo cannot create a teacher in Belize
+	req := httptest.NewRequest("POST", "/v1/teachers", bytes.NewBufferString(`{"first_name": "Jane", "last_name": "Doe", "email": "jdoe@example.com", "district_id": 3}`))
+	req = app.contextSetUser(req, user)
+	req = app.contextSetDistrictScope(req, scope)
+	rr := httptest.NewRecorder()
+	app.createTeacherHandler(rr, req)
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "PATCH", "/v1/users/:id/districts", "/v1/users/1/districts", app.updateUserDistrictsHandler, bytes.NewBufferString(`{"district_ids": [4, 4]}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeRequest(t, app, "GET", "/v1/users/1/districts", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleTeacher}
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		lockout  data.Lockout
+		expected time.Duration
+	}{
+		{
+			name:     "No failures",
+			lockout:  data.Lockout{},
+			expected: 0,
+		},
+		{
+			name:     "One recent failure",
+			lockout:  data.Lockout{FailedAttempts: 1, LastFailedAt: &now},
+			expected: time.Second,
+		},
+		{
+			name:     "Delay doubles",
+			lockout:  data.Lockout{FailedAttempts: 3, LastFailedAt: &now},
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "Delay is capped",
+			lockout:  data.Lockout{FailedAttempts: 50, LastFailedAt: &now},
+			expected: 30 * time.Second,
+		},
+		{
+			name:     "Locked",
+			lockout:  data.Lockout{LockedUntil: ptrTime(now.Add(10 * time.Minute))},
+			expected: 10 * time.Minute,
+		},
+		{
+			name:     "Lock expired",
+			lockout:  data.Lockout{LockedUntil: ptrTime(now.Add(-time.Minute))},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lockout.RetryAfter(now); got != tt.expected {
+				t.Errorf("Expected retry after %v. Got %v", tt.expected, got)
+			}
+		})
+	}
+
+	rr := executeRequest(t, app, "POST", "/v1/users/1/unlock", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "POST", "/v1/users/:id/unlock", "/v1/users/abc/unlock", app.unlockUserHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAccountEventsHandler(t *testing.T) {
+	app := newTestApp(t)
+	admin := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	rr := executeRequest(t, app, "GET", "/v1/users/1/account-events", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	rr = executeHandlerRequest(t, app, admin, "GET", "/v1/users/:id/account-events", "/v1/users/abc/account-events", app.getAccountEventsHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+func TestLoginLockoutFlow(t *testing.T) {
+	app := newTestDBApp(t)
+	app.config.lockout.threshold = 1
+	app.config.lockout.duration = 15 * time.Minute
+
+	admin := createTestUser(t, app, data.RoleAdmin, "pa55word-admin")
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-right")
+
+	login := func(password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"email": %q, "password": %q}`, user.Email, password)
+		return executeRequest(t, app, "POST", "/v1/tokens/authentication", bytes.NewBufferString(body))
+	}
+	eventsURL := fmt.Sprintf("/v1/users/%d/account-events", user.ID)
+
+	// One wrong password reaches the threshold and locks the account
+	rr := login("pa55word-wrong")
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	// While locked, even the right password is turned away
+	rr = login("pa55word-right")
+	checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	rr = executeHandlerRequest(t, app, admin, "GET", "/v1/users/:id/account-events", eventsURL, app.getAccountEventsHandler, nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+	var response struct {
+		Lockout data.Lockout        `json:"lockout"`
+		Events  []data.AccountEvent `json:"events"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Lockout.LockedUntil == nil {
+		t.Error("expected the account to be locked")
+	}
+	if len(response.Events) == 0 || response.Events[0].Action != data.AccountActionLocked {
+		t.Errorf("expected a locked event, got %+v", response.Events)
+	}
+
+	// The lock is in the audit trail too
+	criteria := data.AuditCriteria{EntityType: data.AuditEntityUser, EntityID: user.ID}
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-audit_event_id", SortSafelist: data.AuditSortSafelist}
+	audits, _, err := app.models.Audit.GetAll(criteria, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) == 0 || audits[0].Action != data.AuditActionLock {
+		t.Errorf("expected a lock audit event, got %+v", audits)
+	}
+
+	// Once unlocked the right password logs in again
+	rr = executeHandlerRequest(t, app, admin, "POST", "/v1/users/:id/unlock", fmt.Sprintf("/v1/users/%d/unlock", user.ID), app.unlockUserHandler, nil)
+	checkResponseCode(t, http.StatusOK, rr.Code)
+
+	rr = login("pa55word-right")
+	checkResponseCode(t, http.StatusCreated, rr.Code)
+}
+
+func TestLoginLockoutConcurrent(t *testing.T) {
+	app := newTestDBApp(t)
+	app.config.lockout.threshold = 5
+	app.config.lockout.duration = 15 * time.Minute
+
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-right")
+	body := fmt.Sprintf(`{"email": %q, "password": "pa55word-wrong"}`, user.Email)
+
+	// Parallel guesses all arrive before any has failed; only one of them
+	// may be checked, the rest wait out the delay
+	const attempts = 10
+	codes := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := executeRequest(t, app, "POST", "/v1/tokens/authentication", bytes.NewBufferString(body))
+			codes[i] = rr.Code
+		}()
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if checked != 1 {
+		t.Errorf("expected one attempt to be checked, got %d of %v", checked, codes)
+	}
+
+	lockout, err := app.models.Users.GetLockout(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.FailedAttempts != 1 {
+		t.Errorf("expected one failed attempt, got %d", lockout.FailedAttempts)
+	}
+}
+
+func ptrTime(t time.Time) *time.Time {
+	return &t
+}
+
+// Test 404 Not Found
+func TestNotFoundResponse(t *testing.T) {
+	app := newTestApp(t)
+
+	rr := executeRequest(t, app, "GET", "/v1/nonexistent", nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+// Password Reset Handler Tests
+func TestPasswordResetHandlers(t *testing.T) {
+	app := newTestApp(t)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		payload        string
+		expectedStatus int
+	}{
+		{
+			name:           "Reset token for invalid email",
+			method:         "POST",
+			url:            "/v1/tokens/password-reset",
+			payload:        `{"email": "not-an-email"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "New password too short",
+			method:         "PUT",
+			url:            "/v1/users/password",
+			payload:        `{"password": "short", "token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "Malformed reset token",
+			method:         "PUT",
+			url:            "/v1/users/password",
+			payload:        `{"password": "correct horse battery", "token": "abc"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := executeRequest(t, app, tt.method, tt.url, bytes.NewBufferString(tt.payload))
+			checkResponseCode(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+// Session Handler Tests
+func TestSessionHandlers(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleTeacher}
+
+	// Logging out requires a token
+	rr := executeRequest(t, app, "DELETE", "/v1/tokens/authentication", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	rr = executeRequest(t, app, "GET", "/v1/me/sessions", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "DELETE", "/v1/me/sessions/:id", "/v1/me/sessions/abc", app.deleteSessionHandler, nil)
+	checkResponseCode(t, http.StatusNotFound, rr.Code)
+}
+
+// Two-Factor Handler Tests
+func TestTwoFactorHandlers(t *testing.T) {
+	app := newTestApp(t)
+	user := &data.User{ID: 1, IsActivated: true, RoleName: data.RoleAdmin}
+
+	// RFC 6238 test vector, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	step, ok := totp.Validate(secret, "287082", time.Unix(59, 0))
+	if !ok || step != 1 {
+		t.Errorf("Expected code to be valid for step 1. Got %d, %v", step, ok)
+	}
+	if _, ok := totp.Validate(secret, "287082", time.Unix(59+10*totp.Period, 0)); ok {
+		t.Error("Expected code to be rejected outside the time window")
+	}
+
+	rr := executeRequest(t, app, "POST", "/v1/tokens/two-factor", bytes.NewBufferString(`{"token": "abc", "code": ""}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeHandlerRequest(t, app, user, "PUT", "/v1/me/two-factor", "/v1/me/two-factor", app.confirmTwoFactorHandler, bytes.NewBufferString(`{"code": ""}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeRequest(t, app, "POST", "/v1/me/two-factor", nil)
+	checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+	// Enrolling without a session needs an emailed enrolment token
+	rr = executeRequest(t, app, "POST", "/v1/tokens/two-factor-enrolment", bytes.NewBufferString(`{"token": "abc"}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = executeRequest(t, app, "PUT", "/v1/tokens/two-factor-enrolment", bytes.NewBufferString(`{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "code": ""}`))
+	checkResponseCode(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestTwoFactorSecretIsSealed(t *testing.T) {
+	app := newTestDBApp(t)
+	user := createTestUser(t, app, data.RoleTeacher, "pa55word-totp")
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.TwoFactor.SetSecret(user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+
+	var plaintext sql.NullString
+	var sealed string
+	err = app.models.Users.DB.QueryRow(`SELECT secret, secret_encrypted FROM user_two_factor WHERE user_id = $1`, user.ID).Scan(&plaintext, &sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext.Valid || strings.Contains(sealed, secret) {
+		t.Error("expected the secret to be stored sealed only")
+	}
+
+	tf, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.Secret != secret {
+		t.Error("expected the sealed secret to open to the original")
+	}
+
+	// A sealed secret copied to another user does not open
+	other := createTestUser(t, app, data.RoleTeacher, "pa55word-totp")
+	_, err = app.models.Users.DB.Exec(`INSERT INTO user_two_factor (user_id, secret_encrypted) VALUES ($1, $2)`, other.ID, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		app.models.Users.DB.Exec(`DELETE FROM user_two_factor WHERE user_id = $1`, other.ID)
+	})
+	if _, err := app.models.TwoFactor.Get(other.ID); err == nil {
+		t.Error("expected a secret sealed for another user to be rejected")
+	}
 }
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/data"
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
@@ -159,6 +161,62 @@ func (a *app)getSingleIntegerParameter(
    return intValue
 }
 
+// readFilters reads the page, page_size and sort query parameters for a
+// listing with the given default sort and safelist
+func (a *app) readFilters(queryParameters url.Values, defaultSort string, safelist []string, v *validator.Validator) data.Filters {
+	return data.Filters{
+		Page:         a.getSingleIntegerParameter(queryParameters, "page", 1, v),
+		PageSize:     a.getSingleIntegerParameter(queryParameters, "page_size", 20, v),
+		Sort:         a.getSingleQueryParameter(queryParameters, "sort", defaultSort),
+		SortSafelist: safelist,
+	}
+}
+
+// getOptionalBoolParameter returns nil when the parameter is absent, so
+// callers can tell "not filtered" apart from false
+func (a *app) getOptionalBoolParameter(queryParameters url.Values, key string, v *validator.Validator) *bool {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return nil
+	}
+
+	return &boolValue
+}
+
+// getOptionalTimeParameter reads an RFC 3339 timestamp or a YYYY-MM-DD
+// date, which is taken as midnight UTC. It returns nil when the parameter
+// is absent.
+func (a *app) getOptionalTimeParameter(queryParameters url.Values, key string, v *validator.Validator) *time.Time {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, result); err == nil {
+			return &t
+		}
+	}
+
+	v.AddError(key, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	return nil
+}
+
+// clientIP returns the IP address the request came from
+func (a *app) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
 // Accept a function and run it in the background also recover from any panic
 func (a *app) background(fn func()) {
     a.wg.Add(1) // Use a wait group to ensure all goroutines finish before we exit
@@ -174,26 +232,115 @@ func (a *app) background(fn func()) {
    }()
 }
 
-// Check if the current user can access a specific user's data
-// Administrators and Content Contributors can access all users
-// System Users can only access their own data
-func (a *app) canAccessUserData(currentUser *data.User, targetUserID int64) (bool, error) {
-	// Get the role of the current user
-	role, err := a.models.Roles.Get(currentUser.RoleID)
+// Check if the current user can access a specific user's data. Users can
+// always access their own data; anyone else's needs the given permission.
+func (a *app) canAccessUserData(r *http.Request, targetUserID int64, code string) bool {
+	if a.contextGetUser(r).ID == targetUserID {
+		return true
+	}
+	return a.contextGetPermissions(r).Include(code)
+}
+
+// modelsFor returns the models limited to the districts the request's user
+// may see, with their changes audited as made by that user. Teachers,
+// documents and applications read through a.models see nothing, because
+// its scope is empty, so handlers must go through modelsFor; lookups that
+// must ignore the user's districts say so with a.models.Unscoped().
+func (a *app) modelsFor(r *http.Request) *data.Models {
+	return a.models.WithDistrictScope(a.contextGetDistrictScope(r)).WithActor(a.actorFor(r))
+}
+
+// actorFor identifies who is making the request, for the audit trail.
+// Anonymous requests are recorded with their IP address only.
+func (a *app) actorFor(r *http.Request) data.Actor {
+	actor := data.Actor{IP: a.clientIP(r)}
+	if user, ok := r.Context().Value(userContextKey).(*data.User); ok {
+		actor.UserID = user.ID
+	}
+	return actor
+}
+
+// districtScope works out which districts a user's queries are limited
+// to. Users whose role is district scoped see only the districts they are
+// assigned to, and nothing until they are assigned one; everyone else sees
+// every district.
+func (a *app) districtScope(user *data.User) (data.DistrictScope, error) {
+	role, err := a.models.Roles.Get(user.RoleID)
+	if err != nil {
+		// Without a role there is nothing to widen the empty scope
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return data.DistrictScope{}, nil
+		}
+		return data.DistrictScope{}, err
+	}
+	if !role.DistrictScoped {
+		return data.AllDistricts(), nil
+	}
+
+	districtIDs, err := a.models.Users.GetDistricts(user.ID)
 	if err != nil {
-		return false, err
+		return data.DistrictScope{}, err
 	}
-	
-	// Administrators and Content Contributors can access any user
-	if role.RoleName == "Admin" || role.RoleName == "CEO" || role.RoleName == "DEC" || role.RoleName == "TSC" {
-		return true, nil
+	return data.InDistricts(districtIDs...), nil
+}
+
+// recordOwner describes whose teacher records (education, qualifications,
+// documents and applications) a user may act on
+type recordOwner struct {
+	staff     bool
+	teacherID int
+}
+
+// owns reports whether the owner may act on the teacher's records
+func (o recordOwner) owns(teacherID int) bool {
+	return o.staff || (o.teacherID > 0 && o.teacherID == teacherID)
+}
+
+// recordOwnerFor works out whose records a user may act on. Users with the
+// teachers:manage permission are staff and may act on any teacher's
+// records; everyone else only on those of their own teacher profile.
+func (a *app) recordOwnerFor(r *http.Request) (recordOwner, error) {
+	if a.contextGetPermissions(r).Include(data.PermissionTeachersManage) {
+		return recordOwner{staff: true}, nil
 	}
-	
-	// System Users can only access their own data
-	if role.RoleName == "Teacher" {
-		return currentUser.ID == targetUserID, nil
+
+	teacher, err := a.models.Unscoped().Teachers.GetByUserID(int(a.contextGetUser(r).ID))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return recordOwner{}, nil
+		}
+		return recordOwner{}, err
+	}
+	return recordOwner{teacherID: teacher.ID}, nil
+}
+
+// requireTeacherOwner checks that the request's user may act on the
+// teacher's records. If not, it writes the response and returns false:
+// 403 for records the user does not own, or 404 when staff ask for a
+// teacher outside their districts.
+func (a *app) requireTeacherOwner(w http.ResponseWriter, r *http.Request, teacherID int) bool {
+	owner, err := a.recordOwnerFor(r)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !owner.owns(teacherID) {
+		a.notPermittedResponse(w, r)
+		return false
+	}
+
+	if owner.staff && a.contextGetDistrictScope(r).Restricted() {
+		_, err := a.modelsFor(r).Teachers.Get(teacherID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				a.notFoundResponse(w, r)
+			default:
+				a.serverErrorResponse(w, r, err)
+			}
+			return false
+		}
 	}
-	
-	// Default: deny access
-	return false, nil
+	return true
 }
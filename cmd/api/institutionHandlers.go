@@ -31,17 +31,20 @@ func (a *app) createInstitutionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v := validator.New()
-	v.Check(institution.Name != "", "name", "must be provided")
-	v.Check(len(institution.Name) <= 200, "name", "must not be more than 200 characters long")
-
-	if !v.IsEmpty() {
+	if data.ValidateInstitution(v, institution); !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	err = a.models.Institutions.Insert(institution)
 	if err != nil {
-		a.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "an institution with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -81,21 +84,100 @@ func (a *app) getInstitutionHandler(w http.ResponseWriter, r *http.Request) {
 
 // getAllInstitutionsHandler handles GET /v1/institutions
 func (a *app) getAllInstitutionsHandler(w http.ResponseWriter, r *http.Request) {
-	institutions, err := a.models.Institutions.GetAll()
+	var input struct {
+		Name            string
+		DistrictID      int
+		InstitutionType string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = a.getSingleQueryParameter(qs, "name", "")
+	input.DistrictID = a.getSingleIntegerParameter(qs, "district_id", 0, v)
+	input.InstitutionType = a.getSingleQueryParameter(qs, "institution_type", "")
+	input.Filters = a.readFilters(qs, "name", data.InstitutionSortSafelist, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	institutions, metadata, err := a.models.Institutions.GetAll(input.Name, input.DistrictID, input.InstitutionType, input.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	metadata := data.Metadata{
-		CurrentPage:  1,
-		PageSize:     len(institutions),
-		FirstPage:    1,
-		LastPage:     1,
-		TotalRecords: len(institutions),
+	err = a.writeJSON(w, http.StatusOK, envelope{"institutions": institutions, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
 	}
+}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"institutions": institutions, "metadata": metadata}, nil)
+// updateInstitutionHandler handles PATCH /v1/institutions/:id
+func (a *app) updateInstitutionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	institution, err := a.models.Institutions.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name            *string `json:"name"`
+		DistrictID      *int    `json:"district_id"`
+		InstitutionType *string `json:"institution_type"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		institution.Name = *input.Name
+	}
+	if input.DistrictID != nil {
+		institution.DistrictID = *input.DistrictID
+	}
+	if input.InstitutionType != nil {
+		institution.InstitutionType = *input.InstitutionType
+	}
+
+	v := validator.New()
+	if data.ValidateInstitution(v, institution); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.Institutions.Update(institution)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			v.AddError("name", "an institution with this name already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"institution": institution}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
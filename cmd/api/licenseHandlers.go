@@ -0,0 +1,362 @@
+// Filename: cmd/api/licenseHandlers.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/certificate"
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// issueLicenseHandler handles POST /v1/licenses
+func (a *app) issueLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ApplicationID int    `json:"application_id"`
+		Level         string `json:"level"`
+		Reason        string `json:"reason"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.ApplicationID > 0, "application_id", "must be provided")
+	v.Check(validator.PermittedValue(input.Level, data.LicenseLevels...), "level", "must be one of preschool, primary or secondary")
+	data.ValidateLicenseReason(v, input.Reason)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	application, err := a.modelsFor(r).Applications.Get(input.ApplicationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("application_id", "application does not exist")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if application.Status != data.ApplicationStatusApproved {
+		a.invalidTransitionResponse(w, r, errors.New("a license can only be issued for an approved application"))
+		return
+	}
+
+	licenseType, err := a.models.LicenseTypes.Get(application.LicenseTypeID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	teacher, err := a.modelsFor(r).Teachers.Get(application.TeacherID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The teacher's district prefixes the license number
+	if teacher.DistrictID < 1 {
+		v.AddError("application_id", "the teacher must be assigned to a district before a license can be issued")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	license := &data.License{
+		TeacherID:     teacher.ID,
+		ApplicationID: application.ID,
+		LicenseClass:  licenseType.LicenseClass,
+		Level:         input.Level,
+	}
+
+	user := a.contextGetUser(r)
+	event, err := a.models.Licenses.Issue(license, teacher.DistrictID, licenseType.ValidityYears, input.Reason, int(user.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateLicense):
+			a.invalidTransitionResponse(w, r, err)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/licenses/%d", license.ID))
+
+	err = a.writeJSON(w, http.StatusCreated, envelope{"license": license, "event": event}, headers)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getLicenseHandler handles GET /v1/licenses/:id
+func (a *app) getLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	license, err := a.modelsFor(r).Licenses.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, license.TeacherID) {
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"license": license}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listLicensesHandler handles GET /v1/licenses
+func (a *app) listLicensesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TeacherID    int
+		Status       string
+		LicenseClass string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.TeacherID = a.getSingleIntegerParameter(qs, "teacher_id", 0, v)
+	input.Status = a.getSingleQueryParameter(qs, "status", "")
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.LicenseStatuses...), "status", "invalid license status")
+	}
+	input.LicenseClass = a.getSingleQueryParameter(qs, "license_class", "")
+	if input.LicenseClass != "" {
+		v.Check(validator.PermittedValue(input.LicenseClass, data.LicenseClasses...), "license_class", "invalid license class")
+	}
+
+	input.Filters.Page = a.getSingleIntegerParameter(qs, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(qs, "page_size", 20, v)
+	input.Filters.Sort = a.getSingleQueryParameter(qs, "sort", "license_id")
+	input.Filters.SortSafelist = data.LicenseSortSafelist
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	licenses, metadata, err := a.modelsFor(r).Licenses.GetAll(input.TeacherID, input.Status, input.LicenseClass, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"licenses": licenses, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getLicenseEventsHandler handles GET /v1/licenses/:id/events
+func (a *app) getLicenseEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	license, err := a.modelsFor(r).Licenses.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	events, err := a.models.Licenses.GetEvents(license.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"events": events}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getLicenseCertificateHandler handles GET /v1/licenses/:id/certificate.pdf
+func (a *app) getLicenseCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	license, err := a.modelsFor(r).Licenses.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, license.TeacherID) {
+		return
+	}
+
+	// The public view carries the holder's name, the effective status and
+	// the fields the verification code is signed over
+	verification, err := a.models.Licenses.GetVerification(license.LicenseNumber)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !verification.Signed() {
+		a.invalidTransitionResponse(w, r, errors.New("a certificate can only be generated for an active license"))
+		return
+	}
+
+	cert := certificate.License{
+		Name:          verification.Name,
+		LicenseNumber: license.LicenseNumber,
+		LicenseClass:  license.LicenseClass,
+		Level:         license.Level,
+		IssueDate:     license.IssueDate.Format("2 January 2006"),
+		ExpiryDate:    license.ExpiryDate.Format("2 January 2006"),
+		VerifyURL:     strings.TrimSuffix(a.config.verify.publicURL, "/") + "/v1/verify/" + license.LicenseNumber,
+	}
+	if a.signer != nil {
+		cert.VerificationCode = a.signer.Encode(verification.SigningPayload())
+	}
+
+	buf := new(bytes.Buffer)
+	err = certificate.Render(buf, cert)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", license.LicenseNumber+".pdf"))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		a.logger.Error("unable to write certificate", "license_number", license.LicenseNumber, "error", err.Error())
+	}
+}
+
+// renewLicenseHandler handles POST /v1/licenses/:id/renew
+func (a *app) renewLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeLicenseStatus(w, r, data.LicenseActionRenew)
+}
+
+// suspendLicenseHandler handles POST /v1/licenses/:id/suspend
+func (a *app) suspendLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeLicenseStatus(w, r, data.LicenseActionSuspend)
+}
+
+// reinstateLicenseHandler handles POST /v1/licenses/:id/reinstate
+func (a *app) reinstateLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeLicenseStatus(w, r, data.LicenseActionReinstate)
+}
+
+// revokeLicenseHandler handles POST /v1/licenses/:id/revoke
+func (a *app) revokeLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeLicenseStatus(w, r, data.LicenseActionRevoke)
+}
+
+// changeLicenseStatus reads the reason from the request body and applies a
+// license action on behalf of the current user
+func (a *app) changeLicenseStatus(w http.ResponseWriter, r *http.Request, action string) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateLicenseReason(v, input.Reason); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	license, err := a.modelsFor(r).Licenses.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	actorID := int(a.contextGetUser(r).ID)
+
+	var event *data.LicenseEvent
+	switch action {
+	case data.LicenseActionRenew:
+		var licenseType *data.LicenseType
+		licenseType, err = a.models.LicenseTypes.GetByClass(license.LicenseClass)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		event, err = a.models.Licenses.Renew(license, licenseType.ValidityYears, input.Reason, actorID)
+	case data.LicenseActionSuspend:
+		event, err = a.models.Licenses.Suspend(license, input.Reason, actorID)
+	case data.LicenseActionReinstate:
+		event, err = a.models.Licenses.Reinstate(license, input.Reason, actorID)
+	case data.LicenseActionRevoke:
+		event, err = a.models.Licenses.Revoke(license, input.Reason, actorID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTransition):
+			a.invalidTransitionResponse(w, r, err)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"license": license, "event": event}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
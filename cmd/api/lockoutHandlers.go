@@ -0,0 +1,111 @@
+// Filename: cmd/api/lockoutHandlers.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+)
+
+// loginThrottled reserves a login attempt for the user, writing a 429
+// response and returning true when they must wait before another attempt
+// is checked. A reserved attempt counts as failed until RecordLogin or
+// releaseLoginAttempt says otherwise.
+func (a *app) loginThrottled(w http.ResponseWriter, r *http.Request, user *data.User) bool {
+	lockout, reserved, err := a.models.Users.ReserveLoginAttempt(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return true
+	}
+	if reserved {
+		return false
+	}
+
+	// The wait can run out between the reservation and reading the
+	// lockout; the client should still back off rather than retry at once
+	a.loginThrottledResponse(w, r, max(lockout.RetryAfter(time.Now()), time.Second))
+	return true
+}
+
+// releaseLoginAttempt gives back the attempt reserved by loginThrottled
+// when the credentials were right but the login did not complete
+func (a *app) releaseLoginAttempt(user *data.User) {
+	if err := a.models.Users.ReleaseLoginAttempt(user.ID); err != nil {
+		a.logger.Error("release login attempt", "user_id", user.ID, "error", err)
+	}
+}
+
+// failedLoginResponse records that the attempt reserved by loginThrottled
+// failed and answers with invalid credentials
+func (a *app) failedLoginResponse(w http.ResponseWriter, r *http.Request, user *data.User) {
+	lockout, err := a.models.Users.RecordFailedLogin(user.ID, a.config.lockout.threshold, a.config.lockout.duration, a.clientIP(r))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if lockout.LockedUntil != nil {
+		a.logger.Warn("account locked", "user_id", user.ID, "ip", a.clientIP(r), "locked_until", *lockout.LockedUntil)
+	}
+	a.invalidCredentialsResponse(w, r)
+}
+
+// unlockUserHandler handles POST /v1/users/:id/unlock
+func (a *app) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	admin := a.contextGetUser(r)
+
+	event, err := a.modelsFor(r).Users.Unlock(id, int(admin.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"event": event}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAccountEventsHandler handles GET /v1/users/:id/account-events
+func (a *app) getAccountEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	lockout, err := a.models.Users.GetLockout(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	events, err := a.models.Users.GetAccountEvents(id)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"lockout": lockout, "events": events}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"expvar"
 	"flag"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
@@ -15,7 +16,10 @@ import (
 	"time"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
 	"github.com/amilcar-vasquez/impartBelize/internal/mailer"
+	"github.com/amilcar-vasquez/impartBelize/internal/signer"
+	"github.com/amilcar-vasquez/impartBelize/internal/storage"
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
@@ -27,6 +31,11 @@ var smtpPort = 587 // default SMTP port
 var smtpUsername = os.Getenv("SMTP_USERNAME")
 var smtpPassword = os.Getenv("SMTP_PASSWORD")
 var smtpSender = os.Getenv("SMTP_SENDER")
+var verifySigningKey = os.Getenv("VERIFY_SIGNING_KEY")
+var s3AccessKey = os.Getenv("S3_ACCESS_KEY")
+var s3SecretKey = os.Getenv("S3_SECRET_KEY")
+var fieldEncryptionKeys = os.Getenv("FIELD_ENCRYPTION_KEYS")
+var fieldIndexKey = os.Getenv("FIELD_INDEX_KEY")
 
 type configuration struct {
 	port    int
@@ -39,9 +48,11 @@ type configuration struct {
 		trustedOrigins []string
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps         float64
+		burst       int
+		enabled     bool
+		verifyRPS   float64
+		verifyBurst int
 	}
 	smtp struct {
 		host     string
@@ -50,14 +61,41 @@ type configuration struct {
 		password string
 		sender   string
 	}
+	lockout struct {
+		threshold int
+		duration  time.Duration
+	}
+	verify struct {
+		signingKey string
+		publicURL  string
+	}
+	encryption struct {
+		keys     string
+		indexKey string
+	}
+	storage struct {
+		backend        string
+		localDir       string
+		maxUploadBytes int64
+		s3             struct {
+			endpoint  string
+			region    string
+			bucket    string
+			accessKey string
+			secretKey string
+			useSSL    bool
+		}
+	}
 }
 
 type app struct {
-	config configuration
-	logger *slog.Logger
-	models *data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  configuration
+	logger  *slog.Logger
+	models  *data.Models
+	mailer  mailer.Mailer
+	signer  *signer.Signer
+	storage storage.Storage
+	wg      sync.WaitGroup
 }
 
 // loads the application configuration from terminal flags or defaults in the env.
@@ -88,6 +126,12 @@ func loadConfig() configuration {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate Limiter Maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 5, "Rate Limiter Maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable Rate Limiter")
+	flag.Float64Var(&cfg.limiter.verifyRPS, "limiter-verify-rps", 0.2, "Rate Limiter Maximum requests per second for public license verification")
+	flag.IntVar(&cfg.limiter.verifyBurst, "limiter-verify-burst", 3, "Rate Limiter Maximum burst for public license verification")
+
+	// Account lockout settings
+	flag.IntVar(&cfg.lockout.threshold, "lockout-threshold", 5, "Failed logins before an account is temporarily locked")
+	flag.DurationVar(&cfg.lockout.duration, "lockout-duration", 15*time.Minute, "How long an account stays locked")
 
 	// SMTP settings
 	flag.StringVar(&cfg.smtp.host, "smtp-host", smtpHost, "SMTP host")
@@ -96,6 +140,25 @@ func loadConfig() configuration {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", smtpPassword, "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", smtpSender, "SMTP sender email")
 
+	// License verification settings
+	flag.StringVar(&cfg.verify.signingKey, "verify-signing-key", verifySigningKey, "Base64 ed25519 seed used to sign license verification codes")
+	flag.StringVar(&cfg.verify.publicURL, "public-url", "", "Public base URL printed on certificates for license verification (required outside development)")
+
+	// Field encryption settings
+	flag.StringVar(&cfg.encryption.keys, "encryption-keys", fieldEncryptionKeys, "Comma separated name:base64 AES-256 keys for teachers' sensitive fields; the first seals new values")
+	flag.StringVar(&cfg.encryption.indexKey, "encryption-index-key", fieldIndexKey, "Base64 key (at least 32 bytes) for blind indexes of encrypted fields")
+
+	// Document storage settings
+	flag.StringVar(&cfg.storage.backend, "storage-backend", "local", "Document storage backend (local|s3)")
+	flag.StringVar(&cfg.storage.localDir, "storage-local-dir", "uploads", "Directory for the local storage backend")
+	flag.Int64Var(&cfg.storage.maxUploadBytes, "storage-max-upload-bytes", 10<<20, "Maximum size of an uploaded document")
+	flag.StringVar(&cfg.storage.s3.endpoint, "storage-s3-endpoint", "localhost:9000", "S3-compatible endpoint (host:port)")
+	flag.StringVar(&cfg.storage.s3.region, "storage-s3-region", "", "S3 region")
+	flag.StringVar(&cfg.storage.s3.bucket, "storage-s3-bucket", "impart-documents", "S3 bucket for documents")
+	flag.StringVar(&cfg.storage.s3.accessKey, "storage-s3-access-key", s3AccessKey, "S3 access key")
+	flag.StringVar(&cfg.storage.s3.secretKey, "storage-s3-secret-key", s3SecretKey, "S3 secret key")
+	flag.BoolVar(&cfg.storage.s3.useSSL, "storage-s3-use-ssl", false, "Use TLS when connecting to S3")
+
 	flag.Parse()
 
 	return cfg
@@ -148,6 +211,39 @@ func openDB(settings configuration) (*sql.DB, error) {
 	return db, nil
 }
 
+// openStorage connects to the configured document storage backend
+func openStorage(settings configuration) (storage.Storage, error) {
+	switch settings.storage.backend {
+	case "local":
+		return storage.NewLocal(settings.storage.localDir)
+	case "s3":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		s3 := settings.storage.s3
+		return storage.NewS3(ctx, s3.endpoint, s3.accessKey, s3.secretKey, s3.bucket, s3.region, s3.useSSL)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", settings.storage.backend)
+	}
+}
+
+// requireResealed returns an error while teachers' sensitive fields or
+// two-factor secrets stored before encryption are still in plaintext
+func requireResealed(models *data.Models) error {
+	teachers, err := models.Teachers.CountPlaintext()
+	if err != nil {
+		return err
+	}
+	secrets, err := models.TwoFactor.CountPlaintext()
+	if err != nil {
+		return err
+	}
+	if teachers > 0 || secrets > 0 {
+		return fmt.Errorf("%d teachers and %d two-factor secrets are still stored in plaintext; run cmd/rekey (make encryption/rekey) before starting the API", teachers, secrets)
+	}
+	return nil
+}
+
 func main() {
 	// load the configuration
 	cfg := loadConfig()
@@ -163,12 +259,67 @@ func main() {
 	}
 	defer db.Close()
 
+	// load the key used to sign license verification codes. Codes printed
+	// on certificates must outlive a restart, so only development may fall
+	// back to a temporary key
+	if cfg.verify.signingKey == "" {
+		if cfg.env != "development" {
+			logger.Error("a verify signing key must be configured outside development (VERIFY_SIGNING_KEY or -verify-signing-key)")
+			os.Exit(1)
+		}
+		logger.Warn("no verify signing key configured; using a temporary key, verification codes will not survive a restart")
+	}
+	licenseSigner, err := signer.New(cfg.verify.signingKey)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// certificates point at the verify endpoint, so outside development
+	// the public URL must be given rather than guessed
+	if cfg.verify.publicURL == "" {
+		if cfg.env != "development" {
+			logger.Error("a public URL must be configured outside development (-public-url)")
+			os.Exit(1)
+		}
+		cfg.verify.publicURL = fmt.Sprintf("http://localhost:%d", cfg.port)
+	}
+
+	// load the keys that seal teachers' sensitive fields
+	if cfg.encryption.keys == "" || cfg.encryption.indexKey == "" {
+		logger.Error("field encryption keys must be configured (-encryption-keys and -encryption-index-key)")
+		os.Exit(1)
+	}
+	keyring, err := encryption.New(cfg.encryption.keys, cfg.encryption.indexKey)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// values stored before encryption stay in plaintext, and teachers
+	// cannot be found by SSN, until cmd/rekey has sealed them, so the API
+	// refuses to start until it has run
+	models := data.NewModels(db, keyring)
+	if err := requireResealed(models); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// connect to document storage
+	documentStorage, err := openStorage(cfg)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	// initialize the app struct
 	app := &app{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:  cfg,
+		logger:  logger,
+		models:  models,
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		signer:  licenseSigner,
+		storage: documentStorage,
 	}
 
 	// publish basic expvar metrics
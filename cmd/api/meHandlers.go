@@ -0,0 +1,293 @@
+// Filename: cmd/api/meHandlers.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// The /v1/me endpoints act on the authenticated user and their linked
+// teacher profile. Identity always comes from the bearer token, so there
+// are no IDs in the path to guess or tamper with.
+
+// myTeacher looks up the teacher profile linked to the request's user. If
+// there is none, it writes a 404 response and returns false.
+func (a *app) myTeacher(w http.ResponseWriter, r *http.Request) (*data.Teacher, bool) {
+	user := a.contextGetUser(r)
+
+	teacher, err := a.models.Unscoped().Teachers.GetByUserID(int(user.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.errorResponseJSON(w, r, http.StatusNotFound, "no teacher profile is linked to this account")
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return teacher, true
+}
+
+// withTeacherQuery returns a copy of r whose teacher_id query parameter is
+// set to teacherID, so the list handlers can be reused for the caller's
+// own records.
+func withTeacherQuery(r *http.Request, teacherID int) *http.Request {
+	r2 := r.Clone(r.Context())
+	qs := r2.URL.Query()
+	qs.Set("teacher_id", strconv.Itoa(teacherID))
+	r2.URL.RawQuery = qs.Encode()
+	return r2
+}
+
+// getMeHandler handles GET /v1/me. It returns the caller's user record
+// and their teacher profile, or null if they have none.
+func (a *app) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	teacher, err := a.models.Unscoped().Teachers.GetByUserID(int(user.ID))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response, err := a.presentTeacher(r, teacher)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"user": user, "teacher": response}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateMeHandler handles PATCH /v1/me. Users may change their own
+// username, email and password; changing the email or password requires
+// the current password. A new email has to be activated again, and a new
+// password signs the user out of every other session.
+func (a *app) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Username        *string `json:"username"`
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Work on a fresh copy rather than the one held in the request context
+	user, err := a.models.Users.Get(int(a.contextGetUser(r).ID))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	emailChanged := input.Email != nil && *input.Email != user.Email
+
+	v := validator.New()
+
+	if input.Password != nil || emailChanged {
+		v.Check(input.CurrentPassword != "", "current_password", "must be provided to change the email or password")
+		if v.IsEmpty() {
+			match, err := user.Password.Matches(input.CurrentPassword)
+			if err != nil {
+				a.serverErrorResponse(w, r, err)
+				return
+			}
+			v.Check(match, "current_password", "is incorrect")
+		}
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if input.Password != nil {
+		data.ValidatePasswordPlaintext(v, *input.Password)
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = user.Password.Set(*input.Password)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if input.Username != nil {
+		user.Username = *input.Username
+	}
+	if emailChanged {
+		user.Email = *input.Email
+		user.IsActivated = false
+	}
+
+	if data.ValidateUser(v, user); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.modelsFor(r).Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "email address already in use")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Password != nil {
+		err = a.models.Tokens.DeleteOtherSessions(user.ID, a.contextGetToken(r))
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if emailChanged {
+		if err = a.sendEmailChangedActivation(user); err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMyTeacherHandler handles GET /v1/me/teacher
+func (a *app) getMyTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := a.presentTeacher(r, teacher)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": response}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMyEducationHandler handles GET /v1/me/education
+func (a *app) listMyEducationHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.listEducation(w, r, teacher.ID)
+}
+
+// createMyEducationHandler handles POST /v1/me/education
+func (a *app) createMyEducationHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.createEducation(w, r, teacher.ID)
+}
+
+// listMyQualificationsHandler handles GET /v1/me/qualifications
+func (a *app) listMyQualificationsHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.listQualifications(w, r, teacher.ID)
+}
+
+// createMyQualificationHandler handles POST /v1/me/qualifications
+func (a *app) createMyQualificationHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.createQualification(w, r, teacher.ID)
+}
+
+// listMyDocumentsHandler handles GET /v1/me/documents
+func (a *app) listMyDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.listDocuments(w, r, teacher.ID)
+}
+
+// createMyDocumentHandler handles POST /v1/me/documents. It accepts the
+// same multipart uploads as POST /v1/documents, minus teacher_id.
+func (a *app) createMyDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.createDocument(w, r, teacher.ID)
+}
+
+// listMyApplicationsHandler handles GET /v1/me/applications. It takes the
+// same status and paging parameters as GET /v1/applications.
+func (a *app) listMyApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.listApplicationsHandler(w, withTeacherQuery(r, teacher.ID))
+}
+
+// createMyApplicationHandler handles POST /v1/me/applications
+func (a *app) createMyApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.createApplication(w, r, teacher.ID)
+}
+
+// listMyLicensesHandler handles GET /v1/me/licenses. It takes the same
+// status, class and paging parameters as GET /v1/licenses.
+func (a *app) listMyLicensesHandler(w http.ResponseWriter, r *http.Request) {
+	teacher, ok := a.myTeacher(w, r)
+	if !ok {
+		return
+	}
+	a.listLicensesHandler(w, withTeacherQuery(r, teacher.ID))
+}
+
+// listMyNotificationsHandler handles GET /v1/me/notifications
+func (a *app) listMyNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	notifications, err := a.models.Notifications.GetByUser(int(user.ID))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"notifications": notifications}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
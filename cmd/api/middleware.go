@@ -60,6 +60,17 @@ func (a *app) enableCORS(next http.Handler) http.Handler {
 }
 
 func (a *app) rateLimit(next http.Handler) http.Handler {
+	return a.limitByIP(a.config.limiter.rps, a.config.limiter.burst, next)
+}
+
+// verifyRateLimit applies the stricter limit used by the public license
+// verification endpoint. Requests still pass through rateLimit first.
+func (a *app) verifyRateLimit(next http.Handler) http.Handler {
+	return a.limitByIP(a.config.limiter.verifyRPS, a.config.limiter.verifyBurst, next)
+}
+
+// limitByIP allows each client IP rps requests per second with the given burst
+func (a *app) limitByIP(rps float64, burst int, next http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
 		lastSeen time.Time
@@ -94,7 +105,7 @@ func (a *app) rateLimit(next http.Handler) http.Handler {
 
 			_, found := clients[ip]
 			if !found {
-				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(a.config.limiter.rps), a.config.limiter.burst)}
+				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
 			}
 
 			clients[ip].lastSeen = time.Now()
@@ -153,8 +164,32 @@ func (a *app) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		// Record the session as used. This only feeds the session list,
+		// so a failure is logged rather than failing the request.
+		err = a.models.Tokens.Touch(token)
+		if err != nil {
+			a.logger.Error("unable to record session use", "user_id", user.ID, "error", err.Error())
+		}
+
+		// Limit the user's queries to their districts if their role requires it
+		scope, err := a.districtScope(user)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Load the user's permissions once for every check in the request
+		permissions, err := a.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
 		// Add the retrieved user info to the context
 		r = a.contextSetUser(r, user)
+		r = a.contextSetToken(r, token)
+		r = a.contextSetDistrictScope(r, scope)
+		r = a.contextSetPermissions(r, permissions)
 
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
@@ -190,59 +225,16 @@ func (a *app) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 
 
 
-// This middleware checks if the user has the required role
-// We send the role name that is expected as an argument
-func (a *app) requireRole(roleName string, next http.HandlerFunc) http.HandlerFunc {
+// requirePermission checks that the user's role has been granted the
+// permission with the given code
+func (a *app) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := a.contextGetUser(r)
-
-		// Get the user's role from the database
-		role, err := a.models.Roles.Get(user.RoleID)
-		if err != nil {
-			a.serverErrorResponse(w, r, err)
-			return
-		}
-
-		// Check if the user has the required role
-		if role.RoleName != roleName {
-			a.notPermittedResponse(w, r)
-			return
-		}
-
-		// User has the correct role, continue
-		next.ServeHTTP(w, r)
-	}
-
-	return a.requireActivatedUser(fn)
-}
-
-// This middleware checks if the user has one of multiple allowed roles
-func (a *app) requireAnyRole(roleNames []string, next http.HandlerFunc) http.HandlerFunc {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		user := a.contextGetUser(r)
-
-		// Get the user's role from the database
-		role, err := a.models.Roles.Get(user.RoleID)
-		if err != nil {
-			a.serverErrorResponse(w, r, err)
-			return
-		}
-
-		// Check if the user has any of the allowed roles
-		hasRole := false
-		for _, allowedRole := range roleNames {
-			if role.RoleName == allowedRole {
-				hasRole = true
-				break
-			}
-		}
-
-		if !hasRole {
+		if !a.contextGetPermissions(r).Include(code) {
 			a.notPermittedResponse(w, r)
 			return
 		}
 
-		// User has one of the allowed roles, continue
+		// User has the permission, continue
 		next.ServeHTTP(w, r)
 	}
 
@@ -12,6 +12,12 @@ import (
 
 // createQualificationHandler handles POST /v1/qualifications
 func (a *app) createQualificationHandler(w http.ResponseWriter, r *http.Request) {
+	a.createQualification(w, r, 0)
+}
+
+// createQualification adds a qualification. A non-zero teacherID takes the
+// place of the teacher_id in the request body.
+func (a *app) createQualification(w http.ResponseWriter, r *http.Request, teacherID int) {
 	var input struct {
 		TeacherID      int    `json:"teacher_id"`
 		Institution    string `json:"institution,omitempty"`
@@ -27,6 +33,10 @@ func (a *app) createQualificationHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if teacherID > 0 {
+		input.TeacherID = teacherID
+	}
+
 	qualification := &data.Qualification{
 		TeacherID:      input.TeacherID,
 		Institution:    input.Institution,
@@ -37,16 +47,15 @@ func (a *app) createQualificationHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	v := validator.New()
-	v.Check(qualification.TeacherID > 0, "teacher_id", "must be provided")
-	v.Check(len(qualification.Institution) <= 150, "institution", "must not be more than 150 characters long")
-	v.Check(len(qualification.Specialization) <= 100, "specialization", "must not be more than 100 characters long")
-	v.Check(len(qualification.Certification) <= 150, "certification", "must not be more than 150 characters long")
-
-	if !v.IsEmpty() {
+	if data.ValidateQualification(v, qualification); !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	if !a.requireTeacherOwner(w, r, qualification.TeacherID) {
+		return
+	}
+
 	err = a.models.Qualifications.Insert(qualification)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
@@ -62,7 +71,36 @@ func (a *app) createQualificationHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// getQualificationsByTeacherHandler handles GET /v1/teachers/:teacher_id/qualifications
+// getQualificationHandler handles GET /v1/qualifications/:id
+func (a *app) getQualificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	qualification, err := a.models.Qualifications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, qualification.TeacherID) {
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"qualification": qualification}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getQualificationsByTeacherHandler handles GET /v1/teachers/:id/qualifications
 func (a *app) getQualificationsByTeacherHandler(w http.ResponseWriter, r *http.Request) {
 	teacherID, err := a.readIDParam(r)
 	if err != nil {
@@ -70,13 +108,106 @@ func (a *app) getQualificationsByTeacherHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	qualifications, err := a.models.Qualifications.GetByTeacher(int(teacherID))
+	if !a.requireTeacherOwner(w, r, int(teacherID)) {
+		return
+	}
+
+	a.listQualifications(w, r, int(teacherID))
+}
+
+// listQualifications writes a page of the teacher's qualifications
+func (a *app) listQualifications(w http.ResponseWriter, r *http.Request, teacherID int) {
+	v := validator.New()
+	filters := a.readFilters(r.URL.Query(), "-year_obtained", data.QualificationSortSafelist, v)
+
+	if data.ValidateFilters(v, filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	qualifications, metadata, err := a.models.Qualifications.GetByTeacher(teacherID, filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"qualifications": qualifications}, nil)
+	err = a.writeJSON(w, http.StatusOK, envelope{"qualifications": qualifications, "metadata": metadata}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateQualificationHandler handles PATCH /v1/qualifications/:id
+func (a *app) updateQualificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	qualification, err := a.models.Qualifications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, qualification.TeacherID) {
+		return
+	}
+
+	var input struct {
+		Institution    *string `json:"institution"`
+		Specialization *string `json:"specialization"`
+		Certification  *string `json:"certification"`
+		YearObtained   *int    `json:"year_obtained"`
+		InstitutionID  *int    `json:"institution_id"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Institution != nil {
+		qualification.Institution = *input.Institution
+	}
+	if input.Specialization != nil {
+		qualification.Specialization = *input.Specialization
+	}
+	if input.Certification != nil {
+		qualification.Certification = *input.Certification
+	}
+	if input.YearObtained != nil {
+		qualification.YearObtained = *input.YearObtained
+	}
+	if input.InstitutionID != nil {
+		qualification.InstitutionID = *input.InstitutionID
+	}
+
+	v := validator.New()
+	if data.ValidateQualification(v, qualification); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.models.Qualifications.Update(qualification)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"qualification": qualification}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -90,7 +221,22 @@ func (a *app) deleteQualificationHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = a.models.Qualifications.Delete(int(id))
+	qualification, err := a.models.Qualifications.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, qualification.TeacherID) {
+		return
+	}
+
+	err = a.models.Qualifications.Delete(qualification.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
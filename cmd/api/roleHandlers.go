@@ -13,7 +13,9 @@ import (
 // createRoleHandler handles POST /v1/roles
 func (a *app) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		RoleName string `json:"role_name"`
+		RoleName          string `json:"role_name"`
+		RequiresTwoFactor bool   `json:"requires_two_factor"`
+		DistrictScoped    bool   `json:"district_scoped"`
 	}
 
 	err := a.readJSON(w, r, &input)
@@ -23,7 +25,9 @@ func (a *app) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	role := &data.Role{
-		RoleName: input.RoleName,
+		RoleName:          input.RoleName,
+		RequiresTwoFactor: input.RequiresTwoFactor,
+		DistrictScoped:    input.DistrictScoped,
 	}
 
 	v := validator.New()
@@ -32,7 +36,7 @@ func (a *app) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.models.Roles.Insert(role)
+	err = a.modelsFor(r).Roles.Insert(role)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -133,7 +137,9 @@ func (a *app) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input struct {
-		RoleName *string `json:"role_name"`
+		RoleName          *string `json:"role_name"`
+		RequiresTwoFactor *bool   `json:"requires_two_factor"`
+		DistrictScoped    *bool   `json:"district_scoped"`
 	}
 
 	err = a.readJSON(w, r, &input)
@@ -145,6 +151,12 @@ func (a *app) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
 	if input.RoleName != nil {
 		role.RoleName = *input.RoleName
 	}
+	if input.RequiresTwoFactor != nil {
+		role.RequiresTwoFactor = *input.RequiresTwoFactor
+	}
+	if input.DistrictScoped != nil {
+		role.DistrictScoped = *input.DistrictScoped
+	}
 
 	v := validator.New()
 	if data.ValidateRole(v, role); !v.IsEmpty() {
@@ -152,7 +164,7 @@ func (a *app) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.models.Roles.Update(role)
+	err = a.modelsFor(r).Roles.Update(role)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -177,7 +189,7 @@ func (a *app) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.models.Roles.Delete(int(id))
+	err = a.modelsFor(r).Roles.Delete(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -193,3 +205,110 @@ func (a *app) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// listPermissionsHandler handles GET /v1/permissions
+func (a *app) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := a.models.Permissions.GetAll()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getRolePermissionsHandler handles GET /v1/roles/:id/permissions
+func (a *app) getRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := a.models.Roles.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := a.models.Permissions.GetAllForRole(role.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"role": role, "permissions": permissions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateRolePermissionsHandler handles PUT /v1/roles/:id/permissions. The
+// permissions sent replace everything the role was granted before.
+func (a *app) updateRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Permissions != nil, "permissions", "must be provided")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	role, err := a.models.Roles.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.modelsFor(r).Permissions.SetForRole(role.ID, input.Permissions...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownPermission):
+			v.AddError("permissions", "must only contain known permission codes")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := a.models.Permissions.GetAllForRole(role.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"role": role, "permissions": permissions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
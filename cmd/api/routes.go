@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -25,68 +26,124 @@ func (a *app) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, apiV1Route+"/users", a.registerUserHandler)
 	// *-- Activate a User (public) -- *
 	router.HandlerFunc(http.MethodPut, apiV1Route+"/users/activated", a.activateUserHandler)
+	// *-- Reset a forgotten password with an emailed token (public) -- *
+	router.HandlerFunc(http.MethodPut, apiV1Route+"/users/password", a.updateUserPasswordHandler)
 	
 	// Protected user routes - Admin, CEO, DEC, TSC can view all users (must be activated)
-	router.Handler(http.MethodGet, apiV1Route+"/users", a.requireAnyRole([]string{"Admin", "CEO", "DEC", "TSC"}, http.HandlerFunc(a.getAllUsersHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/users", a.requirePermission(data.PermissionUsersRead, http.HandlerFunc(a.getAllUsersHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/users/:id", a.requireActivatedUser(a.getUserHandler))
 	// Admin, CEO, and DEC can update users (must be activated)
 	router.Handler(http.MethodPatch, apiV1Route+"/users/:id", a.requireActivatedUser(a.updateUserHandler))
 	// Only Admin can delete users (must be activated)
 	router.Handler(http.MethodDelete, apiV1Route+"/users/:id", 
-		a.requireRole("Admin", http.HandlerFunc(a.deleteUserHandler)))
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.deleteUserHandler)))
+
+	// Only Admin can assign users to districts (must be activated)
+	router.Handler(http.MethodGet, apiV1Route+"/users/:id/districts", 
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.getUserDistrictsHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/users/:id/districts", 
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.updateUserDistrictsHandler)))
+
+	// A user's teacher profile - the teacher themselves, or staff who can see
+	// the teacher (must be activated)
+	router.Handler(http.MethodGet, apiV1Route+"/users/:id/teacher", 
+		a.requireActivatedUser(http.HandlerFunc(a.getTeacherByUserIDHandler)))
+
+	// Only Admin can see lockout history and unlock accounts (must be activated)
+	router.Handler(http.MethodGet, apiV1Route+"/users/:id/account-events", 
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.getAccountEventsHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/users/:id/unlock", 
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.unlockUserHandler)))
+
+	// Audit trail - Admin and CEO can read it; nobody can change it
+	router.Handler(http.MethodGet, apiV1Route+"/audit",
+		a.requirePermission(data.PermissionAuditRead, http.HandlerFunc(a.listAuditEventsHandler)))
+
+	// Deleted users, teachers and documents - Admin can list and restore them;
+	// purging needs records:purge, which no role holds by default
+	router.Handler(http.MethodGet, apiV1Route+"/deleted",
+		a.requirePermission(data.PermissionRecordsRestore, http.HandlerFunc(a.listDeletedHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/deleted/:entity_type/:id/restore",
+		a.requirePermission(data.PermissionRecordsRestore, http.HandlerFunc(a.restoreDeletedHandler)))
+	router.Handler(http.MethodDelete, apiV1Route+"/deleted/:entity_type/:id",
+		a.requirePermission(data.PermissionRecordsPurge, http.HandlerFunc(a.purgeDeletedHandler)))
 
 	// Role routes - Only Admin can manage roles (must be activated)
 	router.Handler(http.MethodPost, apiV1Route+"/roles", 
-		a.requireRole("Admin", http.HandlerFunc(a.createRoleHandler)))
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.createRoleHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/roles", 
 		http.HandlerFunc(a.getAllRolesHandler))
 	router.Handler(http.MethodGet, apiV1Route+"/roles/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getRoleHandler)))
 	router.Handler(http.MethodPatch, apiV1Route+"/roles/:id", 
-		a.requireRole("Admin", http.HandlerFunc(a.updateRoleHandler)))
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.updateRoleHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/roles/:id", 
-		a.requireRole("Admin", http.HandlerFunc(a.deleteRoleHandler)))
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.deleteRoleHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/permissions", 
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.listPermissionsHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/roles/:id/permissions", 
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.getRolePermissionsHandler)))
+	router.Handler(http.MethodPut, apiV1Route+"/roles/:id/permissions", 
+		a.requirePermission(data.PermissionRolesManage, http.HandlerFunc(a.updateRolePermissionsHandler)))
 
 	// District routes - Admin, CEO, DEC can manage districts (must be activated)
 	router.Handler(http.MethodPost, apiV1Route+"/districts", 
-		a.requireAnyRole([]string{"Admin", "CEO", "DEC"}, http.HandlerFunc(a.createDistrictHandler)))
+		a.requirePermission(data.PermissionDistrictsCreate, http.HandlerFunc(a.createDistrictHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/districts", 
 		a.requireActivatedUser(http.HandlerFunc(a.getAllDistrictsHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/districts/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getDistrictHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/districts/:id", 
+		a.requirePermission(data.PermissionDistrictsUpdate, http.HandlerFunc(a.updateDistrictHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/districts/:id", 
-		a.requireAnyRole([]string{"Admin", "CEO"}, http.HandlerFunc(a.deleteDistrictHandler)))
+		a.requirePermission(data.PermissionDistrictsDelete, http.HandlerFunc(a.deleteDistrictHandler)))
 
 	// Institution routes - Admin, CEO, DEC, TSC can manage institutions (must be activated)
 	router.Handler(http.MethodPost, apiV1Route+"/institutions", 
-		a.requireAnyRole([]string{"Admin", "CEO", "DEC", "TSC"}, http.HandlerFunc(a.createInstitutionHandler)))
+		a.requirePermission(data.PermissionInstitutionsCreate, http.HandlerFunc(a.createInstitutionHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/institutions", 
 		a.requireActivatedUser(http.HandlerFunc(a.getAllInstitutionsHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/institutions/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getInstitutionHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/institutions/:id", 
+		a.requirePermission(data.PermissionInstitutionsUpdate, http.HandlerFunc(a.updateInstitutionHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/institutions/:id", 
-		a.requireAnyRole([]string{"Admin", "CEO"}, http.HandlerFunc(a.deleteInstitutionHandler)))
+		a.requirePermission(data.PermissionInstitutionsDelete, http.HandlerFunc(a.deleteInstitutionHandler)))
 
-	// Teacher routes - All authenticated users can list/view, Admin/CEO/TSC/DEC can create (must be activated)
+	// Teacher routes - All authenticated users can list/view, Admin/CEO/TSC/DEC can create, owners and staff can update (must be activated)
 	router.Handler(http.MethodGet, apiV1Route+"/teachers", 
 		a.requireActivatedUser(http.HandlerFunc(a.listTeachersHandler)))
 	router.Handler(http.MethodPost, apiV1Route+"/teachers", 
-		a.requireAnyRole([]string{"Admin", "CEO", "TSC", "DEC"}, http.HandlerFunc(a.createTeacherHandler)))
+		a.requirePermission(data.PermissionTeachersCreate, http.HandlerFunc(a.createTeacherHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/teachers/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getTeacherHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/teachers/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.updateTeacherHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/teachers/:id", 
-		a.requireAnyRole([]string{"Admin", "CEO", "TSC"}, http.HandlerFunc(a.deleteTeacherHandler)))
+		a.requirePermission(data.PermissionTeachersDelete, http.HandlerFunc(a.deleteTeacherHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/teachers/:id/education", 
+		a.requireActivatedUser(http.HandlerFunc(a.getEducationByTeacherHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/teachers/:id/qualifications", 
+		a.requireActivatedUser(http.HandlerFunc(a.getQualificationsByTeacherHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/teachers/:id/documents", 
+		a.requireActivatedUser(http.HandlerFunc(a.getDocumentsByTeacherHandler)))
 
 	// Education routes - Teachers can manage their own, Admin/CEO/TSC/DEC can manage all (must be activated)
 	router.Handler(http.MethodPost, apiV1Route+"/education", 
 		a.requireActivatedUser(http.HandlerFunc(a.createEducationHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/education/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getEducationHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/education/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.updateEducationHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/education/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.deleteEducationHandler)))
 	// Qualification routes - Teachers can manage their own, Admin/CEO/TSC/DEC can manage all (must be activated)
 	router.Handler(http.MethodPost, apiV1Route+"/qualifications", 
 		a.requireActivatedUser(http.HandlerFunc(a.createQualificationHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/qualifications/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.getQualificationHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/qualifications/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.updateQualificationHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/qualifications/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.deleteQualificationHandler)))
 
@@ -95,10 +152,69 @@ func (a *app) routes() http.Handler {
 		a.requireActivatedUser(http.HandlerFunc(a.createDocumentHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/documents/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.getDocumentHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/documents/:id/file", 
+		a.requireActivatedUser(http.HandlerFunc(a.getDocumentFileHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/documents/:id/verify", 
+		a.requirePermission(data.PermissionDocumentsVerify, http.HandlerFunc(a.verifyDocumentHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/documents/:id/reject", 
+		a.requirePermission(data.PermissionDocumentsVerify, http.HandlerFunc(a.rejectDocumentHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/verification-queue", 
+		a.requirePermission(data.PermissionDocumentsVerify, http.HandlerFunc(a.listVerificationQueueHandler)))
 	router.Handler(http.MethodDelete, apiV1Route+"/documents/:id", 
 		a.requireActivatedUser(http.HandlerFunc(a.deleteDocumentHandler)))
+	// Document type routes - everyone can read the registry, only Admin can change it (must be activated)
+	router.Handler(http.MethodGet, apiV1Route+"/document-types", 
+		a.requireActivatedUser(http.HandlerFunc(a.listDocumentTypesHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/document-types", 
+		a.requirePermission(data.PermissionDocumentTypesManage, http.HandlerFunc(a.createDocumentTypeHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/document-types/:id", 
+		a.requirePermission(data.PermissionDocumentTypesManage, http.HandlerFunc(a.updateDocumentTypeHandler)))
+	// Application routes - Teachers apply for licenses, Admin/CEO/TSC/DEC review them (must be activated)
+	router.Handler(http.MethodGet, apiV1Route+"/license-types", 
+		a.requireActivatedUser(http.HandlerFunc(a.getAllLicenseTypesHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/applications", 
+		a.requireActivatedUser(http.HandlerFunc(a.createApplicationHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/applications", 
+		a.requirePermission(data.PermissionApplicationsRead, http.HandlerFunc(a.listApplicationsHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/applications/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.getApplicationHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/applications/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.updateApplicationHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/applications/:id/transitions", 
+		a.requireActivatedUser(http.HandlerFunc(a.createApplicationTransitionHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/applications/:id/transitions", 
+		a.requireActivatedUser(http.HandlerFunc(a.getApplicationTransitionsHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/applications/:id/checklist", 
+		a.requireActivatedUser(http.HandlerFunc(a.getApplicationChecklistHandler)))
+	router.Handler(http.MethodDelete, apiV1Route+"/applications/:id", 
+		a.requirePermission(data.PermissionApplicationsDelete, http.HandlerFunc(a.deleteApplicationHandler)))
+	// License routes - CEO issues and renews licenses, TSC can also suspend, reinstate and revoke them (must be activated)
+	router.Handler(http.MethodPost, apiV1Route+"/licenses", 
+		a.requirePermission(data.PermissionLicensesIssue, http.HandlerFunc(a.issueLicenseHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/licenses", 
+		a.requirePermission(data.PermissionLicensesRead, http.HandlerFunc(a.listLicensesHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/licenses/:id", 
+		a.requireActivatedUser(http.HandlerFunc(a.getLicenseHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/licenses/:id/certificate.pdf", 
+		a.requireActivatedUser(http.HandlerFunc(a.getLicenseCertificateHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/licenses/:id/events", 
+		a.requirePermission(data.PermissionLicensesRead, http.HandlerFunc(a.getLicenseEventsHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/licenses/:id/renew", 
+		a.requirePermission(data.PermissionLicensesIssue, http.HandlerFunc(a.renewLicenseHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/licenses/:id/suspend", 
+		a.requirePermission(data.PermissionLicensesSuspend, http.HandlerFunc(a.suspendLicenseHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/licenses/:id/reinstate", 
+		a.requirePermission(data.PermissionLicensesSuspend, http.HandlerFunc(a.reinstateLicenseHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/licenses/:id/revoke", 
+		a.requirePermission(data.PermissionLicensesSuspend, http.HandlerFunc(a.revokeLicenseHandler)))
+
+	// Public license verification - no login required, stricter rate limit
+	router.Handler(http.MethodGet, apiV1Route+"/verify/:license_number", 
+		a.verifyRateLimit(http.HandlerFunc(a.verifyLicenseHandler)))
+	router.HandlerFunc(http.MethodGet, apiV1Route+"/verification-key", a.verificationKeyHandler)
+
 	// Notification routes - Admin/CEO/Secretary can create, users can manage their own (must be activated)
-	router.Handler(http.MethodPost, apiV1Route+"/notifications", a.requireAnyRole([]string{"Admin", "CEO", "Secretary"}, http.HandlerFunc(a.createNotificationHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/notifications", a.requirePermission(data.PermissionNotificationsCreate, http.HandlerFunc(a.createNotificationHandler)))
 	router.Handler(http.MethodPatch, apiV1Route+"/notifications/:id/read", 
 		a.requireActivatedUser(http.HandlerFunc(a.markNotificationAsReadHandler)))
 	router.Handler(http.MethodGet, apiV1Route+"/notifications/:id", 
@@ -110,9 +226,63 @@ func (a *app) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, apiV1Route+"/tokens/authentication", a.createAuthTokenHandler)
 	// *-- create an activation token (public) -- *
 	router.HandlerFunc(http.MethodPost, apiV1Route+"/tokens/activation", a.createActivationTokenHandler)
+	// *-- log out the current token -- *
+	router.Handler(http.MethodDelete, apiV1Route+"/tokens/authentication", 
+		a.requireAuthenticatedUser(http.HandlerFunc(a.deleteAuthTokenHandler)))
+	// *-- second login step for two-factor users (public) -- *
+	router.HandlerFunc(http.MethodPost, apiV1Route+"/tokens/two-factor", a.createTwoFactorTokenHandler)
+	// *-- enrol in two-factor authentication with an emailed token (public) -- *
+	router.HandlerFunc(http.MethodPost, apiV1Route+"/tokens/two-factor-enrolment", a.startTwoFactorEnrolmentHandler)
+	router.HandlerFunc(http.MethodPut, apiV1Route+"/tokens/two-factor-enrolment", a.confirmTwoFactorEnrolmentHandler)
+	// *-- email a password reset token (public) -- *
+	router.HandlerFunc(http.MethodPost, apiV1Route+"/tokens/password-reset", a.createPasswordResetTokenHandler)
 	// Only Admin can delete all tokens for a user (must be activated)
 	router.Handler(http.MethodDelete, apiV1Route+"/tokens/user/:user_id", 
-		a.authenticate(a.requireActivatedUser(a.requireRole("Admin", http.HandlerFunc(a.deleteAllTokensForUserHandler)))))
+		a.requirePermission(data.PermissionUsersManage, http.HandlerFunc(a.deleteAllTokensForUserHandler)))
+
+	// Session routes - users manage their own login sessions
+	router.Handler(http.MethodGet, apiV1Route+"/me/sessions", 
+		a.requireAuthenticatedUser(http.HandlerFunc(a.listSessionsHandler)))
+	router.Handler(http.MethodDelete, apiV1Route+"/me/sessions/:id", 
+		a.requireAuthenticatedUser(http.HandlerFunc(a.deleteSessionHandler)))
+
+	// Two-factor routes - users manage their own enrolment
+	router.Handler(http.MethodPost, apiV1Route+"/me/two-factor", 
+		a.requireActivatedUser(http.HandlerFunc(a.beginTwoFactorHandler)))
+	router.Handler(http.MethodPut, apiV1Route+"/me/two-factor", 
+		a.requireActivatedUser(http.HandlerFunc(a.confirmTwoFactorHandler)))
+	router.Handler(http.MethodDelete, apiV1Route+"/me/two-factor", 
+		a.requireActivatedUser(http.HandlerFunc(a.disableTwoFactorHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/me/two-factor/recovery-codes", 
+		a.requireActivatedUser(http.HandlerFunc(a.regenerateRecoveryCodesHandler)))
+
+	// Self-service routes - the caller's own account and teacher records
+	router.Handler(http.MethodGet, apiV1Route+"/me", 
+		a.requireActivatedUser(http.HandlerFunc(a.getMeHandler)))
+	router.Handler(http.MethodPatch, apiV1Route+"/me", 
+		a.requireActivatedUser(http.HandlerFunc(a.updateMeHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/teacher", 
+		a.requireActivatedUser(http.HandlerFunc(a.getMyTeacherHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/education", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyEducationHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/me/education", 
+		a.requireActivatedUser(http.HandlerFunc(a.createMyEducationHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/qualifications", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyQualificationsHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/me/qualifications", 
+		a.requireActivatedUser(http.HandlerFunc(a.createMyQualificationHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/documents", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyDocumentsHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/me/documents", 
+		a.requireActivatedUser(http.HandlerFunc(a.createMyDocumentHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/applications", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyApplicationsHandler)))
+	router.Handler(http.MethodPost, apiV1Route+"/me/applications", 
+		a.requireActivatedUser(http.HandlerFunc(a.createMyApplicationHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/licenses", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyLicensesHandler)))
+	router.Handler(http.MethodGet, apiV1Route+"/me/notifications", 
+		a.requireActivatedUser(http.HandlerFunc(a.listMyNotificationsHandler)))
 
 	// Apply middleware
 	handler := a.recoverPanic(router)
@@ -54,24 +54,33 @@ func (a *app) createTeacherHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v := validator.New()
-	v.Check(teacher.FirstName != "", "first_name", "must be provided")
-	v.Check(len(teacher.FirstName) <= 100, "first_name", "must not be more than 100 characters long")
-	v.Check(teacher.LastName != "", "last_name", "must be provided")
-	v.Check(len(teacher.LastName) <= 100, "last_name", "must not be more than 100 characters long")
-	v.Check(teacher.Email != "", "email", "must be provided")
-	v.Check(len(teacher.Email) <= 100, "email", "must not be more than 100 characters long")
-	v.Check(len(teacher.SSN) <= 15, "ssn", "must not be more than 15 characters long")
-	v.Check(len(teacher.ProfileStatus) <= 30, "profile_status", "must not be more than 30 characters long")
+	data.ValidateTeacher(v, teacher)
+	v.Check(a.contextGetDistrictScope(r).Allows(teacher.DistrictID), "district_id", "must be one of your assigned districts")
 
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = a.models.Teachers.Insert(teacher)
+	err = a.modelsFor(r).Teachers.Insert(teacher)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "email address already in use")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateSSN):
+			v.AddError("ssn", "a teacher with this SSN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			// Log the actual error for debugging
+			a.logger.Error("failed to insert teacher", "error", err)
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response, err := a.presentTeacher(r, teacher)
 	if err != nil {
-		// Log the actual error for debugging
-		a.logger.Error("failed to insert teacher", "error", err)
 		a.serverErrorResponse(w, r, err)
 		return
 	}
@@ -79,7 +88,7 @@ func (a *app) createTeacherHandler(w http.ResponseWriter, r *http.Request) {
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/teachers/%d", teacher.ID))
 
-	err = a.writeJSON(w, http.StatusCreated, envelope{"teacher": teacher}, headers)
+	err = a.writeJSON(w, http.StatusCreated, envelope{"teacher": response}, headers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -93,7 +102,7 @@ func (a *app) getTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	teacher, err := a.models.Teachers.Get(int(id))
+	teacher, err := a.modelsFor(r).Teachers.Get(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -104,13 +113,20 @@ func (a *app) getTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": teacher}, nil)
+	response, err := a.presentTeacher(r, teacher)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": response}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
 }
 
-// getTeacherByUserIDHandler handles GET /v1/teachers/user/:user_id
+// getTeacherByUserIDHandler handles GET /v1/users/:id/teacher. It returns
+// the teacher profile linked to a user account.
 func (a *app) getTeacherByUserIDHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := a.readIDParam(r)
 	if err != nil {
@@ -118,7 +134,7 @@ func (a *app) getTeacherByUserIDHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	teacher, err := a.models.Teachers.GetByUserID(int(userID))
+	teacher, err := a.modelsFor(r).Teachers.GetByUserID(int(userID))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -129,7 +145,173 @@ func (a *app) getTeacherByUserIDHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": teacher}, nil)
+	if !a.requireTeacherOwner(w, r, teacher.ID) {
+		return
+	}
+
+	response, err := a.presentTeacher(r, teacher)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": response}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTeacherHandler handles PATCH /v1/teachers/:id. Teachers may edit
+// their own contact details; names, date of birth, SSN, district and
+// profile status can only be changed by staff. If the request includes a
+// version it must match the stored one.
+func (a *app) updateTeacherHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		FirstName     *string    `json:"first_name"`
+		LastName      *string    `json:"last_name"`
+		Gender        *string    `json:"gender"`
+		DOB           *time.Time `json:"dob"`
+		SSN           *string    `json:"ssn"`
+		MaritalStatus *string    `json:"marital_status"`
+		Email         *string    `json:"email"`
+		Address       *string    `json:"address"`
+		DistrictID    *int       `json:"district_id"`
+		Phone         *string    `json:"phone"`
+		ProfileStatus *string    `json:"profile_status"`
+		Version       *int       `json:"version"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	teacher, err := a.modelsFor(r).Teachers.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !a.requireTeacherOwner(w, r, teacher.ID) {
+		return
+	}
+
+	if input.Version != nil && *input.Version != teacher.Version {
+		a.editConflictResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	// Identity and placement fields are staff only
+	if input.FirstName != nil || input.LastName != nil || input.DOB != nil || input.SSN != nil ||
+		input.DistrictID != nil || input.ProfileStatus != nil {
+		owner, err := a.recordOwnerFor(r)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !owner.staff {
+			if input.FirstName != nil {
+				v.AddError("first_name", "can only be changed by staff")
+			}
+			if input.LastName != nil {
+				v.AddError("last_name", "can only be changed by staff")
+			}
+			if input.DOB != nil {
+				v.AddError("dob", "can only be changed by staff")
+			}
+			if input.SSN != nil {
+				v.AddError("ssn", "can only be changed by staff")
+			}
+			if input.DistrictID != nil {
+				v.AddError("district_id", "can only be changed by staff")
+			}
+			if input.ProfileStatus != nil {
+				v.AddError("profile_status", "can only be changed by staff")
+			}
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	if input.FirstName != nil {
+		teacher.FirstName = *input.FirstName
+	}
+	if input.LastName != nil {
+		teacher.LastName = *input.LastName
+	}
+	if input.Gender != nil {
+		teacher.Gender = *input.Gender
+	}
+	if input.DOB != nil {
+		teacher.DOB = input.DOB
+	}
+	if input.SSN != nil {
+		teacher.SSN = *input.SSN
+	}
+	if input.MaritalStatus != nil {
+		teacher.MaritalStatus = *input.MaritalStatus
+	}
+	if input.Email != nil {
+		teacher.Email = *input.Email
+	}
+	if input.Address != nil {
+		teacher.Address = *input.Address
+	}
+	if input.DistrictID != nil {
+		teacher.DistrictID = *input.DistrictID
+		v.Check(a.contextGetDistrictScope(r).Allows(teacher.DistrictID), "district_id", "must be one of your assigned districts")
+	}
+	if input.Phone != nil {
+		teacher.Phone = *input.Phone
+	}
+	if input.ProfileStatus != nil {
+		teacher.ProfileStatus = *input.ProfileStatus
+	}
+
+	if data.ValidateTeacher(v, teacher); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.modelsFor(r).Teachers.Update(teacher)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "email address already in use")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateSSN):
+			v.AddError("ssn", "a teacher with this SSN already exists")
+			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response, err := a.presentTeacher(r, teacher)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"teacher": response}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -143,7 +325,7 @@ func (a *app) deleteTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.models.Teachers.Delete(int(id))
+	err = a.modelsFor(r).Teachers.Delete(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -162,13 +344,58 @@ func (a *app) deleteTeacherHandler(w http.ResponseWriter, r *http.Request) {
 
 // listTeachersHandler handles GET /v1/teachers
 func (a *app) listTeachersHandler(w http.ResponseWriter, r *http.Request) {
-	teachers, err := a.models.Teachers.GetAll()
+	var input struct {
+		data.TeacherCriteria
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.DistrictID = a.getSingleIntegerParameter(qs, "district_id", 0, v)
+	input.ProfileStatus = a.getSingleQueryParameter(qs, "profile_status", "")
+	input.Gender = a.getSingleQueryParameter(qs, "gender", "")
+	input.InstitutionID = a.getSingleIntegerParameter(qs, "institution_id", 0, v)
+	input.LicenseStatus = a.getSingleQueryParameter(qs, "license_status", "")
+	if input.LicenseStatus != "" {
+		v.Check(validator.PermittedValue(input.LicenseStatus, data.LicenseStatuses...), "license_status", "invalid license status")
+	}
+	input.Search = a.getSingleQueryParameter(qs, "q", "")
+	v.Check(len(input.Search) <= 100, "q", "must not be more than 100 characters long")
+	input.SSN = a.getSingleQueryParameter(qs, "ssn", "")
+	v.Check(len(input.SSN) <= 15, "ssn", "must not be more than 15 characters long")
+
+	input.Filters.Page = a.getSingleIntegerParameter(qs, "page", 1, v)
+	input.Filters.PageSize = a.getSingleIntegerParameter(qs, "page_size", 20, v)
+	input.Filters.Sort = a.getSingleQueryParameter(qs, "sort", "last_name")
+	input.Filters.SortSafelist = data.TeacherSortSafelist
+
+	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Looking teachers up by SSN would reveal it to users who cannot see it
+	if input.SSN != "" {
+		if !a.contextGetPermissions(r).Include(data.PermissionTeachersReadPII) {
+			a.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	teachers, metadata, err := a.modelsFor(r).Teachers.GetAll(input.TeacherCriteria, input.Filters)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	responses, err := a.presentTeachers(r, teachers)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = a.writeJSON(w, http.StatusOK, envelope{"teachers": teachers}, nil)
+	err = a.writeJSON(w, http.StatusOK, envelope{"teachers": responses, "metadata": metadata}, nil)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 	}
@@ -10,6 +10,9 @@ import (
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
+// sessionTTL is how long an authentication token stays valid after login
+const sessionTTL = 24 * time.Hour
+
 // createAuthTokenHandler handles POST /v1/tokens/authentication
 func (a *app) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
@@ -32,9 +35,6 @@ func (a *app) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Default TTL to 24 hours if not provided
-	ttl := 24 * time.Hour
-
 	// Is there an associated user for the provided email?
     user, err := a.models.Users.GetByEmail(input.Email)
     if err != nil {
@@ -47,6 +47,13 @@ func (a *app) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+	// Locked accounts, and accounts still waiting out the delay after a
+	// failed attempt, are turned away before the password is checked.
+	// Otherwise the attempt is reserved, so parallel requests wait too.
+	if a.loginThrottled(w, r, user) {
+		return
+	}
+
 	// The user is found. Does their password match?
 	match, err := user.Password.Matches(input.Password)
     if err != nil {
@@ -56,18 +63,40 @@ func (a *app) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Wrong password
 	if !match {
-		a.invalidCredentialsResponse(w, r)
+		a.failedLoginResponse(w, r, user)
 		return
 	}
 
 	// Is the user activated?
 	if !user.IsActivated {
+		a.releaseLoginAttempt(user)
 		a.inactiveAccountResponse(w, r)
 		return
 	}
 
+	// Users with two-factor authentication, or whose role requires it, must
+	// present a code before they get a session
+	required, err := a.twoFactorRequired(user)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if required {
+		// The attempt is not over until the code is checked, which
+		// reserves an attempt of its own
+		a.releaseLoginAttempt(user)
+		a.startTwoFactorLogin(w, r, user)
+		return
+	}
+
+	err = a.models.Users.RecordLogin(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// Create the token
-	token, err := a.models.Tokens.New(user.ID, ttl, data.ScopeAuthentication)
+	token, err := a.models.Tokens.NewSession(user.ID, sessionTTL, a.clientIP(r), r.UserAgent())
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -79,6 +108,65 @@ func (a *app) createAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// deleteAuthTokenHandler handles DELETE /v1/tokens/authentication. It logs
+// out the token the request was made with.
+func (a *app) deleteAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.models.Tokens.DeleteByPlaintext(data.ScopeAuthentication, a.contextGetToken(r))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSessionsHandler handles GET /v1/me/sessions
+func (a *app) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	sessions, err := a.models.Tokens.GetSessions(user.ID, a.contextGetToken(r))
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler handles DELETE /v1/me/sessions/:id
+func (a *app) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	// Users can only revoke their own sessions
+	err = a.models.Tokens.DeleteSession(user.ID, int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 // createActivationTokenHandler handles POST /v1/tokens/activation
 func (a *app) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
@@ -112,6 +200,61 @@ func (a *app) createActivationTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// createPasswordResetTokenHandler handles POST /v1/tokens/password-reset.
+// The same response is sent whether or not the email belongs to an account
+// so the endpoint cannot be used to discover registered addresses.
+func (a *app) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	response := envelope{"message": "if an account with that email address exists, a password reset token has been sent to it"}
+
+	user, err := a.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Only activated accounts can reset their password
+	if user != nil && user.IsActivated {
+		token, err := a.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+
+		a.background(func() {
+			data := map[string]any{
+				"passwordResetToken": token.Plaintext,
+				"username":           user.Username,
+			}
+
+			err := a.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
 // deleteAllTokensForUserHandler handles DELETE /v1/tokens/user/:user_id
 func (a *app) deleteAllTokensForUserHandler(w http.ResponseWriter, r *http.Request) {
 	userID, err := a.readIDParam(r)
@@ -127,7 +270,7 @@ func (a *app) deleteAllTokensForUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	v := validator.New()
-	v.Check(scope == data.ScopeActivation || scope == data.ScopeAuthentication, "scope", "must be 'activation' or 'authentication'")
+	v.Check(validator.PermittedValue(scope, data.ScopeActivation, data.ScopeAuthentication, data.ScopePasswordReset), "scope", "must be 'activation', 'authentication' or 'password-reset'")
 
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
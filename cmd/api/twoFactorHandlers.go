@@ -0,0 +1,552 @@
+// Filename: cmd/api/twoFactorHandlers.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/totp"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// twoFactorIssuer names the service in authenticator apps
+const twoFactorIssuer = "ImpartBelize"
+
+// twoFactorRequired reports whether the user must present a second factor
+// to log in: either they have enrolled, or their role requires it
+func (a *app) twoFactorRequired(user *data.User) (bool, error) {
+	tf, err := a.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return false, err
+	}
+	if tf.Enabled() {
+		return true, nil
+	}
+
+	role, err := a.models.Roles.Get(user.RoleID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return role.RequiresTwoFactor, nil
+}
+
+// startTwoFactorLogin answers a correct password with a short lived
+// two-factor token instead of a session. A password alone is not enough to
+// enrol, so users whose role requires two-factor authentication but who
+// have not enrolled are emailed an enrolment token instead.
+func (a *app) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, user *data.User) {
+	tf, err := a.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !tf.Enabled() {
+		a.sendTwoFactorEnrolment(w, r, user)
+		return
+	}
+
+	token, err := a.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactor)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"two_factor_required": true, "two_factor_token": token}
+	err = a.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendTwoFactorEnrolment emails the user a token that lets them enrol in
+// two-factor authentication without a session
+func (a *app) sendTwoFactorEnrolment(w http.ResponseWriter, r *http.Request, user *data.User) {
+	token, err := a.models.Tokens.New(user.ID, 30*time.Minute, data.ScopeTwoFactorEnrolment)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"enrolmentToken": token.Plaintext,
+			"username":       user.Username,
+		}
+
+		err := a.mailer.Send(user.Email, "token_two_factor_enrolment.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+
+	env := envelope{
+		"two_factor_required":           true,
+		"two_factor_enrolment_required": true,
+		"message":                       "your account requires two-factor authentication; an enrolment token has been sent to your email address",
+	}
+	err = a.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// newTwoFactorEnrolment stores a fresh secret for the user and returns what
+// they need to add it to an authenticator app
+func (a *app) newTwoFactorEnrolment(user *data.User) (envelope, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.models.TwoFactor.SetSecret(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(secret, twoFactorIssuer, user.Email),
+	}, nil
+}
+
+// checkTwoFactorCode verifies a TOTP code, or a recovery code when
+// allowRecovery is set. Each code is accepted only once.
+func (a *app) checkTwoFactorCode(tf *data.TwoFactor, code string, allowRecovery bool) (bool, error) {
+	if step, ok := totp.Validate(tf.Secret, code, time.Now()); ok {
+		err := a.models.TwoFactor.UseStep(tf.UserID, step)
+		if err != nil {
+			if errors.Is(err, data.ErrTwoFactorCodeUsed) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+	return a.models.TwoFactor.UseRecoveryCode(tf.UserID, code)
+}
+
+// createTwoFactorTokenHandler handles POST /v1/tokens/two-factor. It
+// exchanges the token from the first login step and a code for a session.
+func (a *app) createTwoFactorTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.Token)
+	data.ValidateTwoFactorCode(v, input.Code)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.models.Users.GetForToken(data.ScopeTwoFactor, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired two-factor token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Two-factor tokens are only issued to enrolled users; one whose
+	// enrolment has since been turned off is no longer valid
+	tf, err := a.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !tf.Enabled() {
+		v.AddError("token", "invalid or expired two-factor token")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if a.loginThrottled(w, r, user) {
+		return
+	}
+
+	ok, err := a.checkTwoFactorCode(tf, input.Code, true)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		a.failedLoginResponse(w, r, user)
+		return
+	}
+
+	a.finishTwoFactorLogin(w, r, user, data.ScopeTwoFactor, envelope{})
+}
+
+// finishTwoFactorLogin spends the user's tokens of the given scope and
+// answers with a new session, added to env
+func (a *app) finishTwoFactorLogin(w http.ResponseWriter, r *http.Request, user *data.User, scope string, env envelope) {
+	err := a.models.Tokens.DeleteAllForUser(scope, user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.models.Users.RecordLogin(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := a.models.Tokens.NewSession(user.ID, sessionTTL, a.clientIP(r), r.UserAgent())
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	env["token"] = token
+
+	err = a.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTwoFactorEnrolmentToken reads the enrolment token, and the code when
+// withCode is set, from the request body and returns the user it was
+// emailed to
+func (a *app) readTwoFactorEnrolmentToken(w http.ResponseWriter, r *http.Request, withCode bool) (*data.User, string, bool) {
+	var input struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return nil, "", false
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, input.Token)
+	if withCode {
+		data.ValidateTwoFactorCode(v, input.Code)
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return nil, "", false
+	}
+
+	user, err := a.models.Users.GetForToken(data.ScopeTwoFactorEnrolment, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired enrolment token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, "", false
+	}
+	return user, input.Code, true
+}
+
+// startTwoFactorEnrolmentHandler handles POST /v1/tokens/two-factor-enrolment.
+// It exchanges an emailed enrolment token for a secret and provisioning
+// URI. The token stays valid until enrolment is confirmed.
+func (a *app) startTwoFactorEnrolmentHandler(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := a.readTwoFactorEnrolmentToken(w, r, false)
+	if !ok {
+		return
+	}
+
+	enrolment, err := a.newTwoFactorEnrolment(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			a.invalidTransitionResponse(w, r, err)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"two_factor_enrolment": enrolment}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmTwoFactorEnrolmentHandler handles PUT /v1/tokens/two-factor-enrolment.
+// The enrolment token and a first code turn two-factor authentication on
+// and log the user in; the response includes their recovery codes.
+func (a *app) confirmTwoFactorEnrolmentHandler(w http.ResponseWriter, r *http.Request) {
+	user, code, ok := a.readTwoFactorEnrolmentToken(w, r, true)
+	if !ok {
+		return
+	}
+
+	tf, err := a.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidTransitionResponse(w, r, errors.New("two-factor enrolment has not been started"))
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if tf.Enabled() {
+		a.invalidTransitionResponse(w, r, data.ErrTwoFactorEnabled)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if a.loginThrottled(w, r, user) {
+		return
+	}
+
+	recoveryCodes, ok, err := a.enableTwoFactor(tf, code)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		a.failedLoginResponse(w, r, user)
+		return
+	}
+
+	a.finishTwoFactorLogin(w, r, user, data.ScopeTwoFactorEnrolment, envelope{"recovery_codes": recoveryCodes})
+}
+
+// enableTwoFactor finishes enrolment if code is valid for the pending
+// secret and returns the new recovery codes
+func (a *app) enableTwoFactor(tf *data.TwoFactor, code string) ([]string, bool, error) {
+	step, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+
+	recoveryCodes, err := data.NewRecoveryCodes()
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = a.models.TwoFactor.Enable(tf.UserID, step, recoveryCodes)
+	if err != nil {
+		if errors.Is(err, data.ErrTwoFactorCodeUsed) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return recoveryCodes, true, nil
+}
+
+// beginTwoFactorHandler handles POST /v1/me/two-factor. It starts enrolment
+// and returns the secret and provisioning URI.
+func (a *app) beginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	enrolment, err := a.newTwoFactorEnrolment(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorEnabled):
+			a.invalidTransitionResponse(w, r, err)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"two_factor_enrolment": enrolment}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTwoFactorCode reads and validates the code in a request body
+func (a *app) readTwoFactorCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return "", false
+	}
+
+	v := validator.New()
+	if data.ValidateTwoFactorCode(v, input.Code); !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return "", false
+	}
+	return input.Code, true
+}
+
+// getTwoFactor returns the current user's enrolment, writing a 409 if they
+// have not started one
+func (a *app) getTwoFactor(w http.ResponseWriter, r *http.Request) (*data.TwoFactor, bool) {
+	user := a.contextGetUser(r)
+
+	tf, err := a.models.TwoFactor.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidTransitionResponse(w, r, errors.New("two-factor enrolment has not been started"))
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return tf, true
+}
+
+// confirmTwoFactorHandler handles PUT /v1/me/two-factor. A valid code from
+// the authenticator turns two-factor authentication on.
+func (a *app) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	code, ok := a.readTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	tf, ok := a.getTwoFactor(w, r)
+	if !ok {
+		return
+	}
+	if tf.Enabled() {
+		a.invalidTransitionResponse(w, r, data.ErrTwoFactorEnabled)
+		return
+	}
+
+	recoveryCodes, ok, err := a.enableTwoFactor(tf, code)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		v := validator.New()
+		v.AddError("code", "invalid code")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// regenerateRecoveryCodesHandler handles POST /v1/me/two-factor/recovery-codes
+func (a *app) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	code, ok := a.readTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	tf, ok := a.getTwoFactor(w, r)
+	if !ok {
+		return
+	}
+	if !tf.Enabled() {
+		a.invalidTransitionResponse(w, r, errors.New("two-factor authentication is not enabled"))
+		return
+	}
+
+	// Recovery codes cannot be used to mint new ones
+	valid, err := a.checkTwoFactorCode(tf, code, false)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if !valid {
+		v := validator.New()
+		v.AddError("code", "invalid code")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := data.NewRecoveryCodes()
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.models.TwoFactor.ReplaceRecoveryCodes(tf.UserID, recoveryCodes)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableTwoFactorHandler handles DELETE /v1/me/two-factor. Users whose
+// role requires two-factor authentication cannot turn it off.
+func (a *app) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	code, ok := a.readTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	role, err := a.models.Roles.Get(user.RoleID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+	if role != nil && role.RequiresTwoFactor {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	tf, ok := a.getTwoFactor(w, r)
+	if !ok {
+		return
+	}
+
+	if tf.Enabled() {
+		valid, err := a.checkTwoFactorCode(tf, code, true)
+		if err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+		if !valid {
+			v := validator.New()
+			v.AddError("code", "invalid code")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	err = a.models.TwoFactor.Disable(tf.UserID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication has been disabled"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
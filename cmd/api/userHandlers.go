@@ -49,7 +49,7 @@ func (a *app) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try to insert the user data into the database
-	err = a.models.Users.Insert(user)
+	err = a.modelsFor(r).Users.Insert(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -127,7 +127,7 @@ func (a *app) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	// User provided the right token so activate them
 	a.logger.Info("Activating user", "user_id", user.ID, "username", user.Username, "email", user.Email)
-	err = a.models.Users.UpdateActivation(user.ID, true, true)
+	err = a.modelsFor(r).Users.UpdateActivation(user.ID, true, true)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -162,26 +162,76 @@ func (a *app) activateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getUserHandler retrieves a specific user by ID
-func (a *app) getUserHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the ID from the URL
-	id, err := a.readIDParam(r)
+// updateUserPasswordHandler handles PUT /v1/users/password. It sets a new
+// password using a password reset token and signs the user out everywhere.
+func (a *app) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := a.readJSON(w, r, &input)
 	if err != nil {
-		a.notFoundResponse(w, r)
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// Get the current user from context
-	currentUser := a.contextGetUser(r)
+	user, err := a.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
 
-	// Check if the current user can access this user's data
-	canAccess, err := a.canAccessUserData(currentUser, id)
+	err = user.Password.Set(input.Password)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if !canAccess {
+	// Also revokes every authentication token and password reset token
+	err = a.modelsFor(r).Users.ResetPassword(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// getUserHandler retrieves a specific user by ID
+func (a *app) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the ID from the URL
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	// Check if the current user can access this user's data
+	if !a.canAccessUserData(r, id, data.PermissionUsersRead) {
 		a.notPermittedResponse(w, r)
 		return
 	}
@@ -249,44 +299,26 @@ func (a *app) getAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Parse query parameters for pagination and filtering
 	var input struct {
-		RegionID    int
-		FormationID int
-		RankID      int
-		IsActive    *bool
-		LastName    string
-		Username    string
+		data.UserCriteria
 		data.Filters
 	}
 
 	v := validator.New()
 
 	// Parse filter parameters
-	input.RegionID = a.getSingleIntegerParameter(qs, "region_id", 0, v)
-	input.FormationID = a.getSingleIntegerParameter(qs, "formation_id", 0, v)
-	input.RankID = a.getSingleIntegerParameter(qs, "rank_id", 0, v)
-	input.LastName = a.getSingleQueryParameter(qs, "last_name", "")
+	input.RoleID = a.getSingleIntegerParameter(qs, "role_id", 0, v)
+	input.DistrictID = a.getSingleIntegerParameter(qs, "district_id", 0, v)
+	input.IsActive = a.getOptionalBoolParameter(qs, "is_active", v)
+	input.IsActivated = a.getOptionalBoolParameter(qs, "is_activated", v)
 	input.Username = a.getSingleQueryParameter(qs, "username", "")
 
-	// Parse is_active parameter
-	if activeStr := qs.Get("is_active"); activeStr != "" {
-		if activeStr == "true" {
-			active := true
-			input.IsActive = &active
-		} else if activeStr == "false" {
-			active := false
-			input.IsActive = &active
-		} else {
-			v.AddError("is_active", "must be true or false")
-		}
-	}
-
 	// Parse pagination parameters
 	input.Filters.Page = a.getSingleIntegerParameter(qs, "page", 1, v)
 	input.Filters.PageSize = a.getSingleIntegerParameter(qs, "page_size", 20, v)
 
 	// Parse sort parameter
 	input.Filters.Sort = a.getSingleQueryParameter(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "user_id", "last_name", "first_name", "username", "email", "created_at", "-id", "-user_id", "-last_name", "-first_name", "-username", "-email", "-created_at"}
+	input.Filters.SortSafelist = data.UserSortSafelist
 
 	// Validate filters
 	if data.ValidateFilters(v, input.Filters); !v.IsEmpty() {
@@ -295,7 +327,7 @@ func (a *app) getAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get users from database
-	users, metadata, err := a.models.Users.GetAll(input.RegionID, input.FormationID, input.RankID, input.IsActive, input.LastName, input.Username, input.Filters)
+	users, metadata, err := a.models.Users.GetAll(input.UserCriteria, input.Filters)
 	if err != nil {
 		a.serverErrorResponse(w, r, err)
 		return
@@ -320,33 +352,12 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the current user from context
-	currentUser := a.contextGetUser(r)
-
 	// Check if the current user can access this user's data
-	canAccess, err := a.canAccessUserData(currentUser, id)
-	if err != nil {
-		a.serverErrorResponse(w, r, err)
-		return
-	}
-
-	if !canAccess {
+	if !a.canAccessUserData(r, id, data.PermissionUsersUpdate) {
 		a.notPermittedResponse(w, r)
 		return
 	}
 
-	// Get the existing user from the database
-	user, err := a.models.Users.Get(int(id))
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			a.notFoundResponse(w, r)
-		default:
-			a.serverErrorResponse(w, r, err)
-		}
-		return
-	}
-
 	// Parse the request body for updates
 	var input struct {
 		Username    *string `json:"username"`
@@ -363,17 +374,35 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is trying to update role_id/is_active/is_activated and is not an Administrator
-	if input.RoleID != nil || input.IsActive != nil || input.IsActivated != nil {
-		// Get the current user's role
-		currentUserRole, err := a.models.Roles.Get(currentUser.RoleID)
-		if err != nil {
-			a.serverErrorResponse(w, r, err)
+	// Users change their own email and password through PATCH /v1/me,
+	// which asks for the current password first. Nobody sets another
+	// user's password: they reset it themselves by email. Only
+	// administrators can move another account to a new email address.
+	if input.Email != nil || input.Password != nil {
+		self := id == a.contextGetUser(r).ID
+		v := validator.New()
+		switch {
+		case self && input.Email != nil:
+			v.AddError("email", "change your own email through PATCH /v1/me")
+		case input.Email != nil && !a.contextGetPermissions(r).Include(data.PermissionUsersManage):
+			v.AddError("email", "only administrators can change another user's email")
+		}
+		switch {
+		case self && input.Password != nil:
+			v.AddError("password", "change your own password through PATCH /v1/me")
+		case input.Password != nil:
+			v.AddError("password", "cannot be set for another user; they can reset it through POST /v1/tokens/password-reset")
+		}
+		if !v.IsEmpty() {
+			a.failedValidationResponse(w, r, v.Errors)
 			return
 		}
+	}
 
+	// Check if user is trying to update role_id/is_active/is_activated and is not an Administrator
+	if input.RoleID != nil || input.IsActive != nil || input.IsActivated != nil {
 		// Only Administrators can change roles or activation status
-		if currentUserRole.RoleName != "Administrator" && currentUserRole.RoleName != "admin" {
+		if !a.contextGetPermissions(r).Include(data.PermissionUsersManage) {
 			v := validator.New()
 			if input.RoleID != nil {
 				v.AddError("role_id", "only administrators can change user roles")
@@ -389,12 +418,26 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Get the existing user from the database
+	user, err := a.models.Users.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	// Update only the fields that were provided
 	if input.Username != nil {
 		user.Username = *input.Username
 	}
-	if input.Email != nil {
+	emailChanged := input.Email != nil && *input.Email != user.Email
+	if emailChanged {
 		user.Email = *input.Email
+		user.IsActivated = false
 	}
 	if input.RoleID != nil {
 		user.RoleID = *input.RoleID
@@ -402,19 +445,10 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	if input.IsActive != nil {
 		user.IsActive = *input.IsActive
 	}
-	if input.IsActivated != nil {
+	if input.IsActivated != nil && !emailChanged {
 		user.IsActivated = *input.IsActivated
 	}
 
-	// Update password if provided
-	if input.Password != nil {
-		err = user.Password.Set(*input.Password)
-		if err != nil {
-			a.serverErrorResponse(w, r, err)
-			return
-		}
-	}
-
 	// Validate the updated user data
 	v := validator.New()
 	if data.ValidateUser(v, user); !v.IsEmpty() {
@@ -423,7 +457,7 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try to update the user in the database
-	err = a.models.Users.Update(user)
+	err = a.modelsFor(r).Users.Update(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
@@ -437,6 +471,13 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if emailChanged {
+		if err = a.sendEmailChangedActivation(user); err != nil {
+			a.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	response := envelope{
 		"user": user,
 	}
@@ -446,7 +487,36 @@ func (a *app) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// deleteUserHandler soft deletes a user (sets is_active to false)
+// sendEmailChangedActivation emails a new activation token to the user's
+// new address. Tokens sent to the old address are revoked so they cannot
+// activate the new one.
+func (a *app) sendEmailChangedActivation(user *data.User) error {
+	err := a.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := a.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	a.background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+			"username":        user.Username,
+		}
+
+		err := a.mailer.Send(user.Email, "user_email_changed.tmpl", data)
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+	return nil
+}
+
+// deleteUserHandler soft deletes a user and signs them out. Admins can
+// restore or purge them through /v1/deleted.
 func (a *app) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the ID from the URL
 	id, err := a.readIDParam(r)
@@ -456,7 +526,7 @@ func (a *app) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Try to delete the user from the database
-	err = a.models.Users.Delete(int(id))
+	err = a.modelsFor(r).Users.Delete(int(id))
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -475,3 +545,94 @@ func (a *app) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		a.serverErrorResponse(w, r, err)
 	}
 }
+
+// getUserDistrictsHandler handles GET /v1/users/:id/districts
+func (a *app) getUserDistrictsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.models.Users.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	districtIDs, err := a.models.Users.GetDistricts(user.ID)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"district_ids": districtIDs}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateUserDistrictsHandler handles PATCH /v1/users/:id/districts. The
+// districts sent replace the ones the user was assigned to before.
+func (a *app) updateUserDistrictsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		DistrictIDs []int `json:"district_ids"`
+	}
+
+	err = a.readJSON(w, r, &input)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.DistrictIDs != nil, "district_ids", "must be provided")
+	seen := make(map[int]bool, len(input.DistrictIDs))
+	for _, districtID := range input.DistrictIDs {
+		v.Check(!seen[districtID], "district_ids", "must not contain duplicate values")
+		seen[districtID] = true
+	}
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.models.Users.Get(int(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.modelsFor(r).Users.SetDistricts(user.ID, input.DistrictIDs...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("district_ids", "must only contain existing districts")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.writeJSON(w, http.StatusOK, envelope{"district_ids": input.DistrictIDs}, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
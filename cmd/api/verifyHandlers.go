@@ -0,0 +1,77 @@
+// Filename: cmd/api/verifyHandlers.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// verifyLicenseHandler handles GET /v1/verify/:license_number. It is public
+// and only returns the holder's name, class, level, status and expiry. When
+// a ?code= query parameter is given it also reports whether that code was
+// signed for this license. Codes are only issued and accepted while the
+// license is active.
+func (a *app) verifyLicenseHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	licenseNumber := strings.ToUpper(strings.TrimSpace(params.ByName("license_number")))
+
+	// Anything that is not shaped like a license number cannot exist
+	if !validator.Matches(licenseNumber, data.LicenseNumberRX) {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	verification, err := a.models.Licenses.GetVerification(licenseNumber)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	response := envelope{"license": verification}
+	if a.signer != nil {
+		payload := verification.SigningPayload()
+		if verification.Signed() {
+			response["verification_code"] = a.signer.Encode(payload)
+		}
+
+		code := a.getSingleQueryParameter(r.URL.Query(), "code", "")
+		if code != "" {
+			response["code_valid"] = verification.Signed() && a.signer.Matches(code, payload)
+		}
+	}
+
+	err = a.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
+
+// verificationKeyHandler handles GET /v1/verification-key. The public key
+// lets certificate verification codes be checked offline.
+func (a *app) verificationKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if a.signer == nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	response := envelope{
+		"algorithm":  "ed25519",
+		"public_key": a.signer.PublicKey(),
+		"format":     "base64url(payload).base64url(signature), payload fields joined with |",
+	}
+
+	err := a.writeJSON(w, http.StatusOK, response, nil)
+	if err != nil {
+		a.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,134 @@
+// Filename: cmd/api/views.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+)
+
+// Teacher profiles are shaped to the user reading them before they are
+// written out. The views are defined by data.Teacher.Project; this file
+// decides which view a request gets. data.Teacher has no JSON encoding of
+// its own, so the only way to write a teacher is as a teacherResponse,
+// and the only way to build one is through the reader's view.
+
+// teacherResponse is a teacher profile as written to a client
+type teacherResponse struct {
+	ID            int        `json:"teacher_id"`
+	UserID        int        `json:"user_id,omitempty"`
+	FirstName     string     `json:"first_name"`
+	LastName      string     `json:"last_name"`
+	Gender        string     `json:"gender,omitempty"`
+	DOB           *time.Time `json:"dob,omitempty"`
+	SSN           string     `json:"ssn,omitempty"`
+	MaritalStatus string     `json:"marital_status,omitempty"`
+	Email         string     `json:"email"`
+	Address       string     `json:"address,omitempty"`
+	DistrictID    int        `json:"district_id,omitempty"`
+	Phone         string     `json:"phone,omitempty"`
+	ProfileStatus string     `json:"profile_status,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Version       int        `json:"version,omitempty"`
+}
+
+// teacherViewer holds what decides a user's view of a teacher
+type teacherViewer struct {
+	readPII   bool
+	staff     bool
+	teacherID int // the user's own teacher profile, if any
+}
+
+// teacherViewerFor works out the request's user's standing towards teacher
+// profiles
+func (a *app) teacherViewerFor(r *http.Request) (teacherViewer, error) {
+	permissions := a.contextGetPermissions(r)
+
+	viewer := teacherViewer{
+		readPII: permissions.Include(data.PermissionTeachersReadPII),
+		staff:   permissions.Include(data.PermissionTeachersManage),
+	}
+
+	// Users who see every field need not be told their own profile apart
+	if viewer.readPII {
+		return viewer, nil
+	}
+
+	teacher, err := a.models.Unscoped().Teachers.GetByUserID(int(a.contextGetUser(r).ID))
+	switch {
+	case err == nil:
+		viewer.teacherID = teacher.ID
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return teacherViewer{}, err
+	}
+	return viewer, nil
+}
+
+// viewOf returns the view the user gets of the teacher. Permission to see
+// sensitive fields comes first, then the teacher's own profile, then
+// staff; everyone else sees the directory.
+func (v teacherViewer) viewOf(teacher *data.Teacher) data.TeacherView {
+	switch {
+	case v.readPII:
+		return data.TeacherViewFull
+	case v.teacherID > 0 && v.teacherID == teacher.ID:
+		return data.TeacherViewOwner
+	case v.staff:
+		return data.TeacherViewStaff
+	default:
+		return data.TeacherViewDirectory
+	}
+}
+
+// present returns the user's view of the teacher, ready to be written out.
+// The teacher itself is left unchanged.
+func (v teacherViewer) present(teacher *data.Teacher) *teacherResponse {
+	t := *teacher
+	t.Project(v.viewOf(teacher))
+
+	return &teacherResponse{
+		ID:            t.ID,
+		UserID:        t.UserID,
+		FirstName:     t.FirstName,
+		LastName:      t.LastName,
+		Gender:        t.Gender,
+		DOB:           t.DOB,
+		SSN:           t.SSN,
+		MaritalStatus: t.MaritalStatus,
+		Email:         t.Email,
+		Address:       t.Address,
+		DistrictID:    t.DistrictID,
+		Phone:         t.Phone,
+		ProfileStatus: t.ProfileStatus,
+		CreatedAt:     t.CreatedAt,
+		Version:       t.Version,
+	}
+}
+
+// presentTeacher returns the request's user's view of the teacher, or nil
+// if teacher is nil
+func (a *app) presentTeacher(r *http.Request, teacher *data.Teacher) (*teacherResponse, error) {
+	if teacher == nil {
+		return nil, nil
+	}
+	viewer, err := a.teacherViewerFor(r)
+	if err != nil {
+		return nil, err
+	}
+	return viewer.present(teacher), nil
+}
+
+// presentTeachers returns the request's user's view of each teacher
+func (a *app) presentTeachers(r *http.Request, teachers []*data.Teacher) ([]*teacherResponse, error) {
+	viewer, err := a.teacherViewerFor(r)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]*teacherResponse, len(teachers))
+	for i, teacher := range teachers {
+		responses[i] = viewer.present(teacher)
+	}
+	return responses, nil
+}
@@ -0,0 +1,199 @@
+// Filename: cmd/auditverify/main.go
+
+// auditverify walks the audit_events hash chain and reports the first
+// broken link. It can also check previously exported checkpoints against
+// the database and append a signed checkpoint of the current chain head,
+// for copying off-site. Run it periodically, for example from cron:
+//
+//	auditverify -checkpoints /var/lib/impart/audit-checkpoints.jsonl -export
+//
+// It exits with status 1 if the chain or any checkpoint fails to verify.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/signer"
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+// checkpoint is one line of the checkpoints file. Code is the signed
+// payload; the other fields repeat it in readable form and are not
+// trusted when checking.
+type checkpoint struct {
+	data.AuditCheckpoint
+	SignedAt time.Time `json:"signed_at"`
+	Code     string    `json:"code"`
+}
+
+func main() {
+	var (
+		dsn         string
+		signingKey  string
+		checkpoints string
+		export      bool
+	)
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&signingKey, "signing-key", os.Getenv("AUDIT_SIGNING_KEY"), "Base64 ed25519 seed used to sign checkpoints")
+	flag.StringVar(&checkpoints, "checkpoints", "", "File of signed checkpoints to check and export to (one JSON object per line)")
+	flag.BoolVar(&export, "export", false, "Append a signed checkpoint of the chain head to the checkpoints file")
+	flag.Parse()
+
+	if err := run(dsn, signingKey, checkpoints, export); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn, signingKey, checkpoints string, export bool) error {
+	if checkpoints != "" && signingKey == "" {
+		return errors.New("a signing key is required to check or export checkpoints")
+	}
+	if export && checkpoints == "" {
+		return errors.New("-export needs a -checkpoints file")
+	}
+
+	db, err := openDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	audit := data.NewModels(db, nil).Audit
+
+	report, err := audit.VerifyChain()
+	if err != nil {
+		return err
+	}
+	if report.Unchained > 0 {
+		fmt.Printf("skipped %d events written before the chain began\n", report.Unchained)
+	}
+	if report.BrokenAt != 0 {
+		return fmt.Errorf("chain broken at audit event %d: %s (%d events verified before it)", report.BrokenAt, report.Reason, report.Checked)
+	}
+	fmt.Printf("verified %d events\n", report.Checked)
+
+	if checkpoints == "" {
+		return nil
+	}
+
+	s, err := signer.New(signingKey)
+	if err != nil {
+		return err
+	}
+
+	if err = checkCheckpoints(audit, s, checkpoints); err != nil {
+		return err
+	}
+
+	if export {
+		if report.Head == nil {
+			fmt.Println("no chained events to checkpoint")
+			return nil
+		}
+		if err = exportCheckpoint(s, checkpoints, *report.Head); err != nil {
+			return err
+		}
+		fmt.Printf("exported checkpoint at audit event %d\n", report.Head.EventID)
+	}
+	return nil
+}
+
+// checkCheckpoints checks every signed checkpoint in the file still
+// matches the chain. A missing file has nothing to check.
+func checkCheckpoints(audit *data.AuditModel, s *signer.Signer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	checked := 0
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var cp checkpoint
+		if err := json.Unmarshal(scanner.Bytes(), &cp); err != nil {
+			return fmt.Errorf("checkpoint on line %d: %w", line, err)
+		}
+
+		payload, err := s.Decode(cp.Code)
+		if err != nil {
+			return fmt.Errorf("checkpoint on line %d: %w", line, err)
+		}
+		var signed data.AuditCheckpoint
+		if err := json.Unmarshal(payload, &signed); err != nil {
+			return fmt.Errorf("checkpoint on line %d: %w", line, err)
+		}
+
+		ok, err := audit.MatchesCheckpoint(signed)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("checkpoint on line %d no longer matches audit event %d", line, signed.EventID)
+		}
+		checked++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %d checkpoints\n", checked)
+	return nil
+}
+
+// exportCheckpoint appends a signed checkpoint of head to the file
+func exportCheckpoint(s *signer.Signer, path string, head data.AuditCheckpoint) error {
+	payload, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(checkpoint{
+		AuditCheckpoint: head,
+		SignedAt:        time.Now().UTC(),
+		Code:            s.Encode(payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openDB connects to PostgreSQL and checks the connection
+func openDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,90 @@
+// Filename: cmd/rekey/main.go
+
+// rekey encrypts teachers' SSNs, dates of birth and addresses, and users'
+// two-factor secrets, that are still stored in plaintext, and reseals
+// values sealed with an old key under the primary key. Run it once after enabling encryption and again
+// after adding a new primary key; an old key can be removed from the
+// configuration once rekey has finished.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/data"
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
+	_ "github.com/lib/pq" // PostgreSQL driver
+)
+
+func main() {
+	var (
+		dsn       string
+		keys      string
+		indexKey  string
+		batchSize int
+	)
+	flag.StringVar(&dsn, "db-dsn", os.Getenv("DB_DSN"), "PostgreSQL DSN")
+	flag.StringVar(&keys, "encryption-keys", os.Getenv("FIELD_ENCRYPTION_KEYS"), "Comma separated name:base64 AES-256 keys; the first seals new values")
+	flag.StringVar(&indexKey, "encryption-index-key", os.Getenv("FIELD_INDEX_KEY"), "Base64 key (at least 32 bytes) for blind indexes")
+	flag.IntVar(&batchSize, "batch-size", 500, "Records resealed per batch")
+	flag.Parse()
+
+	if err := run(dsn, keys, indexKey, batchSize); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dsn, keys, indexKey string, batchSize int) error {
+	keyring, err := encryption.New(keys, indexKey)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	models := data.NewModels(db, keyring)
+
+	teachers, err := reseal(models.Teachers.Reseal, batchSize)
+	if err != nil {
+		return fmt.Errorf("resealed %d teachers before failing: %w", teachers, err)
+	}
+	fmt.Printf("resealed %d teachers with key %q\n", teachers, keyring.Primary())
+
+	secrets, err := reseal(models.TwoFactor.Reseal, batchSize)
+	if err != nil {
+		return fmt.Errorf("resealed %d two-factor secrets before failing: %w", secrets, err)
+	}
+	fmt.Printf("resealed %d two-factor secrets with key %q\n", secrets, keyring.Primary())
+	return nil
+}
+
+// reseal calls fn with batches of batchSize until it has nothing left and
+// returns the total resealed
+func reseal(fn func(limit int) (int, error), batchSize int) (int, error) {
+	total := 0
+	for {
+		n, err := fn(batchSize)
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, nil
+		}
+		total += n
+	}
+}
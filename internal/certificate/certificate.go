@@ -0,0 +1,137 @@
+// Filename: internal/certificate/certificate.go
+package certificate
+
+import (
+	"bytes"
+	"embed"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/go-pdf/fpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// the certificate wording lives in templates so it can be changed without
+// touching the layout code
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// License holds what is printed on a license certificate. Dates are
+// pre-formatted by the caller.
+type License struct {
+	Name          string
+	LicenseNumber string
+	LicenseClass  string
+	Level         string
+	IssueDate     string
+	ExpiryDate    string
+	VerifyURL     string
+	// VerificationCode is the signed code printed under the footer. When set
+	// it is also appended to the QR code's URL so scanning checks it.
+	VerificationCode string
+}
+
+// Render writes a one page A4 landscape certificate to w. The QR code
+// encodes VerifyURL and the verification code.
+func Render(w io.Writer, license License) error {
+	tmpl, err := template.New("certificate").ParseFS(templateFS, "templates/license_certificate.tmpl")
+	if err != nil {
+		return err
+	}
+
+	text := func(name string) (string, error) {
+		buf := new(bytes.Buffer)
+		if err := tmpl.ExecuteTemplate(buf, name, license); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+
+	parts := map[string]string{}
+	for _, name := range []string{"authority", "title", "preamble", "body", "number", "footer"} {
+		parts[name], err = text(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	qrContent := license.VerifyURL
+	if license.VerificationCode != "" {
+		qrContent += "?code=" + url.QueryEscape(license.VerificationCode)
+	}
+
+	qr, err := qrcode.Encode(qrContent, qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle(parts["title"]+" "+license.LicenseNumber, true)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+
+	// the core fonts are Latin-1, so accented names need translating
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+
+	// double border
+	pdf.SetDrawColor(0, 51, 102)
+	pdf.SetLineWidth(1.5)
+	pdf.Rect(10, 10, pageWidth-20, pageHeight-20, "D")
+	pdf.SetLineWidth(0.4)
+	pdf.Rect(14, 14, pageWidth-28, pageHeight-28, "D")
+
+	pdf.SetTextColor(0, 51, 102)
+	pdf.SetFont("Helvetica", "", 14)
+	pdf.SetXY(20, 28)
+	pdf.CellFormat(pageWidth-40, 8, tr(parts["authority"]), "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "B", 34)
+	pdf.SetXY(20, 42)
+	pdf.CellFormat(pageWidth-40, 16, tr(parts["title"]), "", 1, "C", false, 0, "")
+
+	pdf.SetTextColor(40, 40, 40)
+	pdf.SetFont("Helvetica", "I", 14)
+	pdf.SetXY(20, 72)
+	pdf.CellFormat(pageWidth-40, 8, tr(parts["preamble"]), "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "B", 26)
+	pdf.SetXY(20, 84)
+	pdf.CellFormat(pageWidth-40, 14, tr(license.Name), "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 13)
+	pdf.SetXY(45, 104)
+	pdf.MultiCell(pageWidth-90, 7, tr(parts["body"]), "", "C", false)
+
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetXY(20, 128)
+	pdf.CellFormat(pageWidth-40, 8, tr(parts["number"]), "", 1, "C", false, 0, "")
+
+	// QR code in the bottom right corner
+	qrSize := 40.0
+	pdf.RegisterImageOptionsReader("qr", fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(qr))
+	pdf.ImageOptions("qr", pageWidth-24-qrSize, pageHeight-24-qrSize, qrSize, qrSize, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	// signature line in the bottom left corner
+	pdf.SetDrawColor(40, 40, 40)
+	pdf.Line(30, pageHeight-40, 110, pageHeight-40)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.SetXY(30, pageHeight-38)
+	pdf.CellFormat(80, 6, "Chief Executive Officer", "", 1, "C", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetXY(30, pageHeight-26)
+	pdf.CellFormat(pageWidth-60-qrSize, 5, tr(parts["footer"]), "", 1, "L", false, 0, "")
+
+	if license.VerificationCode != "" {
+		pdf.SetFont("Courier", "", 6)
+		pdf.SetXY(30, pageHeight-21)
+		pdf.MultiCell(pageWidth-60-qrSize, 3, license.VerificationCode, "", "L", false)
+	}
+
+	return pdf.Output(w)
+}
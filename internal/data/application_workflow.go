@@ -0,0 +1,289 @@
+// Filename: internal/data/application_workflow.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Approval stages an application passes through while under review. The
+// District Education Center reviews first, then the Teacher Service
+// Commission, and the CEO makes the final decision.
+const (
+	ReviewStageDEC = "dec"
+	ReviewStageTSC = "tsc"
+	ReviewStageCEO = "ceo"
+)
+
+// Actions that move an application through the approval workflow
+const (
+	ApplicationActionSubmit      = "submit"
+	ApplicationActionStartReview = "start_review"
+	ApplicationActionForward     = "forward"
+	ApplicationActionApprove     = "approve"
+	ApplicationActionReject      = "reject"
+	ApplicationActionReturn      = "return"
+	ApplicationActionWithdraw    = "withdraw"
+)
+
+// ApplicationActions lists every workflow action
+var ApplicationActions = []string{
+	ApplicationActionSubmit,
+	ApplicationActionStartReview,
+	ApplicationActionForward,
+	ApplicationActionApprove,
+	ApplicationActionReject,
+	ApplicationActionReturn,
+	ApplicationActionWithdraw,
+}
+
+var ErrTransitionNotPermitted = errors.New("the action is not permitted for this user")
+
+// ApplicationState is a position in the workflow. Stage is only set while
+// the application is under review.
+type ApplicationState struct {
+	Status string
+	Stage  string
+}
+
+// applicationTransition is one edge of the workflow state machine. The
+// permission is the one a user needs to take it.
+type applicationTransition struct {
+	action     string
+	from       ApplicationState
+	to         ApplicationState
+	permission string
+}
+
+var (
+	stateDraft     = ApplicationState{Status: ApplicationStatusDraft}
+	stateSubmitted = ApplicationState{Status: ApplicationStatusSubmitted}
+	stateDECReview = ApplicationState{Status: ApplicationStatusUnderReview, Stage: ReviewStageDEC}
+	stateTSCReview = ApplicationState{Status: ApplicationStatusUnderReview, Stage: ReviewStageTSC}
+	stateCEOReview = ApplicationState{Status: ApplicationStatusUnderReview, Stage: ReviewStageCEO}
+	stateApproved  = ApplicationState{Status: ApplicationStatusApproved}
+	stateRejected  = ApplicationState{Status: ApplicationStatusRejected}
+	stateWithdrawn = ApplicationState{Status: ApplicationStatusWithdrawn}
+)
+
+// applicationTransitions defines every legal move and the permission
+// needed to make it. Each review stage has its own permission, so a stage
+// belongs to whichever roles are granted it.
+var applicationTransitions = []applicationTransition{
+	{action: ApplicationActionSubmit, from: stateDraft, to: stateSubmitted, permission: PermissionApplicationsSubmit},
+
+	{action: ApplicationActionStartReview, from: stateSubmitted, to: stateDECReview, permission: PermissionApplicationsReviewDEC},
+	{action: ApplicationActionForward, from: stateDECReview, to: stateTSCReview, permission: PermissionApplicationsReviewDEC},
+	{action: ApplicationActionForward, from: stateTSCReview, to: stateCEOReview, permission: PermissionApplicationsReviewTSC},
+	{action: ApplicationActionApprove, from: stateCEOReview, to: stateApproved, permission: PermissionApplicationsApprove},
+
+	{action: ApplicationActionReject, from: stateDECReview, to: stateRejected, permission: PermissionApplicationsReviewDEC},
+	{action: ApplicationActionReject, from: stateTSCReview, to: stateRejected, permission: PermissionApplicationsReviewTSC},
+	{action: ApplicationActionReject, from: stateCEOReview, to: stateRejected, permission: PermissionApplicationsApprove},
+
+	{action: ApplicationActionReturn, from: stateDECReview, to: stateDraft, permission: PermissionApplicationsReviewDEC},
+	{action: ApplicationActionReturn, from: stateTSCReview, to: stateDraft, permission: PermissionApplicationsReviewTSC},
+	{action: ApplicationActionReturn, from: stateCEOReview, to: stateDraft, permission: PermissionApplicationsApprove},
+
+	{action: ApplicationActionWithdraw, from: stateDraft, to: stateWithdrawn, permission: PermissionApplicationsWithdraw},
+	{action: ApplicationActionWithdraw, from: stateSubmitted, to: stateWithdrawn, permission: PermissionApplicationsWithdraw},
+	{action: ApplicationActionWithdraw, from: stateDECReview, to: stateWithdrawn, permission: PermissionApplicationsWithdraw},
+	{action: ApplicationActionWithdraw, from: stateTSCReview, to: stateWithdrawn, permission: PermissionApplicationsWithdraw},
+	{action: ApplicationActionWithdraw, from: stateCEOReview, to: stateWithdrawn, permission: PermissionApplicationsWithdraw},
+}
+
+// NextApplicationState returns the state reached by applying action from
+// the given state as a user holding permissions. ErrInvalidTransition is
+// returned when the action is not legal from that state at all, and
+// ErrTransitionNotPermitted when it is legal but the user lacks the
+// permission for it.
+func NextApplicationState(from ApplicationState, action string, permissions Permissions) (ApplicationState, error) {
+	legal := false
+	for _, t := range applicationTransitions {
+		if t.action != action || t.from != from {
+			continue
+		}
+		legal = true
+		if permissions.Include(t.permission) {
+			return t.to, nil
+		}
+	}
+	if legal {
+		return ApplicationState{}, ErrTransitionNotPermitted
+	}
+	return ApplicationState{}, ErrInvalidTransition
+}
+
+// AvailableApplicationActions returns the actions a user holding
+// permissions may take from the given state
+func AvailableApplicationActions(from ApplicationState, permissions Permissions) []string {
+	actions := []string{}
+	for _, t := range applicationTransitions {
+		if t.from == from && permissions.Include(t.permission) && !slices.Contains(actions, t.action) {
+			actions = append(actions, t.action)
+		}
+	}
+	return actions
+}
+
+// ApplicationTransition records one step an application took through the workflow
+type ApplicationTransition struct {
+	ID            int       `json:"transition_id"`
+	ApplicationID int       `json:"application_id"`
+	Action        string    `json:"action"`
+	FromStatus    string    `json:"from_status"`
+	FromStage     string    `json:"from_stage,omitempty"`
+	ToStatus      string    `json:"to_status"`
+	ToStage       string    `json:"to_stage,omitempty"`
+	ActorID       int       `json:"actor_id,omitempty"`
+	ActorRole     string    `json:"actor_role"`
+	Comment       string    `json:"comment,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// State returns the application's current position in the workflow
+func (app *Application) State() ApplicationState {
+	return ApplicationState{Status: app.Status, Stage: app.ReviewStage}
+}
+
+// Transition applies a workflow action to the application and records it in
+// the transition history. The actor's permissions decide whether they may
+// take the action; their role is recorded in the history. Both writes
+// happen in one transaction. The application's version must match the
+// stored version or ErrEditConflict is returned.
+func (m *ApplicationModel) Transition(app *Application, action string, actorID int, actorRole string, permissions Permissions, comment string) (*ApplicationTransition, error) {
+	from := app.State()
+	to, err := NextApplicationState(from, action, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	app.Status = to.Status
+	app.ReviewStage = to.Stage
+	switch {
+	case to.Status == ApplicationStatusSubmitted:
+		app.SubmittedAt = &now
+		app.DecidedAt = nil
+	case to.Status == ApplicationStatusApproved || to.Status == ApplicationStatusRejected:
+		app.DecidedAt = &now
+	}
+	// Reviewer actions are attributed to the application
+	if action != ApplicationActionSubmit && action != ApplicationActionWithdraw {
+		app.ReviewedBy = actorID
+	}
+
+	transition := &ApplicationTransition{
+		ApplicationID: app.ID,
+		Action:        action,
+		FromStatus:    from.Status,
+		FromStage:     from.Stage,
+		ToStatus:      to.Status,
+		ToStage:       to.Stage,
+		ActorID:       actorID,
+		ActorRole:     actorRole,
+		Comment:       comment,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE applications
+		SET status = $1, review_stage = $2, submitted_at = $3, decided_at = $4, reviewed_by = $5,
+		    updated_at = NOW(), version = version + 1
+		WHERE application_id = $6 AND version = $7
+		RETURNING updated_at, version`
+
+	args := []interface{}{
+		app.Status,
+		nullString(app.ReviewStage),
+		nullTime(app.SubmittedAt),
+		nullTime(app.DecidedAt),
+		nullInt(app.ReviewedBy),
+		app.ID,
+		app.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&app.UpdatedAt, &app.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+		INSERT INTO application_transitions (application_id, action, from_status, from_stage, to_status, to_stage, actor_id, actor_role, comment)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING transition_id, created_at`
+
+	args = []interface{}{
+		transition.ApplicationID,
+		transition.Action,
+		transition.FromStatus,
+		nullString(transition.FromStage),
+		transition.ToStatus,
+		nullString(transition.ToStage),
+		nullInt(transition.ActorID),
+		transition.ActorRole,
+		transition.Comment,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&transition.ID, &transition.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return transition, nil
+}
+
+// GetTransitions returns the workflow history of an application, oldest first
+func (m *ApplicationModel) GetTransitions(applicationID int) ([]*ApplicationTransition, error) {
+	query := `
+		SELECT transition_id, application_id, action, from_status, COALESCE(from_stage, ''), to_status,
+		       COALESCE(to_stage, ''), actor_id, actor_role, COALESCE(comment, ''), created_at
+		FROM application_transitions
+		WHERE application_id = $1
+		ORDER BY created_at, transition_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*ApplicationTransition{}
+	for rows.Next() {
+		var t ApplicationTransition
+		var actorID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.ApplicationID, &t.Action, &t.FromStatus, &t.FromStage, &t.ToStatus, &t.ToStage, &actorID, &t.ActorRole, &t.Comment, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			t.ActorID = int(actorID.Int64)
+		}
+		out = append(out, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
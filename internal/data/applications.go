@@ -0,0 +1,314 @@
+// Filename: internal/data/applications.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// Lifecycle states of a license application
+const (
+	ApplicationStatusDraft       = "draft"
+	ApplicationStatusSubmitted   = "submitted"
+	ApplicationStatusUnderReview = "under_review"
+	ApplicationStatusApproved    = "approved"
+	ApplicationStatusRejected    = "rejected"
+	ApplicationStatusWithdrawn   = "withdrawn"
+)
+
+// ApplicationStatuses lists every valid application status
+var ApplicationStatuses = []string{
+	ApplicationStatusDraft,
+	ApplicationStatusSubmitted,
+	ApplicationStatusUnderReview,
+	ApplicationStatusApproved,
+	ApplicationStatusRejected,
+	ApplicationStatusWithdrawn,
+}
+
+// Application is a teacher's request for a teaching license
+type Application struct {
+	ID            int        `json:"application_id"`
+	TeacherID     int        `json:"teacher_id"`
+	LicenseTypeID int        `json:"license_type_id"`
+	LicenseClass  string     `json:"license_class,omitempty"`
+	Status        string     `json:"status"`
+	ReviewStage   string     `json:"review_stage,omitempty"`
+	Remarks       string     `json:"remarks,omitempty"`
+	SubmittedAt   *time.Time `json:"submitted_at,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	ReviewedBy    int        `json:"reviewed_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Version       int        `json:"version"`
+}
+
+// ValidateApplication validates an application struct
+func ValidateApplication(v *validator.Validator, app *Application) {
+	v.Check(app.TeacherID > 0, "teacher_id", "must be provided")
+	v.Check(app.LicenseTypeID > 0, "license_type_id", "must be provided")
+	v.Check(validator.PermittedValue(app.Status, ApplicationStatuses...), "status", "invalid application status")
+	v.Check(len(app.Remarks) <= 1000, "remarks", "must not be more than 1000 characters long")
+}
+
+// ApplicationModel wraps a DB connection
+type ApplicationModel struct {
+	DB    *sql.DB
+	Scope DistrictScope
+}
+
+// Insert adds a new application
+func (m *ApplicationModel) Insert(app *Application) error {
+	query := `
+		INSERT INTO applications (teacher_id, license_type_id, status, remarks, submitted_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING application_id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, app.TeacherID, app.LicenseTypeID, app.Status, app.Remarks, nullTime(app.SubmittedAt)).Scan(&app.ID, &app.CreatedAt, &app.UpdatedAt, &app.Version)
+}
+
+// Get returns an application by id
+func (m *ApplicationModel) Get(id int) (*Application, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT a.application_id, a.teacher_id, a.license_type_id, lt.license_class, a.status,
+		       COALESCE(a.review_stage, ''), COALESCE(a.remarks, ''), a.submitted_at, a.decided_at, a.reviewed_by,
+		       a.created_at, a.updated_at, a.version
+		FROM applications a
+		INNER JOIN license_types lt ON a.license_type_id = lt.license_type_id
+		WHERE a.application_id = $1` + liveTeacherCondition("a.teacher_id")
+	args := []any{id}
+	query += m.Scope.teacherCondition("a.teacher_id", &args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	app, err := scanApplication(m.DB.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+// applicationSortColumns maps the sort values accepted for applications to columns.
+var applicationSortColumns = sortColumns{
+	"application_id": "a.application_id",
+	"status":         "a.status",
+	"submitted_at":   "a.submitted_at",
+	"created_at":     "a.created_at",
+}
+
+// ApplicationSortSafelist lists the sort values accepted for applications
+var ApplicationSortSafelist = applicationSortColumns.safelist()
+
+// GetAll returns applications with optional teacher and status filters
+func (m *ApplicationModel) GetAll(teacherID int, status string, filters Filters) ([]*Application, Metadata, error) {
+	sortColumn, err := filters.sortColumn(applicationSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `
+		SELECT count(*) OVER(), a.application_id, a.teacher_id, a.license_type_id, lt.license_class, a.status,
+		       COALESCE(a.review_stage, ''), COALESCE(a.remarks, ''), a.submitted_at, a.decided_at, a.reviewed_by,
+		       a.created_at, a.updated_at, a.version
+		FROM applications a
+		INNER JOIN license_types lt ON a.license_type_id = lt.license_type_id
+		WHERE 1=1`
+
+	args := []interface{}{}
+	argCount := 0
+
+	if teacherID > 0 {
+		argCount++
+		query += fmt.Sprintf(" AND a.teacher_id = $%d", argCount)
+		args = append(args, teacherID)
+	}
+
+	if status != "" {
+		argCount++
+		query += fmt.Sprintf(" AND a.status = $%d", argCount)
+		args = append(args, status)
+	}
+
+	query += liveTeacherCondition("a.teacher_id")
+	query += m.Scope.teacherCondition("a.teacher_id", &args)
+	argCount = len(args)
+
+	query += fmt.Sprintf(" ORDER BY %s %s, a.application_id ASC", sortColumn, filters.sortDirection())
+
+	argCount++
+	limitArg := argCount
+	argCount++
+	offsetArg := argCount
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", limitArg, offsetArg)
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	apps := []*Application{}
+	for rows.Next() {
+		app, err := scanApplication(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		apps = append(apps, app)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return apps, metadata, nil
+}
+
+// Update saves changes to the editable fields of an application. Status
+// changes go through Transition instead. The version must match the stored
+// version or ErrEditConflict is returned.
+func (m *ApplicationModel) Update(app *Application) error {
+	query := `
+		UPDATE applications
+		SET license_type_id = $1, remarks = $2, updated_at = NOW(), version = version + 1
+		WHERE application_id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	args := []interface{}{
+		app.LicenseTypeID,
+		app.Remarks,
+		app.ID,
+		app.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&app.UpdatedAt, &app.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an application
+func (m *ApplicationModel) Delete(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `DELETE FROM applications WHERE application_id = $1`
+	args := []any{id}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanApplication reads one application row. When prefix destinations are
+// given (e.g. a window count) they are scanned before the application columns.
+func scanApplication(row rowScanner, prefix ...any) (*Application, error) {
+	var app Application
+	var submittedAt sql.NullTime
+	var decidedAt sql.NullTime
+	var reviewedBy sql.NullInt64
+
+	dest := append(prefix,
+		&app.ID,
+		&app.TeacherID,
+		&app.LicenseTypeID,
+		&app.LicenseClass,
+		&app.Status,
+		&app.ReviewStage,
+		&app.Remarks,
+		&submittedAt,
+		&decidedAt,
+		&reviewedBy,
+		&app.CreatedAt,
+		&app.UpdatedAt,
+		&app.Version,
+	)
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if submittedAt.Valid {
+		app.SubmittedAt = &submittedAt.Time
+	}
+	if decidedAt.Valid {
+		app.DecidedAt = &decidedAt.Time
+	}
+	if reviewedBy.Valid {
+		app.ReviewedBy = int(reviewedBy.Int64)
+	}
+	return &app, nil
+}
+
+// nullString converts an empty string to a SQL NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullInt converts a non-positive id to a SQL NULL
+func nullInt(i int) interface{} {
+	if i < 1 {
+		return nil
+	}
+	return i
+}
+
+// nullTime converts a nil time to a SQL NULL
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
@@ -0,0 +1,513 @@
+// Filename: internal/data/audit.go
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of record tracked in the audit trail
+const (
+	AuditEntityUser     = "user"
+	AuditEntityTeacher  = "teacher"
+	AuditEntityDocument = "document"
+	AuditEntityRole     = "role"
+)
+
+// AuditEntityTypes lists the entity types found in the audit trail
+var AuditEntityTypes = []string{AuditEntityUser, AuditEntityTeacher, AuditEntityDocument, AuditEntityRole}
+
+// Actions recorded in the audit trail
+const (
+	AuditActionCreate         = "create"
+	AuditActionUpdate         = "update"
+	AuditActionDelete         = "delete"
+	AuditActionRestore        = "restore"
+	AuditActionPurge          = "purge"
+	AuditActionActivate       = "activate"
+	AuditActionResetPassword  = "reset_password"
+	AuditActionLock           = "lock"
+	AuditActionUnlock         = "unlock"
+	AuditActionSetDistricts   = "set_districts"
+	AuditActionReview         = "review"
+	AuditActionSetPermissions = "set_permissions"
+)
+
+// Actor identifies who makes a change, for the audit trail. The zero
+// value is an anonymous actor, such as someone registering an account.
+type Actor struct {
+	UserID int64
+	IP     string
+}
+
+// AuditEvent is one change recorded in the audit trail. Before and After
+// hold the record as it was on either side of the change; Before is empty
+// for creations and After for records removed from the database.
+//
+// Events form a hash chain: Hash covers the event's contents and PrevHash,
+// the hash of the event before it, so editing or removing any event breaks
+// every link after it.
+type AuditEvent struct {
+	ID         int64           `json:"audit_event_id"`
+	ActorID    int64           `json:"actor_id,omitempty"`
+	IPAddress  string          `json:"ip_address,omitempty"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int64           `json:"entity_id"`
+	Action     string          `json:"action"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the event's contents and
+// PrevHash. Each field is length prefixed so values cannot run together.
+func (e *AuditEvent) ComputeHash() string {
+	fields := []string{
+		e.PrevHash,
+		strconv.FormatInt(e.ActorID, 10),
+		e.IPAddress,
+		e.EntityType,
+		strconv.FormatInt(e.EntityID, 10),
+		e.Action,
+		string(e.Before),
+		string(e.After),
+		e.CreatedAt.UTC().Format(time.RFC3339),
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditEventColumns selects an audit event in the order scanAuditEvent
+// expects
+const auditEventColumns = `audit_event_id, actor_id, ip_address, entity_type, entity_id, action, before, after, created_at,
+	COALESCE(prev_hash, ''), COALESCE(hash, '')`
+
+// scanAuditEvent reads one audit event row selected with auditEventColumns
+func scanAuditEvent(row rowScanner, prefix ...any) (*AuditEvent, error) {
+	var e AuditEvent
+	var actorID sql.NullInt64
+	var ipAddress sql.NullString
+	var before, after []byte
+
+	dest := append(prefix, &e.ID, &actorID, &ipAddress, &e.EntityType, &e.EntityID, &e.Action, &before, &after, &e.CreatedAt, &e.PrevHash, &e.Hash)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	e.ActorID = actorID.Int64
+	e.IPAddress = ipAddress.String
+	e.Before = before
+	e.After = after
+	return &e, nil
+}
+
+// auditRecord describes how to snapshot one kind of record for the audit
+// trail
+type auditRecord struct {
+	entityType string
+	snapshot   string // selects the record as JSON given its id as $1
+}
+
+// tableRecord snapshots a whole table row, less the omitted columns. The
+// row is locked so nothing else can change it before the transaction ends.
+func tableRecord(entityType, table, idColumn string, omit ...string) auditRecord {
+	query := fmt.Sprintf(`SELECT to_jsonb(x) FROM %s x WHERE %s = $1 FOR UPDATE`, table, idColumn)
+	if len(omit) > 0 {
+		query = fmt.Sprintf(`SELECT to_jsonb(x) - '{%s}'::text[] FROM %s x WHERE %s = $1 FOR UPDATE`, strings.Join(omit, ","), table, idColumn)
+	}
+	return auditRecord{entityType: entityType, snapshot: query}
+}
+
+var (
+	auditUser     = tableRecord(AuditEntityUser, "users", "user_id", "password_hash")
+	auditTeacher  = tableRecord(AuditEntityTeacher, "teachers", "teacher_id", "ssn", "dob", "address")
+	auditDocument = tableRecord(AuditEntityDocument, "documents", "document_id")
+	auditRole     = tableRecord(AuditEntityRole, "roles", "role_id")
+
+	auditUserDistricts = auditRecord{
+		entityType: AuditEntityUser,
+		snapshot: `
+			SELECT jsonb_build_object('district_ids', COALESCE(jsonb_agg(district_id ORDER BY district_id), '[]'))
+			FROM user_districts
+			WHERE user_id = $1`,
+	}
+	auditRolePermissions = auditRecord{
+		entityType: AuditEntityRole,
+		snapshot: `
+			SELECT jsonb_build_object('permissions', COALESCE(jsonb_agg(p.code ORDER BY p.code), '[]'))
+			FROM role_permissions rp
+			JOIN permissions p ON p.permission_id = rp.permission_id
+			WHERE rp.role_id = $1`,
+	}
+)
+
+// take returns the record's snapshot, or nil if it does not exist
+func (rec auditRecord) take(ctx context.Context, tx *sql.Tx, id int64) (json.RawMessage, error) {
+	var snapshot []byte
+	err := tx.QueryRowContext(ctx, rec.snapshot, id).Scan(&snapshot)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// audit runs change in a transaction and records it in the audit trail
+// before committing, so a change is never saved without its event. id is
+// the record being changed, or 0 when change creates it; change returns
+// the id of the record it touched.
+func (a Actor) audit(db *sql.DB, rec auditRecord, action string, id int64, change func(ctx context.Context, tx *sql.Tx) (int64, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = a.auditTx(ctx, tx, rec, action, id, change); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// auditTx is audit for a change made inside a transaction the caller
+// already holds, for changes that only sometimes need recording. The
+// caller commits.
+func (a Actor) auditTx(ctx context.Context, tx *sql.Tx, rec auditRecord, action string, id int64, change func(ctx context.Context, tx *sql.Tx) (int64, error)) error {
+	event := &AuditEvent{
+		ActorID:    a.UserID,
+		IPAddress:  a.IP,
+		EntityType: rec.entityType,
+		Action:     action,
+	}
+
+	var err error
+	if id > 0 {
+		event.Before, err = rec.take(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	event.EntityID, err = change(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if action != AuditActionPurge {
+		event.After, err = rec.take(ctx, tx, event.EntityID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return insertAuditEvent(ctx, tx, event)
+}
+
+// auditChainLock is the advisory lock key held while appending to the
+// audit chain. Appends are serialised so each event links to the one
+// committed before it.
+const auditChainLock = 0x61756469
+
+// insertAuditEvent appends the event to the audit chain. The chain lock is
+// held until tx ends.
+func insertAuditEvent(ctx context.Context, tx *sql.Tx, event *AuditEvent) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock)
+	if err != nil {
+		return err
+	}
+
+	query := `SELECT COALESCE(hash, '') FROM audit_events ORDER BY audit_event_id DESC LIMIT 1`
+	err = tx.QueryRowContext(ctx, query).Scan(&event.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	// created_at is stored to the second, so it is set here rather than by
+	// the database to hash exactly what is stored
+	event.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	event.Hash = event.ComputeHash()
+
+	query = `
+		INSERT INTO audit_events (actor_id, ip_address, entity_type, entity_id, action, before, after, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING audit_event_id`
+
+	args := []any{
+		nullInt(int(event.ActorID)),
+		nullString(event.IPAddress),
+		event.EntityType,
+		event.EntityID,
+		event.Action,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		event.CreatedAt,
+		nullString(event.PrevHash),
+		event.Hash,
+	}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&event.ID)
+}
+
+// nullJSON stores empty JSON as NULL
+func nullJSON(j json.RawMessage) any {
+	if len(j) == 0 {
+		return nil
+	}
+	return []byte(j)
+}
+
+// WithActor returns a copy of the models whose changes to users, teachers,
+// documents and roles are recorded in the audit trail as made by actor
+func (m *Models) WithActor(actor Actor) *Models {
+	audited := *m
+
+	users := *m.Users
+	users.Actor = actor
+	audited.Users = &users
+
+	teachers := *m.Teachers
+	teachers.Actor = actor
+	audited.Teachers = &teachers
+
+	documents := *m.Documents
+	documents.Actor = actor
+	audited.Documents = &documents
+
+	roles := *m.Roles
+	roles.Actor = actor
+	audited.Roles = &roles
+
+	permissions := *m.Permissions
+	permissions.Actor = actor
+	audited.Permissions = &permissions
+
+	return &audited
+}
+
+// AuditCriteria narrows an audit trail listing. Zero values match
+// everything.
+type AuditCriteria struct {
+	ActorID    int64
+	EntityType string
+	EntityID   int64
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+}
+
+// auditSortColumns maps the sort values accepted for audit events to
+// columns.
+var auditSortColumns = sortColumns{
+	"audit_event_id": "audit_event_id",
+	"created_at":     "created_at",
+}
+
+// AuditSortSafelist lists the sort values accepted for audit events
+var AuditSortSafelist = auditSortColumns.safelist()
+
+// AuditModel reads the audit trail. Events are only ever written alongside
+// the changes they describe, so it has no Insert.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+// GetAll retrieves a page of audit events matching the criteria
+func (m *AuditModel) GetAll(criteria AuditCriteria, filters Filters) ([]*AuditEvent, Metadata, error) {
+	column, err := filters.sortColumn(auditSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `
+		SELECT count(*) OVER(), ` + auditEventColumns + `
+		FROM audit_events
+		WHERE TRUE`
+	args := []any{}
+
+	if criteria.ActorID > 0 {
+		args = append(args, criteria.ActorID)
+		query += fmt.Sprintf(" AND actor_id = $%d", len(args))
+	}
+	if criteria.EntityType != "" {
+		args = append(args, criteria.EntityType)
+		query += fmt.Sprintf(" AND entity_type = $%d", len(args))
+	}
+	if criteria.EntityID > 0 {
+		args = append(args, criteria.EntityID)
+		query += fmt.Sprintf(" AND entity_id = $%d", len(args))
+	}
+	if criteria.From != nil {
+		args = append(args, *criteria.From)
+		query += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if criteria.To != nil {
+		args = append(args, *criteria.To)
+		query += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" ORDER BY %s %s, audit_event_id ASC LIMIT $%d OFFSET $%d",
+		column, filters.sortDirection(), len(args)-1, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return events, metadata, nil
+}
+
+// AuditCheckpoint pins the audit chain at one event. Checkpoints kept
+// off-site show whether history up to that event was later rewritten.
+type AuditCheckpoint struct {
+	EventID int64  `json:"audit_event_id"`
+	Hash    string `json:"hash"`
+}
+
+// AuditChainReport is the result of walking the audit chain
+type AuditChainReport struct {
+	Checked   int              // events whose links were checked
+	Unchained int              // events written before hashing began
+	Head      *AuditCheckpoint // the last event checked, if any
+	BrokenAt  int64            // first event whose link is broken, or 0
+	Reason    string           // why the link at BrokenAt is broken
+}
+
+// auditChainBatchSize is how many events VerifyChain reads per query
+const auditChainBatchSize = 1000
+
+// VerifyChain walks the audit chain from the first event and stops at the
+// first broken link: an event whose contents no longer match its hash, or
+// whose PrevHash is not the hash of the event before it. Events from
+// before the chain existed have no hash and are only counted.
+func (m *AuditModel) VerifyChain() (*AuditChainReport, error) {
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE audit_event_id > $1
+		ORDER BY audit_event_id
+		LIMIT $2`
+
+	report := &AuditChainReport{}
+	var lastID int64
+	prevHash := ""
+	chained := false
+
+	for {
+		events, err := m.verifyBatch(query, lastID)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return report, nil
+		}
+
+		for _, e := range events {
+			lastID = e.ID
+
+			if e.Hash == "" && !chained {
+				report.Unchained++
+				continue
+			}
+			chained = true
+
+			switch {
+			case e.Hash == "":
+				report.BrokenAt, report.Reason = e.ID, "hash is missing"
+			case e.PrevHash != prevHash:
+				report.BrokenAt, report.Reason = e.ID, "previous hash does not match the event before it"
+			case e.ComputeHash() != e.Hash:
+				report.BrokenAt, report.Reason = e.ID, "contents do not match the hash"
+			}
+			if report.BrokenAt != 0 {
+				return report, nil
+			}
+
+			report.Checked++
+			report.Head = &AuditCheckpoint{EventID: e.ID, Hash: e.Hash}
+			prevHash = e.Hash
+		}
+	}
+}
+
+// verifyBatch reads the events after lastID for VerifyChain
+func (m *AuditModel) verifyBatch(query string, lastID int64) ([]*AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lastID, auditChainBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MatchesCheckpoint reports whether the event pinned by the checkpoint is
+// still in the chain with the same hash
+func (m *AuditModel) MatchesCheckpoint(cp AuditCheckpoint) (bool, error) {
+	query := `SELECT COALESCE(hash, '') FROM audit_events WHERE audit_event_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var hash string
+	err := m.DB.QueryRowContext(ctx, query, cp.EventID).Scan(&hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return hash == cp.Hash, nil
+}
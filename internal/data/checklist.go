@@ -0,0 +1,114 @@
+// Filename: internal/data/checklist.go
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// States of an item on an application's required documents checklist
+const (
+	ChecklistMissing  = "missing"
+	ChecklistRejected = "rejected"
+	ChecklistUploaded = "uploaded"
+	ChecklistVerified = "verified"
+)
+
+// ChecklistItem reports the best document a teacher has for one required
+// document type
+type ChecklistItem struct {
+	DocType    string `json:"doc_type"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DocumentID int    `json:"document_id,omitempty"`
+}
+
+// Checklist lists the documents an application's license type requires.
+// It is complete once every item has been uploaded; rejected documents must
+// be replaced.
+type Checklist struct {
+	Items    []*ChecklistItem `json:"items"`
+	Complete bool             `json:"complete"`
+}
+
+// Missing returns the document types that still need an upload
+func (c *Checklist) Missing() []string {
+	missing := []string{}
+	for _, item := range c.Items {
+		if item.Status == ChecklistMissing || item.Status == ChecklistRejected {
+			missing = append(missing, item.DocType)
+		}
+	}
+	return missing
+}
+
+// checklistRank orders document states so the best one is kept
+var checklistRank = map[string]int{
+	ChecklistMissing:  0,
+	ChecklistRejected: 1,
+	ChecklistUploaded: 2,
+	ChecklistVerified: 3,
+}
+
+// GetChecklist builds the required documents checklist for an application.
+// Documents attached to the application count, as do the teacher's
+// documents that are not attached to any application. Only documents with
+// an uploaded file count; ones recorded by path alone are ignored.
+func (m *DocumentModel) GetChecklist(app *Application, required []*DocumentType) (*Checklist, error) {
+	query := `
+		SELECT document_id, doc_type, verification_status
+		FROM documents
+		WHERE teacher_id = $1 AND (application_id = $2 OR application_id IS NULL)
+		AND sha256 IS NOT NULL AND deleted_at IS NULL
+		ORDER BY uploaded_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, app.TeacherID, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checklist := &Checklist{Items: []*ChecklistItem{}}
+	byType := map[string]*ChecklistItem{}
+	for _, dt := range required {
+		item := &ChecklistItem{DocType: dt.Code, Name: dt.Name, Status: ChecklistMissing}
+		checklist.Items = append(checklist.Items, item)
+		byType[dt.Code] = item
+	}
+
+	for rows.Next() {
+		var id int
+		var docType, verificationStatus string
+		if err := rows.Scan(&id, &docType, &verificationStatus); err != nil {
+			return nil, err
+		}
+
+		item, ok := byType[docType]
+		if !ok {
+			continue
+		}
+
+		status := ChecklistUploaded
+		switch verificationStatus {
+		case DocumentStatusVerified:
+			status = ChecklistVerified
+		case DocumentStatusRejected:
+			status = ChecklistRejected
+		}
+
+		// later uploads of the same rank replace earlier ones
+		if checklistRank[status] >= checklistRank[item.Status] {
+			item.Status = status
+			item.DocumentID = id
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	checklist.Complete = len(checklist.Missing()) == 0
+	return checklist, nil
+}
@@ -0,0 +1,128 @@
+// Filename: internal/data/deleted.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Users, teachers and documents are soft deleted. Delete stamps deleted_at
+// and every other query skips stamped rows, along with the records of a
+// deleted teacher, so the record and everything hanging off it survive
+// until it is restored or purged. Emails, usernames and SSNs of deleted
+// records stay taken until then.
+
+// liveTeacherCondition limits column, a teacher id, to teachers that have
+// not been deleted, so a deleted teacher's records are hidden with them
+func liveTeacherCondition(column string) string {
+	return fmt.Sprintf(" AND %s IN (SELECT teacher_id FROM teachers WHERE deleted_at IS NULL)", column)
+}
+
+// ErrInUse is returned when a record cannot be purged because other
+// records still depend on it
+var ErrInUse = errors.New("record is still in use")
+
+// DeletableEntityTypes lists the kinds of record that are soft deleted
+var DeletableEntityTypes = []string{AuditEntityUser, AuditEntityTeacher, AuditEntityDocument}
+
+// DeletedRecord summarises a soft deleted record for whoever decides to
+// restore or purge it
+type DeletedRecord struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   int64     `json:"entity_id"`
+	Label      string    `json:"label"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	DeletedBy  int64     `json:"deleted_by,omitempty"`
+}
+
+// deletedSortColumns maps the sort values accepted for deleted records to
+// the columns selected by listDeleted queries
+var deletedSortColumns = sortColumns{
+	"entity_id":  "entity_id",
+	"deleted_at": "deleted_at",
+}
+
+// DeletedSortSafelist lists the sort values accepted for deleted records
+var DeletedSortSafelist = deletedSortColumns.safelist()
+
+// listDeleted runs query, which selects count(*) OVER(), entity_id,
+// label, deleted_at and deleted_by, and returns the requested page
+func listDeleted(db *sql.DB, entityType, query string, args []any, filters Filters) ([]*DeletedRecord, Metadata, error) {
+	sortColumn, err := filters.sortColumn(deletedSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, entity_id ASC", sortColumn, filters.sortDirection())
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	records := []*DeletedRecord{}
+	for rows.Next() {
+		record := DeletedRecord{EntityType: entityType}
+		var deletedBy sql.NullInt64
+		err := rows.Scan(&totalRecords, &record.EntityID, &record.Label, &record.DeletedAt, &deletedBy)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		record.DeletedBy = deletedBy.Int64
+		records = append(records, &record)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return records, metadata, nil
+}
+
+// changeOne runs query in tx and returns ErrRecordNotFound if it did not
+// touch any row
+func changeOne(ctx context.Context, tx *sql.Tx, query string, args ...any) error {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// storedFiles returns the storage keys of the uploaded files of the
+// documents query selects, so they can be removed once the documents are
+// purged
+func storedFiles(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		files = append(files, key)
+	}
+	return files, rows.Err()
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
 // District represents an administrative district
@@ -13,6 +16,21 @@ type District struct {
 	Name string `json:"name"`
 }
 
+// ValidateDistrict checks the fields of a district
+func ValidateDistrict(v *validator.Validator, d *District) {
+	v.Check(d.Name != "", "name", "must be provided")
+	v.Check(len(d.Name) <= 50, "name", "must not be more than 50 characters long")
+}
+
+// districtSortColumns maps the sort values accepted for districts to columns
+var districtSortColumns = sortColumns{
+	"district_id": "district_id",
+	"name":        "name",
+}
+
+// DistrictSortSafelist lists the sort values accepted for districts
+var DistrictSortSafelist = districtSortColumns.safelist()
+
 // DistrictModel wraps a DB connection
 type DistrictModel struct {
 	DB *sql.DB
@@ -25,7 +43,11 @@ func (m *DistrictModel) Insert(d *District) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, d.Name).Scan(&d.ID)
+	err := m.DB.QueryRowContext(ctx, query, d.Name).Scan(&d.ID)
+	if err != nil && isUniqueViolation(err, "districts_name_key") {
+		return ErrDuplicateName
+	}
+	return err
 }
 
 // Get returns a district by id
@@ -52,31 +74,74 @@ func (m *DistrictModel) Get(id int) (*District, error) {
 	return &d, nil
 }
 
-// GetAll returns all districts
-func (m *DistrictModel) GetAll() ([]*District, error) {
-	query := `SELECT district_id, name FROM districts ORDER BY name`
+// GetAll returns a page of districts, optionally only those whose name
+// contains the search term
+func (m *DistrictModel) GetAll(name string, filters Filters) ([]*District, Metadata, error) {
+	sortColumn, err := filters.sortColumn(districtSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `SELECT count(*) OVER(), district_id, name FROM districts WHERE 1=1`
+	args := []any{}
+
+	if name != "" {
+		args = append(args, "%"+escapeLike(name)+"%")
+		query += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, district_id ASC", sortColumn, filters.sortDirection())
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	districts := []*District{}
 	for rows.Next() {
 		var d District
-		if err := rows.Scan(&d.ID, &d.Name); err != nil {
-			return nil, err
+		if err := rows.Scan(&totalRecords, &d.ID, &d.Name); err != nil {
+			return nil, Metadata{}, err
 		}
 		districts = append(districts, &d)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return districts, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return districts, metadata, nil
+}
+
+// Update renames a district
+func (m *DistrictModel) Update(d *District) error {
+	query := `UPDATE districts SET name = $1 WHERE district_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, d.Name, d.ID)
+	if err != nil {
+		if isUniqueViolation(err, "districts_name_key") {
+			return ErrDuplicateName
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
 
 // Delete removes a district
@@ -0,0 +1,175 @@
+// Filename: internal/data/document_types.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateDocumentType = errors.New("a document type with this code already exists")
+
+// DocumentTypeCodeRX matches document type codes such as degree_certificate
+var DocumentTypeCodeRX = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// DocumentType is an entry in the registry of documents teachers can upload
+type DocumentType struct {
+	ID               int      `json:"document_type_id"`
+	Code             string   `json:"code"`
+	Name             string   `json:"name"`
+	Description      string   `json:"description,omitempty"`
+	AllowedMIMETypes []string `json:"allowed_mime_types"`
+	MaxSizeBytes     int64    `json:"max_size_bytes"`
+}
+
+// ValidateDocumentType validates a document type struct
+func ValidateDocumentType(v *validator.Validator, dt *DocumentType) {
+	v.Check(dt.Code != "", "code", "must be provided")
+	v.Check(len(dt.Code) <= 100, "code", "must not be more than 100 characters long")
+	v.Check(validator.Matches(dt.Code, DocumentTypeCodeRX), "code", "must be lowercase letters, digits and underscores")
+	v.Check(strings.TrimSpace(dt.Name) != "", "name", "must be provided")
+	v.Check(len(dt.Name) <= 255, "name", "must not be more than 255 characters long")
+	v.Check(len(dt.AllowedMIMETypes) > 0, "allowed_mime_types", "must contain at least one MIME type")
+	for _, mimeType := range dt.AllowedMIMETypes {
+		v.Check(strings.Count(mimeType, "/") == 1, "allowed_mime_types", "must only contain MIME types such as application/pdf")
+	}
+	v.Check(dt.MaxSizeBytes > 0, "max_size_bytes", "must be greater than zero")
+}
+
+// DocumentTypeModel wraps a DB connection
+type DocumentTypeModel struct {
+	DB *sql.DB
+}
+
+const documentTypeColumns = `document_type_id, code, name, COALESCE(description, ''), allowed_mime_types, max_size_bytes`
+
+// Insert adds a document type
+func (m *DocumentTypeModel) Insert(dt *DocumentType) error {
+	query := `
+		INSERT INTO document_types (code, name, description, allowed_mime_types, max_size_bytes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING document_type_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, dt.Code, dt.Name, nullString(dt.Description), pq.Array(dt.AllowedMIMETypes), dt.MaxSizeBytes).Scan(&dt.ID)
+	if err != nil {
+		if isUniqueViolation(err, "document_types_code_key") {
+			return ErrDuplicateDocumentType
+		}
+		return err
+	}
+	return nil
+}
+
+// Get returns a document type by id
+func (m *DocumentTypeModel) Get(id int) (*DocumentType, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + documentTypeColumns + ` FROM document_types WHERE document_type_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanDocumentType(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetByCode returns a document type by its code
+func (m *DocumentTypeModel) GetByCode(code string) (*DocumentType, error) {
+	query := `SELECT ` + documentTypeColumns + ` FROM document_types WHERE code = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanDocumentType(m.DB.QueryRowContext(ctx, query, code))
+}
+
+// GetAll returns every document type
+func (m *DocumentTypeModel) GetAll() ([]*DocumentType, error) {
+	query := `SELECT ` + documentTypeColumns + ` FROM document_types ORDER BY name`
+	return m.query(query)
+}
+
+// GetRequiredFor returns the document types a license type requires
+func (m *DocumentTypeModel) GetRequiredFor(licenseTypeID int) ([]*DocumentType, error) {
+	query := `
+		SELECT ` + documentTypeColumns + `
+		FROM document_types
+		WHERE document_type_id IN (SELECT document_type_id FROM license_type_documents WHERE license_type_id = $1)
+		ORDER BY name`
+	return m.query(query, licenseTypeID)
+}
+
+// Update saves changes to a document type. The code is the key documents
+// refer to, so renaming it carries over to existing documents.
+func (m *DocumentTypeModel) Update(dt *DocumentType) error {
+	query := `
+		UPDATE document_types
+		SET code = $1, name = $2, description = $3, allowed_mime_types = $4, max_size_bytes = $5
+		WHERE document_type_id = $6`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, dt.Code, dt.Name, nullString(dt.Description), pq.Array(dt.AllowedMIMETypes), dt.MaxSizeBytes, dt.ID)
+	if err != nil {
+		if isUniqueViolation(err, "document_types_code_key") {
+			return ErrDuplicateDocumentType
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m *DocumentTypeModel) query(query string, args ...any) ([]*DocumentType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*DocumentType{}
+	for rows.Next() {
+		var dt DocumentType
+		if err := rows.Scan(&dt.ID, &dt.Code, &dt.Name, &dt.Description, pq.Array(&dt.AllowedMIMETypes), &dt.MaxSizeBytes); err != nil {
+			return nil, err
+		}
+		out = append(out, &dt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func scanDocumentType(row rowScanner) (*DocumentType, error) {
+	var dt DocumentType
+	err := row.Scan(&dt.ID, &dt.Code, &dt.Name, &dt.Description, pq.Array(&dt.AllowedMIMETypes), &dt.MaxSizeBytes)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &dt, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -14,18 +15,41 @@ type Document struct {
 	ApplicationID int       `json:"application_id,omitempty"`
 	DocType       string    `json:"doc_type"`
 	FilePath      string    `json:"file_path"`
+	FileName      string    `json:"file_name,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+	FileSize      int64     `json:"file_size,omitempty"`
+	SHA256        string    `json:"sha256,omitempty"`
 	Verified      bool      `json:"verified"`
 	VerifiedBy    int       `json:"verified_by,omitempty"`
 	Remarks       string    `json:"remarks,omitempty"`
 	UploadedAt    time.Time `json:"uploaded_at"`
+
+	VerificationStatus string     `json:"verification_status"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
 }
 
+// Review states of a document
+const (
+	DocumentStatusPending  = "pending"
+	DocumentStatusVerified = "verified"
+	DocumentStatusRejected = "rejected"
+)
+
+// documentColumns selects a document in the order scanDocument expects
+const documentColumns = `document_id, teacher_id, uploaded_by, application_id, doc_type, file_path, verified, verified_by,
+	COALESCE(remarks, ''), uploaded_at, COALESCE(file_name, ''), COALESCE(content_type, ''), COALESCE(file_size, 0),
+	COALESCE(sha256, ''), verification_status, verified_at`
+
 type DocumentModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Scope DistrictScope
+	Actor Actor // recorded in the audit trail for changes
 }
 
+// Insert adds a document. New documents always start out pending review;
+// use Review to verify or reject them.
 func (m *DocumentModel) Insert(d *Document) error {
-	query := `INSERT INTO documents (teacher_id, uploaded_by, application_id, doc_type, file_path, verified, verified_by, remarks) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING document_id, uploaded_at`
+	query := `INSERT INTO documents (teacher_id, uploaded_by, application_id, doc_type, file_path, remarks, file_name, content_type, file_size, sha256) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING document_id, uploaded_at, verified, verification_status`
 
 	var uploadedBy interface{}
 	if d.UploadedBy > 0 {
@@ -39,34 +63,33 @@ func (m *DocumentModel) Insert(d *Document) error {
 	} else {
 		appID = nil
 	}
-	var verifiedBy interface{}
-	if d.VerifiedBy > 0 {
-		verifiedBy = d.VerifiedBy
+
+	// File metadata is only known for uploaded files
+	var fileSize interface{}
+	if d.SHA256 != "" {
+		fileSize = d.FileSize
 	} else {
-		verifiedBy = nil
+		fileSize = nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return m.DB.QueryRowContext(ctx, query, d.TeacherID, uploadedBy, appID, d.DocType, d.FilePath, d.Verified, verifiedBy, d.Remarks).Scan(&d.ID, &d.UploadedAt)
+	return m.Actor.audit(m.DB, auditDocument, AuditActionCreate, 0, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, d.TeacherID, uploadedBy, appID, d.DocType, d.FilePath, d.Remarks, nullString(d.FileName), nullString(d.ContentType), fileSize, nullString(d.SHA256)).Scan(&d.ID, &d.UploadedAt, &d.Verified, &d.VerificationStatus)
+		return int64(d.ID), err
+	})
 }
 
 func (m *DocumentModel) Get(id int) (*Document, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `SELECT document_id, teacher_id, uploaded_by, application_id, doc_type, file_path, verified, verified_by, remarks, uploaded_at FROM documents WHERE document_id = $1`
-
-	var d Document
-	var uploadedBy sql.NullInt64
-	var appID sql.NullInt64
-	var verifiedBy sql.NullInt64
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE document_id = $1 AND deleted_at IS NULL` + liveTeacherCondition("teacher_id")
+	args := []any{id}
+	query += m.Scope.teacherCondition("teacher_id", &args)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&d.ID, &d.TeacherID, &uploadedBy, &appID, &d.DocType, &d.FilePath, &d.Verified, &verifiedBy, &d.Remarks, &d.UploadedAt)
+	d, err := scanDocument(m.DB.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -75,73 +98,283 @@ func (m *DocumentModel) Get(id int) (*Document, error) {
 			return nil, err
 		}
 	}
-	if uploadedBy.Valid {
-		d.UploadedBy = int(uploadedBy.Int64)
-	}
-	if appID.Valid {
-		d.ApplicationID = int(appID.Int64)
-	}
-	if verifiedBy.Valid {
-		d.VerifiedBy = int(verifiedBy.Int64)
-	}
-	return &d, nil
+	return d, nil
+}
+
+// documentSortColumns maps the sort values accepted for a teacher's
+// documents to columns
+var documentSortColumns = sortColumns{
+	"document_id":         "document_id",
+	"doc_type":            "doc_type",
+	"uploaded_at":         "uploaded_at",
+	"verification_status": "verification_status",
 }
 
-func (m *DocumentModel) GetByTeacher(teacherID int) ([]*Document, error) {
-	query := `SELECT document_id, teacher_id, uploaded_by, application_id, doc_type, file_path, verified, verified_by, remarks, uploaded_at FROM documents WHERE teacher_id = $1 ORDER BY uploaded_at DESC`
+// DocumentSortSafelist lists the sort values accepted for a teacher's documents
+var DocumentSortSafelist = documentSortColumns.safelist()
+
+// GetByTeacher returns a page of a teacher's documents, newest first by default
+func (m *DocumentModel) GetByTeacher(teacherID int, filters Filters) ([]*Document, Metadata, error) {
+	sortColumn, err := filters.sortColumn(documentSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `SELECT count(*) OVER(), ` + documentColumns + ` FROM documents WHERE teacher_id = $1 AND deleted_at IS NULL` + liveTeacherCondition("teacher_id")
+	args := []any{teacherID}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+	query += fmt.Sprintf(" ORDER BY %s %s, document_id ASC", sortColumn, filters.sortDirection())
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, teacherID)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	out := []*Document{}
 	for rows.Next() {
-		var d Document
-		var uploadedBy sql.NullInt64
-		var appID sql.NullInt64
-		var verifiedBy sql.NullInt64
-		if err := rows.Scan(&d.ID, &d.TeacherID, &uploadedBy, &appID, &d.DocType, &d.FilePath, &d.Verified, &verifiedBy, &d.Remarks, &d.UploadedAt); err != nil {
-			return nil, err
+		d, err := scanDocument(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
 		}
-		if uploadedBy.Valid {
-			d.UploadedBy = int(uploadedBy.Int64)
-		}
-		if appID.Valid {
-			d.ApplicationID = int(appID.Int64)
+		out = append(out, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return out, metadata, nil
+}
+
+// Review records a reviewer's decision on a pending document. status must
+// be DocumentStatusVerified or DocumentStatusRejected. ErrInvalidTransition
+// is returned if the document has already been reviewed.
+func (m *DocumentModel) Review(d *Document, status string, reviewerID int, remarks string) error {
+	query := `
+		UPDATE documents
+		SET verification_status = $1, verified = $2, verified_by = $3, verified_at = NOW(), remarks = $4
+		WHERE document_id = $5 AND verification_status = 'pending' AND deleted_at IS NULL
+		RETURNING verified_at`
+
+	var verifiedAt time.Time
+	err := m.Actor.audit(m.DB, auditDocument, AuditActionReview, int64(d.ID), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, status, status == DocumentStatusVerified, reviewerID, nullString(remarks), d.ID).Scan(&verifiedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return 0, ErrInvalidTransition
+			default:
+				return 0, err
+			}
 		}
-		if verifiedBy.Valid {
-			d.VerifiedBy = int(verifiedBy.Int64)
+		return int64(d.ID), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	d.VerificationStatus = status
+	d.Verified = status == DocumentStatusVerified
+	d.VerifiedBy = reviewerID
+	d.VerifiedAt = &verifiedAt
+	d.Remarks = remarks
+	return nil
+}
+
+// verificationQueueSortColumns maps the sort values accepted for the
+// verification queue to columns.
+var verificationQueueSortColumns = sortColumns{
+	"uploaded_at": "documents.uploaded_at",
+	"doc_type":    "documents.doc_type",
+}
+
+// VerificationQueueSortSafelist lists the sort values accepted for the
+// verification queue
+var VerificationQueueSortSafelist = verificationQueueSortColumns.safelist()
+
+// GetVerificationQueue returns documents still waiting for review, oldest
+// first by default, optionally limited to one district or doc type
+func (m *DocumentModel) GetVerificationQueue(districtID int, docType string, filters Filters) ([]*Document, Metadata, error) {
+	sortColumn, err := filters.sortColumn(verificationQueueSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `
+		SELECT count(*) OVER(), ` + documentColumns + `
+		FROM documents
+		WHERE verification_status = 'pending' AND deleted_at IS NULL` + liveTeacherCondition("teacher_id")
+
+	args := []interface{}{}
+	argCount := 0
+
+	if districtID > 0 {
+		argCount++
+		query += fmt.Sprintf(" AND teacher_id IN (SELECT teacher_id FROM teachers WHERE district_id = $%d)", argCount)
+		args = append(args, districtID)
+	}
+
+	if docType != "" {
+		argCount++
+		query += fmt.Sprintf(" AND doc_type = $%d", argCount)
+		args = append(args, docType)
+	}
+
+	query += m.Scope.teacherCondition("teacher_id", &args)
+	argCount = len(args)
+
+	query += fmt.Sprintf(" ORDER BY %s %s, documents.document_id ASC", sortColumn, filters.sortDirection())
+
+	argCount++
+	limitArg := argCount
+	argCount++
+	offsetArg := argCount
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", limitArg, offsetArg)
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	documents := []*Document{}
+	for rows.Next() {
+		d, err := scanDocument(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
 		}
-		out = append(out, &d)
+		documents = append(documents, d)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return out, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return documents, metadata, nil
 }
 
+// Delete soft deletes a document. Its stored file is kept until the
+// document is purged.
 func (m *DocumentModel) Delete(id int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	query := `DELETE FROM documents WHERE document_id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	res, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+	query := `UPDATE documents SET deleted_at = NOW(), deleted_by = $2 WHERE document_id = $1 AND deleted_at IS NULL`
+	args := []any{id, nullInt(int(m.Actor.UserID))}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	return m.Actor.audit(m.DB, auditDocument, AuditActionDelete, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
+}
+
+// GetDeleted returns a page of soft deleted documents, most recently
+// deleted first by default
+func (m *DocumentModel) GetDeleted(filters Filters) ([]*DeletedRecord, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), document_id AS entity_id, doc_type || COALESCE(' (' || file_name || ')', '') AS label, deleted_at, deleted_by
+		FROM documents
+		WHERE deleted_at IS NOT NULL`
+	args := []any{}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	return listDeleted(m.DB, AuditEntityDocument, query, args, filters)
+}
+
+// Restore brings back a soft deleted document
+func (m *DocumentModel) Restore(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `UPDATE documents SET deleted_at = NULL, deleted_by = NULL WHERE document_id = $1 AND deleted_at IS NOT NULL`
+	args := []any{id}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	return m.Actor.audit(m.DB, auditDocument, AuditActionRestore, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
+}
+
+// Purge removes a soft deleted document from the database for good. It
+// returns the storage key of the uploaded file, if there is one, for the
+// caller to remove.
+func (m *DocumentModel) Purge(id int) ([]string, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
 	}
-	n, err := res.RowsAffected()
+	query := `DELETE FROM documents WHERE document_id = $1 AND deleted_at IS NOT NULL`
+	args := []any{id}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	var files []string
+	err := m.Actor.audit(m.DB, auditDocument, AuditActionPurge, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		var err error
+		files, err = storedFiles(ctx, tx, `SELECT file_path FROM documents WHERE document_id = $1 AND sha256 IS NOT NULL`, id)
+		if err != nil {
+			return 0, err
+		}
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if n == 0 {
-		return ErrRecordNotFound
+	return files, nil
+}
+
+// scanDocument reads one document row selected with documentColumns
+func scanDocument(row rowScanner, prefix ...any) (*Document, error) {
+	var d Document
+	var uploadedBy sql.NullInt64
+	var appID sql.NullInt64
+	var verifiedBy sql.NullInt64
+	var verifiedAt sql.NullTime
+
+	dest := append(prefix,
+		&d.ID,
+		&d.TeacherID,
+		&uploadedBy,
+		&appID,
+		&d.DocType,
+		&d.FilePath,
+		&d.Verified,
+		&verifiedBy,
+		&d.Remarks,
+		&d.UploadedAt,
+		&d.FileName,
+		&d.ContentType,
+		&d.FileSize,
+		&d.SHA256,
+		&d.VerificationStatus,
+		&verifiedAt,
+	)
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
 	}
-	return nil
+
+	if uploadedBy.Valid {
+		d.UploadedBy = int(uploadedBy.Int64)
+	}
+	if appID.Valid {
+		d.ApplicationID = int(appID.Int64)
+	}
+	if verifiedBy.Valid {
+		d.VerifiedBy = int(verifiedBy.Int64)
+	}
+	if verifiedAt.Valid {
+		d.VerifiedAt = &verifiedAt.Time
+	}
+	return &d, nil
 }
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
 type Education struct {
@@ -18,6 +21,27 @@ type Education struct {
 	InstitutionID int    `json:"institution_id,omitempty"`
 }
 
+// ValidateEducation checks the fields of an education record
+func ValidateEducation(v *validator.Validator, e *Education) {
+	v.Check(e.TeacherID > 0, "teacher_id", "must be provided")
+	v.Check(e.Institution != "", "institution", "must be provided")
+	v.Check(len(e.Institution) <= 150, "institution", "must not be more than 150 characters long")
+	v.Check(len(e.Level) <= 50, "level", "must not be more than 50 characters long")
+	v.Check(len(e.Program) <= 100, "program", "must not be more than 100 characters long")
+	v.Check(len(e.Degree) <= 100, "degree", "must not be more than 100 characters long")
+	v.Check(e.YearObtained >= 0, "year_obtained", "must not be negative")
+}
+
+// educationSortColumns maps the sort values accepted for education records to columns
+var educationSortColumns = sortColumns{
+	"education_id":  "education_id",
+	"institution":   "institution",
+	"year_obtained": "year_obtained",
+}
+
+// EducationSortSafelist lists the sort values accepted for education records
+var EducationSortSafelist = educationSortColumns.safelist()
+
 type EducationModel struct {
 	DB *sql.DB
 }
@@ -49,7 +73,7 @@ func (m *EducationModel) Get(id int) (*Education, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `SELECT education_id, teacher_id, institution, level, program, degree, year_obtained, institution_id FROM education WHERE education_id = $1`
+	query := `SELECT education_id, teacher_id, institution, level, program, degree, year_obtained, institution_id FROM education WHERE education_id = $1` + liveTeacherCondition("teacher_id")
 
 	var e Education
 	var year sql.NullInt64
@@ -76,25 +100,38 @@ func (m *EducationModel) Get(id int) (*Education, error) {
 	return &e, nil
 }
 
-func (m *EducationModel) GetByTeacher(teacherID int) ([]*Education, error) {
-	query := `SELECT education_id, teacher_id, institution, level, program, degree, year_obtained, institution_id FROM education WHERE teacher_id = $1 ORDER BY year_obtained DESC NULLS LAST`
+// GetByTeacher returns a page of a teacher's education records, most
+// recent first by default
+func (m *EducationModel) GetByTeacher(teacherID int, filters Filters) ([]*Education, Metadata, error) {
+	sortColumn, err := filters.sortColumn(educationSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), education_id, teacher_id, institution, level, program, degree, year_obtained, institution_id
+		FROM education
+		WHERE teacher_id = $1%s
+		ORDER BY %s %s NULLS LAST, education_id ASC
+		LIMIT $2 OFFSET $3`, liveTeacherCondition("teacher_id"), sortColumn, filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, teacherID)
+	rows, err := m.DB.QueryContext(ctx, query, teacherID, filters.limit(), filters.offset())
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	out := []*Education{}
 	for rows.Next() {
 		var e Education
 		var year sql.NullInt64
 		var inst sql.NullInt64
-		if err := rows.Scan(&e.ID, &e.TeacherID, &e.Institution, &e.Level, &e.Program, &e.Degree, &year, &inst); err != nil {
-			return nil, err
+		if err := rows.Scan(&totalRecords, &e.ID, &e.TeacherID, &e.Institution, &e.Level, &e.Program, &e.Degree, &year, &inst); err != nil {
+			return nil, Metadata{}, err
 		}
 		if year.Valid {
 			e.YearObtained = int(year.Int64)
@@ -105,9 +142,32 @@ func (m *EducationModel) GetByTeacher(teacherID int) ([]*Education, error) {
 		out = append(out, &e)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return out, metadata, nil
+}
+
+// Update saves changes to an education record
+func (m *EducationModel) Update(e *Education) error {
+	query := `UPDATE education SET institution = $1, level = $2, program = $3, degree = $4, year_obtained = $5, institution_id = $6 WHERE education_id = $7`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, e.Institution, e.Level, e.Program, e.Degree, nullInt(e.YearObtained), nullInt(e.InstitutionID), e.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
-	return out, nil
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
 
 func (m *EducationModel) Delete(id int) error {
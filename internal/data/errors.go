@@ -3,7 +3,20 @@ package data
 
 import (
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 var ErrRecordNotFound = errors.New("record not found")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrInvalidTransition = errors.New("the action is not allowed from the record's current state")
+var ErrUnknownPermission = errors.New("unknown permission")
+var ErrDuplicateName = errors.New("duplicate name")
+var ErrInvalidSort = errors.New("invalid sort value")
+
+// isUniqueViolation reports whether err is PostgreSQL refusing a write
+// that would break the named unique constraint or index
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
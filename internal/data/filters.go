@@ -1,6 +1,7 @@
 package data
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
@@ -62,67 +63,39 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
-// Implement the sorting feature
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			column := strings.TrimPrefix(f.Sort, "-")
-			// Map API field names to database column names
-			switch column {
-			// User table mappings
-			case "id":
-				return "user_id"
-			// Course table mappings
-			case "course_id":
-				return "c.course_id"
-			case "course_name":
-				return "c.course_name"
-			case "category_name":
-				return "cc.category_name"
-			case "credit_hours":
-				return "c.credit_hours"
-			// Facilitator table mappings
-			case "facilitator_id":
-				return "f.facilitator_id"
-			case "last_name":
-				return "f.last_name"
-			case "first_name":
-				return "f.first_name"
-			case "rating":
-				return "f.rating"
-			// Course Category table mappings
-			case "category_id":
-				return "category_id"
-			// Rank table mappings
-			case "rank_id":
-				return "rank_id"
-			case "rank_name":
-				return "rank_name"
-			case "abbreviation":
-				return "abbreviation"
-			// Region table mappings
-			case "region_id":
-				return "region_id"
-			case "region_name":
-				return "region_name"
-			// Formation table mappings (with joins)
-			case "formation_id":
-				return "f.formation_id"
-			case "formation_name":
-				return "f.formation_name"
-			// Role table mappings
-			case "role_id":
-				return "role_id"
-			case "role_name":
-				return "role_name"
-			default:
-				return column
-			}
-		}
+// sortColumns maps the sort fields a resource accepts to qualified SQL
+// columns. Each model keeps its own mapping and derives its exported
+// safelist from it, so the two cannot drift apart.
+type sortColumns map[string]string
+
+// safelist returns every field in the mapping, ascending and descending.
+func (c sortColumns) safelist() []string {
+	safelist := make([]string, 0, 2*len(c))
+	for field := range c {
+		safelist = append(safelist, field, "-"+field)
+	}
+	slices.Sort(safelist)
+	return safelist
+}
+
+// Implement the sorting feature. The sort value is looked up in the
+// resource's column mapping; anything outside the safelist or the mapping
+// returns ErrInvalidSort so it never reaches the query.
+func (f Filters) sortColumn(columns sortColumns) (string, error) {
+	if !slices.Contains(f.SortSafelist, f.Sort) {
+		return "", ErrInvalidSort
 	}
-	// don't allow the operation to continue
-	// if case of SQL injection attack
-	panic("unsafe sort parameter: " + f.Sort)
+	column, ok := columns[strings.TrimPrefix(f.Sort, "-")]
+	if !ok {
+		return "", ErrInvalidSort
+	}
+	return column, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term so it is matched
+// literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 // Get the sort order
@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
 // Institution represents an educational institution
@@ -15,6 +18,24 @@ type Institution struct {
 	InstitutionType string `json:"institution_type,omitempty"`
 }
 
+// ValidateInstitution checks the fields of an institution
+func ValidateInstitution(v *validator.Validator, i *Institution) {
+	v.Check(i.Name != "", "name", "must be provided")
+	v.Check(len(i.Name) <= 200, "name", "must not be more than 200 characters long")
+	v.Check(len(i.InstitutionType) <= 100, "institution_type", "must not be more than 100 characters long")
+}
+
+// institutionSortColumns maps the sort values accepted for institutions to columns
+var institutionSortColumns = sortColumns{
+	"institution_id":   "institution_id",
+	"name":             "name",
+	"district_id":      "district_id",
+	"institution_type": "institution_type",
+}
+
+// InstitutionSortSafelist lists the sort values accepted for institutions
+var InstitutionSortSafelist = institutionSortColumns.safelist()
+
 type InstitutionModel struct {
 	DB *sql.DB
 }
@@ -32,7 +53,11 @@ func (m *InstitutionModel) Insert(i *Institution) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, i.Name, district, i.InstitutionType).Scan(&i.ID)
+	err := m.DB.QueryRowContext(ctx, query, i.Name, district, i.InstitutionType).Scan(&i.ID)
+	if err != nil && isUniqueViolation(err, "institutions_name_key") {
+		return ErrDuplicateName
+	}
+	return err
 }
 
 func (m *InstitutionModel) Get(id int) (*Institution, error) {
@@ -61,24 +86,50 @@ func (m *InstitutionModel) Get(id int) (*Institution, error) {
 	return &ins, nil
 }
 
-func (m *InstitutionModel) GetAll() ([]*Institution, error) {
-	query := `SELECT institution_id, name, district_id, institution_type FROM institutions ORDER BY name`
+// GetAll returns a page of institutions, optionally filtered by name,
+// district and type
+func (m *InstitutionModel) GetAll(name string, districtID int, institutionType string, filters Filters) ([]*Institution, Metadata, error) {
+	sortColumn, err := filters.sortColumn(institutionSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `SELECT count(*) OVER(), institution_id, name, district_id, institution_type FROM institutions WHERE 1=1`
+	args := []any{}
+
+	if name != "" {
+		args = append(args, "%"+escapeLike(name)+"%")
+		query += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+	if districtID > 0 {
+		args = append(args, districtID)
+		query += fmt.Sprintf(" AND district_id = $%d", len(args))
+	}
+	if institutionType != "" {
+		args = append(args, institutionType)
+		query += fmt.Sprintf(" AND institution_type = $%d", len(args))
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s %s, institution_id ASC", sortColumn, filters.sortDirection())
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	out := []*Institution{}
 	for rows.Next() {
 		var ins Institution
 		var district sql.NullInt64
-		if err := rows.Scan(&ins.ID, &ins.Name, &district, &ins.InstitutionType); err != nil {
-			return nil, err
+		if err := rows.Scan(&totalRecords, &ins.ID, &ins.Name, &district, &ins.InstitutionType); err != nil {
+			return nil, Metadata{}, err
 		}
 		if district.Valid {
 			ins.DistrictID = int(district.Int64)
@@ -86,9 +137,35 @@ func (m *InstitutionModel) GetAll() ([]*Institution, error) {
 		out = append(out, &ins)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return out, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return out, metadata, nil
+}
+
+// Update saves changes to an institution
+func (m *InstitutionModel) Update(i *Institution) error {
+	query := `UPDATE institutions SET name = $1, district_id = $2, institution_type = $3 WHERE institution_id = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, i.Name, nullInt(i.DistrictID), i.InstitutionType, i.ID)
+	if err != nil {
+		if isUniqueViolation(err, "institutions_name_key") {
+			return ErrDuplicateName
+		}
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
 
 func (m *InstitutionModel) Delete(id int) error {
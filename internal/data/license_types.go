@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Classes of teaching license that can be applied for and issued
+const (
+	LicenseClassProvisional = "provisional"
+	LicenseClassTrained     = "trained"
+	LicenseClassFull        = "full"
+)
+
+// LicenseType describes a class of teaching license
+type LicenseType struct {
+	ID            int    `json:"license_type_id"`
+	LicenseClass  string `json:"license_class"`
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	ValidityYears int    `json:"validity_years"`
+}
+
+// LicenseTypeModel wraps a DB connection
+type LicenseTypeModel struct {
+	DB *sql.DB
+}
+
+// Get returns a license type by id
+func (m *LicenseTypeModel) Get(id int) (*LicenseType, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT license_type_id, license_class, name, COALESCE(description, ''), validity_years FROM license_types WHERE license_type_id = $1`
+
+	var lt LicenseType
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&lt.ID, &lt.LicenseClass, &lt.Name, &lt.Description, &lt.ValidityYears)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &lt, nil
+}
+
+// GetByClass returns the license type for a license class
+func (m *LicenseTypeModel) GetByClass(licenseClass string) (*LicenseType, error) {
+	query := `SELECT license_type_id, license_class, name, COALESCE(description, ''), validity_years FROM license_types WHERE license_class = $1`
+
+	var lt LicenseType
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, licenseClass).Scan(&lt.ID, &lt.LicenseClass, &lt.Name, &lt.Description, &lt.ValidityYears)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &lt, nil
+}
+
+// GetAll returns all license types
+func (m *LicenseTypeModel) GetAll() ([]*LicenseType, error) {
+	query := `SELECT license_type_id, license_class, name, COALESCE(description, ''), validity_years FROM license_types ORDER BY license_type_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*LicenseType{}
+	for rows.Next() {
+		var lt LicenseType
+		if err := rows.Scan(&lt.ID, &lt.LicenseClass, &lt.Name, &lt.Description, &lt.ValidityYears); err != nil {
+			return nil, err
+		}
+		out = append(out, &lt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
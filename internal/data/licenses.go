@@ -0,0 +1,552 @@
+// Filename: internal/data/licenses.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// Levels of schooling a license covers
+const (
+	LicenseLevelPreschool = "preschool"
+	LicenseLevelPrimary   = "primary"
+	LicenseLevelSecondary = "secondary"
+)
+
+// LicenseLevels lists every valid license level
+var LicenseLevels = []string{LicenseLevelPreschool, LicenseLevelPrimary, LicenseLevelSecondary}
+
+// LicenseClasses lists every valid license class
+var LicenseClasses = []string{LicenseClassProvisional, LicenseClassTrained, LicenseClassFull}
+
+// States an issued license can be in
+const (
+	LicenseStatusActive    = "active"
+	LicenseStatusExpired   = "expired"
+	LicenseStatusSuspended = "suspended"
+	LicenseStatusRevoked   = "revoked"
+)
+
+// LicenseStatuses lists every valid license status
+var LicenseStatuses = []string{LicenseStatusActive, LicenseStatusExpired, LicenseStatusSuspended, LicenseStatusRevoked}
+
+// Actions recorded against a license
+const (
+	LicenseActionIssue     = "issue"
+	LicenseActionRenew     = "renew"
+	LicenseActionSuspend   = "suspend"
+	LicenseActionReinstate = "reinstate"
+	LicenseActionRevoke    = "revoke"
+)
+
+// licenseTransitions lists the statuses each action may be taken from and
+// the status it leads to
+var licenseTransitions = map[string]struct {
+	from []string
+	to   string
+}{
+	LicenseActionRenew:     {from: []string{LicenseStatusActive, LicenseStatusExpired}, to: LicenseStatusActive},
+	LicenseActionSuspend:   {from: []string{LicenseStatusActive}, to: LicenseStatusSuspended},
+	LicenseActionReinstate: {from: []string{LicenseStatusSuspended}, to: LicenseStatusActive},
+	LicenseActionRevoke:    {from: []string{LicenseStatusActive, LicenseStatusExpired, LicenseStatusSuspended}, to: LicenseStatusRevoked},
+}
+
+var ErrDuplicateLicense = errors.New("a license has already been issued for this application")
+
+// License is a teaching license issued to a teacher
+type License struct {
+	ID            int       `json:"license_id"`
+	LicenseNumber string    `json:"license_number"`
+	TeacherID     int       `json:"teacher_id"`
+	ApplicationID int       `json:"application_id,omitempty"`
+	LicenseClass  string    `json:"license_class"`
+	Level         string    `json:"level"`
+	IssueDate     time.Time `json:"issue_date"`
+	ExpiryDate    time.Time `json:"expiry_date"`
+	Status        string    `json:"status"`
+	IssuedBy      int       `json:"issued_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int       `json:"version"`
+}
+
+// LicenseEvent records an action taken on a license and the reason for it
+type LicenseEvent struct {
+	ID         int       `json:"event_id"`
+	LicenseID  int       `json:"license_id"`
+	Action     string    `json:"action"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	ExpiryDate time.Time `json:"expiry_date"`
+	Reason     string    `json:"reason"`
+	ActorID    int       `json:"actor_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ValidateLicenseReason checks the reason given for a license action
+func ValidateLicenseReason(v *validator.Validator, reason string) {
+	v.Check(strings.TrimSpace(reason) != "", "reason", "must be provided")
+	v.Check(len(reason) <= 1000, "reason", "must not be more than 1000 characters long")
+}
+
+// LicenseModel wraps a DB connection
+type LicenseModel struct {
+	DB    *sql.DB
+	Scope DistrictScope
+}
+
+// licenseColumns selects a license. A license whose expiry date has passed
+// is reported as expired even if it has not been updated since.
+const licenseColumns = `
+	license_id, license_number, teacher_id, application_id, license_class, level, issue_date, expiry_date,
+	CASE WHEN status = 'active' AND expiry_date < CURRENT_DATE THEN 'expired' ELSE status END,
+	issued_by, created_at, updated_at, version`
+
+// Issue creates a new license valid for validityYears from today. The
+// license number is built from the teacher's district code, the year and
+// the next number in that district's sequence.
+func (m *LicenseModel) Issue(l *License, districtID int, validityYears int, reason string, actorID int) (*LicenseEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var prefix string
+	query := `SELECT COALESCE(code, UPPER(LEFT(name, 3))) FROM districts WHERE district_id = $1`
+	err = tx.QueryRowContext(ctx, query, districtID).Scan(&prefix)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	l.IssueDate = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	l.ExpiryDate = l.IssueDate.AddDate(validityYears, 0, 0)
+	l.Status = LicenseStatusActive
+	l.IssuedBy = actorID
+
+	var next int
+	query = `
+		INSERT INTO license_sequences (prefix, year, last_number)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (prefix, year) DO UPDATE SET last_number = license_sequences.last_number + 1
+		RETURNING last_number`
+	err = tx.QueryRowContext(ctx, query, prefix, l.IssueDate.Year()).Scan(&next)
+	if err != nil {
+		return nil, err
+	}
+	l.LicenseNumber = fmt.Sprintf("%s-%d-%05d", prefix, l.IssueDate.Year(), next)
+
+	query = `
+		INSERT INTO licenses (license_number, teacher_id, application_id, license_class, level, issue_date, expiry_date, status, issued_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING license_id, created_at, updated_at, version`
+
+	args := []interface{}{
+		l.LicenseNumber,
+		l.TeacherID,
+		nullInt(l.ApplicationID),
+		l.LicenseClass,
+		l.Level,
+		l.IssueDate,
+		l.ExpiryDate,
+		l.Status,
+		nullInt(l.IssuedBy),
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&l.ID, &l.CreatedAt, &l.UpdatedAt, &l.Version)
+	if err != nil {
+		if isUniqueViolation(err, "licenses_application_id_key") {
+			return nil, ErrDuplicateLicense
+		}
+		return nil, err
+	}
+
+	event := &LicenseEvent{
+		LicenseID:  l.ID,
+		Action:     LicenseActionIssue,
+		ToStatus:   l.Status,
+		ExpiryDate: l.ExpiryDate,
+		Reason:     reason,
+		ActorID:    actorID,
+	}
+	if err = insertLicenseEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Renew extends a license by validityYears from its current expiry date,
+// or from today if it has already expired.
+func (m *LicenseModel) Renew(l *License, validityYears int, reason string, actorID int) (*LicenseEvent, error) {
+	return m.changeStatus(l, LicenseActionRenew, validityYears, reason, actorID)
+}
+
+// Suspend temporarily suspends an active license
+func (m *LicenseModel) Suspend(l *License, reason string, actorID int) (*LicenseEvent, error) {
+	return m.changeStatus(l, LicenseActionSuspend, 0, reason, actorID)
+}
+
+// Reinstate lifts a suspension
+func (m *LicenseModel) Reinstate(l *License, reason string, actorID int) (*LicenseEvent, error) {
+	return m.changeStatus(l, LicenseActionReinstate, 0, reason, actorID)
+}
+
+// Revoke permanently revokes a license
+func (m *LicenseModel) Revoke(l *License, reason string, actorID int) (*LicenseEvent, error) {
+	return m.changeStatus(l, LicenseActionRevoke, 0, reason, actorID)
+}
+
+// changeStatus applies a license action and records it in license_events in
+// the same transaction
+func (m *LicenseModel) changeStatus(l *License, action string, validityYears int, reason string, actorID int) (*LicenseEvent, error) {
+	transition, ok := licenseTransitions[action]
+	if !ok || !slices.Contains(transition.from, l.Status) {
+		return nil, ErrInvalidTransition
+	}
+
+	event := &LicenseEvent{
+		LicenseID:  l.ID,
+		Action:     action,
+		FromStatus: l.Status,
+		ToStatus:   transition.to,
+		Reason:     reason,
+		ActorID:    actorID,
+	}
+
+	if action == LicenseActionRenew {
+		now := time.Now()
+		from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		if l.ExpiryDate.After(from) {
+			from = l.ExpiryDate
+		}
+		l.ExpiryDate = from.AddDate(validityYears, 0, 0)
+	}
+	l.Status = transition.to
+	event.ExpiryDate = l.ExpiryDate
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE licenses
+		SET status = $1, expiry_date = $2, updated_at = NOW(), version = version + 1
+		WHERE license_id = $3 AND version = $4
+		RETURNING updated_at, version`
+
+	err = tx.QueryRowContext(ctx, query, l.Status, l.ExpiryDate, l.ID, l.Version).Scan(&l.UpdatedAt, &l.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrEditConflict
+		default:
+			return nil, err
+		}
+	}
+
+	if err = insertLicenseEvent(ctx, tx, event); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// insertLicenseEvent writes a license event inside an open transaction
+func insertLicenseEvent(ctx context.Context, tx *sql.Tx, e *LicenseEvent) error {
+	query := `
+		INSERT INTO license_events (license_id, action, from_status, to_status, expiry_date, reason, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING event_id, created_at`
+
+	args := []interface{}{
+		e.LicenseID,
+		e.Action,
+		nullString(e.FromStatus),
+		e.ToStatus,
+		e.ExpiryDate,
+		e.Reason,
+		nullInt(e.ActorID),
+	}
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(&e.ID, &e.CreatedAt)
+}
+
+// Get returns a license by id
+func (m *LicenseModel) Get(id int) (*License, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `SELECT ` + licenseColumns + ` FROM licenses WHERE license_id = $1` + liveTeacherCondition("teacher_id")
+	args := []any{id}
+	query += m.Scope.teacherCondition("teacher_id", &args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	l, err := scanLicense(m.DB.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// licenseSortColumns maps the sort values accepted for licenses to columns
+var licenseSortColumns = sortColumns{
+	"license_id":     "l.license_id",
+	"license_number": "l.license_number",
+	"issue_date":     "l.issue_date",
+	"expiry_date":    "l.expiry_date",
+}
+
+// LicenseSortSafelist lists the sort values accepted for licenses
+var LicenseSortSafelist = licenseSortColumns.safelist()
+
+// GetAll returns licenses with optional teacher, status and class filters
+func (m *LicenseModel) GetAll(teacherID int, status string, licenseClass string, filters Filters) ([]*License, Metadata, error) {
+	sortColumn, err := filters.sortColumn(licenseSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query := `
+		SELECT count(*) OVER(), * FROM (
+			SELECT ` + licenseColumns + ` FROM licenses
+		) AS l (license_id, license_number, teacher_id, application_id, license_class, level, issue_date, expiry_date,
+		        status, issued_by, created_at, updated_at, version)
+		WHERE 1=1`
+
+	args := []interface{}{}
+	argCount := 0
+
+	if teacherID > 0 {
+		argCount++
+		query += fmt.Sprintf(" AND teacher_id = $%d", argCount)
+		args = append(args, teacherID)
+	}
+
+	if status != "" {
+		argCount++
+		query += fmt.Sprintf(" AND status = $%d", argCount)
+		args = append(args, status)
+	}
+
+	if licenseClass != "" {
+		argCount++
+		query += fmt.Sprintf(" AND license_class = $%d", argCount)
+		args = append(args, licenseClass)
+	}
+
+	query += liveTeacherCondition("teacher_id")
+	query += m.Scope.teacherCondition("teacher_id", &args)
+	argCount = len(args)
+
+	query += fmt.Sprintf(" ORDER BY %s %s, l.license_id ASC", sortColumn, filters.sortDirection())
+
+	argCount++
+	limitArg := argCount
+	argCount++
+	offsetArg := argCount
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", limitArg, offsetArg)
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	licenses := []*License{}
+	for rows.Next() {
+		l, err := scanLicense(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		licenses = append(licenses, l)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return licenses, metadata, nil
+}
+
+// GetEvents returns the history of a license, oldest first
+func (m *LicenseModel) GetEvents(licenseID int) ([]*LicenseEvent, error) {
+	query := `
+		SELECT event_id, license_id, action, COALESCE(from_status, ''), to_status, expiry_date, reason, actor_id, created_at
+		FROM license_events
+		WHERE license_id = $1
+		ORDER BY created_at, event_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []*LicenseEvent{}
+	for rows.Next() {
+		var e LicenseEvent
+		var actorID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.LicenseID, &e.Action, &e.FromStatus, &e.ToStatus, &e.ExpiryDate, &e.Reason, &actorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			e.ActorID = int(actorID.Int64)
+		}
+		out = append(out, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scanLicense reads one license row selected with licenseColumns
+func scanLicense(row rowScanner, prefix ...any) (*License, error) {
+	var l License
+	var applicationID sql.NullInt64
+	var issuedBy sql.NullInt64
+
+	dest := append(prefix,
+		&l.ID,
+		&l.LicenseNumber,
+		&l.TeacherID,
+		&applicationID,
+		&l.LicenseClass,
+		&l.Level,
+		&l.IssueDate,
+		&l.ExpiryDate,
+		&l.Status,
+		&issuedBy,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+		&l.Version,
+	)
+
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	if applicationID.Valid {
+		l.ApplicationID = int(applicationID.Int64)
+	}
+	if issuedBy.Valid {
+		l.IssuedBy = int(issuedBy.Int64)
+	}
+	return &l, nil
+}
+
+// LicenseVerification is the public view of a license. It carries only what
+// is needed to confirm that the holder is licensed.
+type LicenseVerification struct {
+	LicenseNumber string    `json:"license_number"`
+	Name          string    `json:"name"`
+	LicenseClass  string    `json:"license_class"`
+	Level         string    `json:"level"`
+	Status        string    `json:"status"`
+	ExpiryDate    time.Time `json:"expiry_date"`
+}
+
+// LicenseNumberRX matches license numbers such as CYO-2025-00042
+var LicenseNumberRX = regexp.MustCompile(`^[A-Z]{2,5}-[0-9]{4}-[0-9]{5,}$`)
+
+// Signed reports whether verification codes may be issued and honoured
+// for the license. Only a license whose effective status is active
+// qualifies, so a code never vouches for a revoked, suspended or expired
+// license.
+func (lv *LicenseVerification) Signed() bool {
+	return lv.Status == LicenseStatusActive
+}
+
+// SigningPayload returns the fields covered by the verification code. The
+// status is not part of the payload because codes are only issued and
+// accepted while the license is active; see Signed.
+func (lv *LicenseVerification) SigningPayload() []byte {
+	fields := []string{
+		"impartbelize-license-v1",
+		lv.LicenseNumber,
+		lv.Name,
+		lv.LicenseClass,
+		lv.Level,
+		lv.ExpiryDate.Format("2006-01-02"),
+	}
+	return []byte(strings.Join(fields, "|"))
+}
+
+// GetVerification returns the public view of a license by its number.
+// Licenses of deleted teachers are not found.
+func (m *LicenseModel) GetVerification(licenseNumber string) (*LicenseVerification, error) {
+	query := `
+		SELECT l.license_number, t.first_name || ' ' || t.last_name, l.license_class, l.level,
+		       CASE WHEN l.status = 'active' AND l.expiry_date < CURRENT_DATE THEN 'expired' ELSE l.status END,
+		       l.expiry_date
+		FROM licenses l
+		INNER JOIN teachers t ON l.teacher_id = t.teacher_id
+		WHERE l.license_number = $1 AND t.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lv LicenseVerification
+	err := m.DB.QueryRowContext(ctx, query, licenseNumber).Scan(
+		&lv.LicenseNumber,
+		&lv.Name,
+		&lv.LicenseClass,
+		&lv.Level,
+		&lv.Status,
+		&lv.ExpiryDate,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &lv, nil
+}
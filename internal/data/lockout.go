@@ -0,0 +1,315 @@
+// Filename: internal/data/lockout.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Actions recorded in the account event history
+const (
+	AccountActionLocked   = "locked"
+	AccountActionUnlocked = "unlocked"
+)
+
+// maxLoginDelay caps the wait between failed login attempts
+const maxLoginDelay = 30 * time.Second
+
+// Lockout is the failed login state of an account
+type Lockout struct {
+	UserID         int64      `json:"user_id"`
+	FailedAttempts int        `json:"failed_login_attempts"`
+	LastFailedAt   *time.Time `json:"last_failed_login_at,omitempty"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+}
+
+// RetryAfter returns how long the account must wait before another login
+// attempt is considered. Accounts are locked outright until LockedUntil;
+// otherwise each failure doubles the wait, starting at one second.
+func (l *Lockout) RetryAfter(now time.Time) time.Duration {
+	if l.LockedUntil != nil && l.LockedUntil.After(now) {
+		return l.LockedUntil.Sub(now)
+	}
+	if l.FailedAttempts == 0 || l.LastFailedAt == nil {
+		return 0
+	}
+
+	delay := maxLoginDelay
+	if l.FailedAttempts <= 5 {
+		delay = min(time.Second<<(l.FailedAttempts-1), maxLoginDelay)
+	}
+	if next := l.LastFailedAt.Add(delay); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// AccountEvent records an account being locked or unlocked
+type AccountEvent struct {
+	ID        int       `json:"event_id"`
+	UserID    int64     `json:"user_id"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	ActorID   int       `json:"actor_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetLockout returns the failed login state of a user
+func (u *UserModel) GetLockout(userID int64) (*Lockout, error) {
+	query := `
+		SELECT user_id, failed_login_attempts, last_failed_login_at, locked_until
+		FROM users
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return scanLockout(u.DB.QueryRowContext(ctx, query, userID))
+}
+
+func scanLockout(row rowScanner) (*Lockout, error) {
+	var l Lockout
+	var lastFailedAt, lockedUntil sql.NullTime
+
+	err := row.Scan(&l.UserID, &l.FailedAttempts, &lastFailedAt, &lockedUntil)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if lastFailedAt.Valid {
+		l.LastFailedAt = &lastFailedAt.Time
+	}
+	if lockedUntil.Valid {
+		l.LockedUntil = &lockedUntil.Time
+	}
+	return &l, nil
+}
+
+// ReserveLoginAttempt claims a login attempt for the user before their
+// credentials are checked. The attempt is counted as failed up front, in
+// the same statement that checks the account is not locked and has waited
+// out the delay since its last failure, so concurrent attempts cannot all
+// slip through before any of them is counted. It returns false, with the
+// current state, when the user must wait. An attempt that succeeds is
+// cleared by RecordLogin, and one that neither fails nor logs in is given
+// back with ReleaseLoginAttempt.
+func (u *UserModel) ReserveLoginAttempt(userID int64) (*Lockout, bool, error) {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = failed_login_attempts + 1, last_failed_login_at = NOW()
+		WHERE user_id = $1
+		AND (locked_until IS NULL OR locked_until <= NOW())
+		AND (failed_login_attempts = 0 OR last_failed_login_at IS NULL
+		     OR last_failed_login_at + LEAST(power(2, LEAST(failed_login_attempts, 6) - 1), $2) * INTERVAL '1 second' <= NOW())
+		RETURNING user_id, failed_login_attempts, last_failed_login_at, locked_until`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	lockout, err := scanLockout(u.DB.QueryRowContext(ctx, query, userID, int(maxLoginDelay.Seconds())))
+	if err == nil {
+		return lockout, true, nil
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	lockout, err = u.GetLockout(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return lockout, false, nil
+}
+
+// ReleaseLoginAttempt gives back an attempt reserved with
+// ReserveLoginAttempt that neither failed nor logged in, such as a right
+// password that still needs a two-factor code. Earlier failures still
+// count, and their delay runs from the released attempt.
+func (u *UserModel) ReleaseLoginAttempt(userID int64) error {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = GREATEST(failed_login_attempts - 1, 0),
+		    last_failed_login_at = CASE WHEN failed_login_attempts <= 1 THEN NULL ELSE last_failed_login_at END
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// RecordFailedLogin records that an attempt reserved with
+// ReserveLoginAttempt failed. Once threshold failures have been counted
+// the account is locked for lockDuration, a locked event and a lock in the
+// audit trail are recorded, and the count starts again. The updated state
+// is returned.
+func (u *UserModel) RecordFailedLogin(userID int64, threshold int, lockDuration time.Duration, ipAddress string) (*Lockout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT user_id, failed_login_attempts, last_failed_login_at, locked_until
+		FROM users
+		WHERE user_id = $1
+		FOR UPDATE`
+
+	lockout, err := scanLockout(tx.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if lockout.FailedAttempts >= threshold {
+		query = `
+			UPDATE users
+			SET failed_login_attempts = 0, locked_until = NOW() + $2 * INTERVAL '1 second'
+			WHERE user_id = $1
+			RETURNING user_id, failed_login_attempts, last_failed_login_at, locked_until`
+
+		// Nobody is signed in when an account locks, so the audit event
+		// only carries the address the failed attempt came from
+		actor := Actor{IP: ipAddress}
+		err = actor.auditTx(ctx, tx, auditUser, AuditActionLock, userID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+			lockout, err = scanLockout(tx.QueryRowContext(ctx, query, userID, int(lockDuration.Seconds())))
+			if err != nil {
+				return 0, err
+			}
+
+			event := &AccountEvent{
+				UserID:    userID,
+				Action:    AccountActionLocked,
+				Detail:    fmt.Sprintf("%d failed login attempts", threshold),
+				IPAddress: ipAddress,
+			}
+			if err = insertAccountEvent(ctx, tx, event); err != nil {
+				return 0, err
+			}
+			return userID, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return lockout, nil
+}
+
+// RecordLogin clears the failed login count and sets last_login
+func (u *UserModel) RecordLogin(userID int64) error {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL, last_login = NOW()
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := u.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Unlock clears a user's lockout on behalf of an administrator and records
+// an unlocked event
+func (u *UserModel) Unlock(userID int64, actorID int) (*AccountEvent, error) {
+	query := `
+		UPDATE users
+		SET failed_login_attempts = 0, last_failed_login_at = NULL, locked_until = NULL
+		WHERE user_id = $1`
+
+	event := &AccountEvent{
+		UserID:  userID,
+		Action:  AccountActionUnlocked,
+		ActorID: actorID,
+	}
+
+	err := u.Actor.audit(u.DB, auditUser, AuditActionUnlock, userID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		result, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return 0, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if rowsAffected == 0 {
+			return 0, ErrRecordNotFound
+		}
+
+		if err = insertAccountEvent(ctx, tx, event); err != nil {
+			return 0, err
+		}
+		return userID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func insertAccountEvent(ctx context.Context, tx *sql.Tx, event *AccountEvent) error {
+	query := `
+		INSERT INTO account_events (user_id, action, detail, ip_address, actor_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING event_id, created_at`
+
+	args := []interface{}{
+		event.UserID,
+		event.Action,
+		nullString(event.Detail),
+		nullString(event.IPAddress),
+		nullInt(event.ActorID),
+	}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetAccountEvents returns a user's lock and unlock history, newest first
+func (u *UserModel) GetAccountEvents(userID int64) ([]*AccountEvent, error) {
+	query := `
+		SELECT event_id, user_id, action, COALESCE(detail, ''), COALESCE(ip_address, ''), actor_id, created_at
+		FROM account_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC, event_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AccountEvent{}
+	for rows.Next() {
+		var e AccountEvent
+		var actorID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Action, &e.Detail, &e.IPAddress, &actorID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			e.ActorID = int(actorID.Int64)
+		}
+		events = append(events, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -2,34 +2,52 @@ package data
 
 import (
 	"database/sql"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
 )
 
 // Model struct to wrap all data models
 type Models struct {
+	Applications   *ApplicationModel
+	Audit          *AuditModel
 	Tokens         *TokenModel
 	Districts      *DistrictModel
 	Documents      *DocumentModel
+	DocumentTypes  *DocumentTypeModel
 	Education      *EducationModel
 	Institutions   *InstitutionModel
+	Licenses       *LicenseModel
+	LicenseTypes   *LicenseTypeModel
 	Notifications  *NotificationModel
+	Permissions    *PermissionModel
 	Qualifications *QualificationModel
 	Roles          *RoleModel
 	Teachers       *TeacherModel
+	TwoFactor      *TwoFactorModel
 	Users          *UserModel
 }
 
-// NewModels initializes and returns a new Models struct
-func NewModels(db *sql.DB) *Models {
+// NewModels initializes and returns a new Models struct. The keyring
+// seals teachers' sensitive fields and two-factor secrets, and may be nil
+// for tools that never read or write them.
+func NewModels(db *sql.DB, keyring *encryption.Keyring) *Models {
 	return &Models{
+		Applications:   &ApplicationModel{DB: db},
+		Audit:          &AuditModel{DB: db},
 		Tokens:         &TokenModel{DB: db},
 		Districts:      &DistrictModel{DB: db},
 		Documents:      &DocumentModel{DB: db},
+		DocumentTypes:  &DocumentTypeModel{DB: db},
 		Education:      &EducationModel{DB: db},
 		Institutions:   &InstitutionModel{DB: db},
+		Licenses:       &LicenseModel{DB: db},
+		LicenseTypes:   &LicenseTypeModel{DB: db},
 		Notifications:  &NotificationModel{DB: db},
+		Permissions:    &PermissionModel{DB: db},
 		Qualifications: &QualificationModel{DB: db},
 		Roles:          &RoleModel{DB: db},
-		Teachers:       &TeacherModel{DB: db},
+		Teachers:       &TeacherModel{DB: db, Keyring: keyring},
+		TwoFactor:      &TwoFactorModel{DB: db, Keyring: keyring},
 		Users:          &UserModel{DB: db},
 	}
 }
@@ -38,15 +56,22 @@ func NewModels(db *sql.DB) *Models {
 // with nil DB connections (for validation tests that don't need database)
 func NewTestModels() *Models {
 	return &Models{
+		Applications:   &ApplicationModel{DB: nil},
+		Audit:          &AuditModel{DB: nil},
 		Tokens:         &TokenModel{DB: nil},
 		Districts:      &DistrictModel{DB: nil},
 		Documents:      &DocumentModel{DB: nil},
+		DocumentTypes:  &DocumentTypeModel{DB: nil},
 		Education:      &EducationModel{DB: nil},
 		Institutions:   &InstitutionModel{DB: nil},
+		Licenses:       &LicenseModel{DB: nil},
+		LicenseTypes:   &LicenseTypeModel{DB: nil},
 		Notifications:  &NotificationModel{DB: nil},
+		Permissions:    &PermissionModel{DB: nil},
 		Qualifications: &QualificationModel{DB: nil},
 		Roles:          &RoleModel{DB: nil},
 		Teachers:       &TeacherModel{DB: nil},
+		TwoFactor:      &TwoFactorModel{DB: nil},
 		Users:          &UserModel{DB: nil},
 	}
 }
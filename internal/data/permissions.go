@@ -0,0 +1,174 @@
+// Filename: internal/data/permissions.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Codes of the permissions seeded into the permissions table
+const (
+	PermissionUsersRead             = "users:read"
+	PermissionUsersUpdate           = "users:update"
+	PermissionUsersManage           = "users:manage"
+	PermissionRolesManage           = "roles:manage"
+	PermissionDistrictsCreate       = "districts:create"
+	PermissionDistrictsUpdate       = "districts:update"
+	PermissionDistrictsDelete       = "districts:delete"
+	PermissionInstitutionsCreate    = "institutions:create"
+	PermissionInstitutionsUpdate    = "institutions:update"
+	PermissionInstitutionsDelete    = "institutions:delete"
+	PermissionTeachersCreate        = "teachers:create"
+	PermissionTeachersDelete        = "teachers:delete"
+	PermissionTeachersManage        = "teachers:manage"
+	PermissionTeachersReadPII       = "teachers:read_pii"
+	PermissionDocumentsVerify       = "documents:verify"
+	PermissionDocumentTypesManage   = "document_types:manage"
+	PermissionApplicationsRead      = "applications:read"
+	PermissionApplicationsDelete    = "applications:delete"
+	PermissionApplicationsSubmit    = "applications:submit"
+	PermissionApplicationsWithdraw  = "applications:withdraw"
+	PermissionApplicationsReviewDEC = "applications:review_dec"
+	PermissionApplicationsReviewTSC = "applications:review_tsc"
+	PermissionApplicationsApprove   = "applications:approve"
+	PermissionLicensesRead          = "licenses:read"
+	PermissionLicensesIssue         = "licenses:issue"
+	PermissionLicensesSuspend       = "licenses:suspend"
+	PermissionNotificationsCreate   = "notifications:create"
+	PermissionAuditRead             = "audit:read"
+	PermissionRecordsRestore        = "records:restore"
+	PermissionRecordsPurge          = "records:purge"
+)
+
+// Permission is a named action that roles can be granted
+type Permission struct {
+	ID          int    `json:"permission_id"`
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+}
+
+// Permissions holds the permission codes granted to a user or role
+type Permissions []string
+
+// Include reports whether code is one of the permissions
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// PermissionModel wraps a database connection pool
+type PermissionModel struct {
+	DB    *sql.DB
+	Actor Actor // recorded in the audit trail for changes
+}
+
+// GetAll returns every permission that can be granted
+func (m *PermissionModel) GetAll() ([]*Permission, error) {
+	query := `
+		SELECT permission_id, code, COALESCE(description, '')
+		FROM permissions
+		ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Code, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// GetAllForUser returns the permission codes granted to a user's role
+func (m *PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	query := `
+		SELECT p.code
+		FROM permissions p
+		INNER JOIN role_permissions rp ON rp.permission_id = p.permission_id
+		INNER JOIN users u ON u.role_id = rp.role_id
+		WHERE u.user_id = $1
+		ORDER BY p.code`
+
+	return m.queryCodes(query, userID)
+}
+
+// GetAllForRole returns the permission codes granted to a role
+func (m *PermissionModel) GetAllForRole(roleID int) (Permissions, error) {
+	query := `
+		SELECT p.code
+		FROM permissions p
+		INNER JOIN role_permissions rp ON rp.permission_id = p.permission_id
+		WHERE rp.role_id = $1
+		ORDER BY p.code`
+
+	return m.queryCodes(query, roleID)
+}
+
+func (m *PermissionModel) queryCodes(query string, args ...any) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, code)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// SetForRole replaces the permissions granted to a role. Unknown codes are
+// reported as ErrUnknownPermission and nothing is changed.
+func (m *PermissionModel) SetForRole(roleID int, codes ...string) error {
+	return m.Actor.audit(m.DB, auditRolePermissions, AuditActionSetPermissions, int64(roleID), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		_, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID)
+		if err != nil {
+			return 0, err
+		}
+
+		query := `
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, permission_id FROM permissions WHERE code = ANY($2)`
+
+		result, err := tx.ExecContext(ctx, query, roleID, pq.Array(codes))
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if int(rowsAffected) != len(codes) {
+			return 0, ErrUnknownPermission
+		}
+		return int64(roleID), nil
+	})
+}
@@ -3,7 +3,11 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
 type Qualification struct {
@@ -16,6 +20,25 @@ type Qualification struct {
 	InstitutionID  int    `json:"institution_id,omitempty"`
 }
 
+// ValidateQualification checks the fields of a qualification
+func ValidateQualification(v *validator.Validator, q *Qualification) {
+	v.Check(q.TeacherID > 0, "teacher_id", "must be provided")
+	v.Check(len(q.Institution) <= 150, "institution", "must not be more than 150 characters long")
+	v.Check(len(q.Specialization) <= 100, "specialization", "must not be more than 100 characters long")
+	v.Check(len(q.Certification) <= 150, "certification", "must not be more than 150 characters long")
+	v.Check(q.YearObtained >= 0, "year_obtained", "must not be negative")
+}
+
+// qualificationSortColumns maps the sort values accepted for qualifications to columns
+var qualificationSortColumns = sortColumns{
+	"qualification_id": "qualification_id",
+	"institution":      "institution",
+	"year_obtained":    "year_obtained",
+}
+
+// QualificationSortSafelist lists the sort values accepted for qualifications
+var QualificationSortSafelist = qualificationSortColumns.safelist()
+
 type QualificationModel struct {
 	DB *sql.DB
 }
@@ -43,25 +66,69 @@ func (m *QualificationModel) Insert(q *Qualification) error {
 	return m.DB.QueryRowContext(ctx, query, q.TeacherID, q.Institution, q.Specialization, q.Certification, year, inst).Scan(&q.ID)
 }
 
-func (m *QualificationModel) GetByTeacher(teacherID int) ([]*Qualification, error) {
-	query := `SELECT qualification_id, teacher_id, institution, specialization, certification, year_obtained, institution_id FROM qualifications WHERE teacher_id = $1 ORDER BY year_obtained DESC NULLS LAST`
+func (m *QualificationModel) Get(id int) (*Qualification, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT qualification_id, teacher_id, institution, specialization, certification, year_obtained, institution_id FROM qualifications WHERE qualification_id = $1` + liveTeacherCondition("teacher_id")
+
+	var q Qualification
+	var year sql.NullInt64
+	var inst sql.NullInt64
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, teacherID)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&q.ID, &q.TeacherID, &q.Institution, &q.Specialization, &q.Certification, &year, &inst)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if year.Valid {
+		q.YearObtained = int(year.Int64)
+	}
+	if inst.Valid {
+		q.InstitutionID = int(inst.Int64)
+	}
+	return &q, nil
+}
+
+// GetByTeacher returns a page of a teacher's qualifications, most recent
+// first by default
+func (m *QualificationModel) GetByTeacher(teacherID int, filters Filters) ([]*Qualification, Metadata, error) {
+	sortColumn, err := filters.sortColumn(qualificationSortColumns)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), qualification_id, teacher_id, institution, specialization, certification, year_obtained, institution_id
+		FROM qualifications
+		WHERE teacher_id = $1%s
+		ORDER BY %s %s NULLS LAST, qualification_id ASC
+		LIMIT $2 OFFSET $3`, liveTeacherCondition("teacher_id"), sortColumn, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, teacherID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	res := []*Qualification{}
 	for rows.Next() {
 		var q Qualification
 		var year sql.NullInt64
 		var inst sql.NullInt64
-		if err := rows.Scan(&q.ID, &q.TeacherID, &q.Institution, &q.Specialization, &q.Certification, &year, &inst); err != nil {
-			return nil, err
+		if err := rows.Scan(&totalRecords, &q.ID, &q.TeacherID, &q.Institution, &q.Specialization, &q.Certification, &year, &inst); err != nil {
+			return nil, Metadata{}, err
 		}
 		if year.Valid {
 			q.YearObtained = int(year.Int64)
@@ -72,9 +139,32 @@ func (m *QualificationModel) GetByTeacher(teacherID int) ([]*Qualification, erro
 		res = append(res, &q)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
-	return res, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return res, metadata, nil
+}
+
+// Update saves changes to a qualification
+func (m *QualificationModel) Update(q *Qualification) error {
+	query := `UPDATE qualifications SET institution = $1, specialization = $2, certification = $3, year_obtained = $4, institution_id = $5 WHERE qualification_id = $6`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, q.Institution, q.Specialization, q.Certification, nullInt(q.YearObtained), nullInt(q.InstitutionID), q.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
 }
 
 func (m *QualificationModel) Delete(id int) error {
@@ -10,10 +10,22 @@ import (
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
+// Names of the roles seeded into the roles table
+const (
+	RoleAdmin     = "Admin"
+	RoleDEC       = "DEC"
+	RoleTeacher   = "Teacher"
+	RoleTSC       = "TSC"
+	RoleCEO       = "CEO"
+	RoleSecretary = "Secretary"
+)
+
 // Role struct represents a system role
 type Role struct {
-	ID       int    `json:"id"`
-	RoleName string `json:"role_name"`
+	ID                int    `json:"id"`
+	RoleName          string `json:"role_name"`
+	RequiresTwoFactor bool   `json:"requires_two_factor"`
+	DistrictScoped    bool   `json:"district_scoped"`
 }
 
 // ValidateRole validates a role struct
@@ -24,20 +36,21 @@ func ValidateRole(v *validator.Validator, role *Role) {
 
 // RoleModel wraps a database connection pool
 type RoleModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Actor Actor // recorded in the audit trail for changes
 }
 
 // Insert a new role record in the database
 func (r *RoleModel) Insert(role *Role) error {
 	query := `
-		INSERT INTO roles (name)
-		VALUES ($1)
+		INSERT INTO roles (name, requires_two_factor, district_scoped)
+		VALUES ($1, $2, $3)
 		RETURNING role_id`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return r.DB.QueryRowContext(ctx, query, role.RoleName).Scan(&role.ID)
+	return r.Actor.audit(r.DB, auditRole, AuditActionCreate, 0, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, role.RoleName, role.RequiresTwoFactor, role.DistrictScoped).Scan(&role.ID)
+		return int64(role.ID), err
+	})
 }
 
 // Get retrieves a specific role based on its ID
@@ -47,7 +60,7 @@ func (r *RoleModel) Get(id int) (*Role, error) {
 	}
 
 	query := `
-		SELECT role_id, name
+		SELECT role_id, name, requires_two_factor, district_scoped
 		FROM roles
 		WHERE role_id = $1`
 
@@ -59,6 +72,8 @@ func (r *RoleModel) Get(id int) (*Role, error) {
 	err := r.DB.QueryRowContext(ctx, query, id).Scan(
 		&role.ID,
 		&role.RoleName,
+		&role.RequiresTwoFactor,
+		&role.DistrictScoped,
 	)
 
 	if err != nil {
@@ -76,7 +91,7 @@ func (r *RoleModel) Get(id int) (*Role, error) {
 // GetByName retrieves a role by its name (useful for authentication)
 func (r *RoleModel) GetByName(name string) (*Role, error) {
 	query := `
-		SELECT role_id, name
+		SELECT role_id, name, requires_two_factor, district_scoped
 		FROM roles
 		WHERE name = $1`
 
@@ -88,6 +103,8 @@ func (r *RoleModel) GetByName(name string) (*Role, error) {
 	err := r.DB.QueryRowContext(ctx, query, name).Scan(
 		&role.ID,
 		&role.RoleName,
+		&role.RequiresTwoFactor,
+		&role.DistrictScoped,
 	)
 
 	if err != nil {
@@ -105,7 +122,7 @@ func (r *RoleModel) GetByName(name string) (*Role, error) {
 // GetAll retrieves all roles from the database
 func (r *RoleModel) GetAll() ([]*Role, error) {
 	query := `
-		SELECT role_id, name
+		SELECT role_id, name, requires_two_factor, district_scoped
 		FROM roles
 		ORDER BY name`
 
@@ -126,6 +143,8 @@ func (r *RoleModel) GetAll() ([]*Role, error) {
 		err := rows.Scan(
 			&role.ID,
 			&role.RoleName,
+			&role.RequiresTwoFactor,
+			&role.DistrictScoped,
 		)
 		if err != nil {
 			return nil, err
@@ -145,19 +164,20 @@ func (r *RoleModel) GetAll() ([]*Role, error) {
 func (r *RoleModel) Update(role *Role) error {
 	query := `
 		UPDATE roles
-		SET name = $2
+		SET name = $2, requires_two_factor = $3, district_scoped = $4
 		WHERE role_id = $1`
 
 	args := []interface{}{
 		role.ID,
 		role.RoleName,
+		role.RequiresTwoFactor,
+		role.DistrictScoped,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	_, err := r.DB.ExecContext(ctx, query, args...)
-	return err
+	return r.Actor.audit(r.DB, auditRole, AuditActionUpdate, int64(role.ID), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		_, err := tx.ExecContext(ctx, query, args...)
+		return int64(role.ID), err
+	})
 }
 
 // Delete removes a role record from the database
@@ -168,22 +188,20 @@ func (r *RoleModel) Delete(id int) error {
 
 	query := `DELETE FROM roles WHERE role_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	result, err := r.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
-	}
+	return r.Actor.audit(r.DB, auditRole, AuditActionDelete, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		result, err := tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return 0, err
+		}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
 
-	return nil
+		if rowsAffected == 0 {
+			return 0, ErrRecordNotFound
+		}
+		return int64(id), nil
+	})
 }
@@ -0,0 +1,153 @@
+// Filename: internal/data/scope.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DistrictScope limits the teachers, documents and applications a model
+// can see to those belonging to teachers in a set of districts. The zero
+// value sees nothing, so a model that was never given a scope fails closed;
+// AllDistricts is the explicit unrestricted scope.
+type DistrictScope struct {
+	all         bool
+	districtIDs []int
+}
+
+// AllDistricts returns a scope that sees every district
+func AllDistricts() DistrictScope {
+	return DistrictScope{all: true}
+}
+
+// InDistricts returns a scope limited to the given districts. With no
+// districts nothing is visible.
+func InDistricts(districtIDs ...int) DistrictScope {
+	return DistrictScope{districtIDs: districtIDs}
+}
+
+// Restricted reports whether the scope hides records outside its districts
+func (s DistrictScope) Restricted() bool {
+	return !s.all
+}
+
+// Allows reports whether records in the district are visible
+func (s DistrictScope) Allows(districtID int) bool {
+	return s.all || slices.Contains(s.districtIDs, districtID)
+}
+
+// districtCondition limits column, a district id, to the scope. The
+// districts are appended to args and referenced by position.
+func (s DistrictScope) districtCondition(column string, args *[]any) string {
+	if s.all {
+		return ""
+	}
+	*args = append(*args, pq.Array(s.districtIDs))
+	return fmt.Sprintf(" AND %s = ANY($%d)", column, len(*args))
+}
+
+// teacherCondition limits column, a teacher id, to teachers in the scope
+func (s DistrictScope) teacherCondition(column string, args *[]any) string {
+	if s.all {
+		return ""
+	}
+	*args = append(*args, pq.Array(s.districtIDs))
+	return fmt.Sprintf(" AND %s IN (SELECT teacher_id FROM teachers WHERE district_id = ANY($%d))", column, len(*args))
+}
+
+// WithDistrictScope returns a copy of the models whose teacher, document,
+// application and license queries are limited to the scope
+func (m *Models) WithDistrictScope(scope DistrictScope) *Models {
+	scoped := *m
+
+	teachers := *m.Teachers
+	teachers.Scope = scope
+	scoped.Teachers = &teachers
+
+	documents := *m.Documents
+	documents.Scope = scope
+	scoped.Documents = &documents
+
+	applications := *m.Applications
+	applications.Scope = scope
+	scoped.Applications = &applications
+
+	licenses := *m.Licenses
+	licenses.Scope = scope
+	scoped.Licenses = &licenses
+
+	return &scoped
+}
+
+// Unscoped returns a copy of the models that see teachers, documents and
+// applications in every district. Request handlers should only use it for
+// lookups that must not depend on the user's districts, such as finding
+// the user's own teacher profile.
+func (m *Models) Unscoped() *Models {
+	return m.WithDistrictScope(AllDistricts())
+}
+
+// GetDistricts returns the ids of the districts a user is assigned to
+func (u *UserModel) GetDistricts(userID int64) ([]int, error) {
+	query := `
+		SELECT district_id
+		FROM user_districts
+		WHERE user_id = $1
+		ORDER BY district_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	districtIDs := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		districtIDs = append(districtIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return districtIDs, nil
+}
+
+// SetDistricts replaces the districts a user is assigned to. Unknown
+// districts are reported as ErrRecordNotFound and nothing is changed.
+func (u *UserModel) SetDistricts(userID int64, districtIDs ...int) error {
+	return u.Actor.audit(u.DB, auditUserDistricts, AuditActionSetDistricts, userID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_districts WHERE user_id = $1`, userID)
+		if err != nil {
+			return 0, err
+		}
+
+		query := `
+			INSERT INTO user_districts (user_id, district_id)
+			SELECT $1, district_id FROM districts WHERE district_id = ANY($2)`
+
+		result, err := tx.ExecContext(ctx, query, userID, pq.Array(districtIDs))
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if int(rowsAffected) != len(districtIDs) {
+			return 0, ErrRecordNotFound
+		}
+		return userID, nil
+	})
+}
@@ -4,113 +4,335 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
+	"unicode"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
 
-// Teacher represents a teacher profile
+// ErrDuplicateSSN is returned when a teacher's SSN is already on file for
+// another teacher.
+var ErrDuplicateSSN = errors.New("duplicate ssn")
+
+// Teacher represents a teacher profile. It has no JSON encoding of its
+// own, so it cannot be written out before it is reduced to the reader's
+// view.
 type Teacher struct {
-	ID            int        `json:"teacher_id"`
-	UserID        int        `json:"user_id,omitempty"`
-	FirstName     string     `json:"first_name"`
-	LastName      string     `json:"last_name"`
-	Gender        string     `json:"gender,omitempty"`
-	DOB           *time.Time `json:"dob,omitempty"`
-	SSN           string     `json:"ssn,omitempty"`
-	MaritalStatus string     `json:"marital_status,omitempty"`
-	Email         string     `json:"email"`
-	Address       string     `json:"address,omitempty"`
-	DistrictID    int        `json:"district_id,omitempty"`
-	Phone         string     `json:"phone,omitempty"`
-	ProfileStatus string     `json:"profile_status,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
+	ID            int        `json:"-"`
+	UserID        int        `json:"-"`
+	FirstName     string     `json:"-"`
+	LastName      string     `json:"-"`
+	Gender        string     `json:"-"`
+	DOB           *time.Time `json:"-"`
+	SSN           string     `json:"-"`
+	MaritalStatus string     `json:"-"`
+	Email         string     `json:"-"`
+	Address       string     `json:"-"`
+	DistrictID    int        `json:"-"`
+	Phone         string     `json:"-"`
+	ProfileStatus string     `json:"-"`
+	CreatedAt     time.Time  `json:"-"`
+	Version       int        `json:"-"`
+}
+
+// TeacherView is how much of a teacher profile a user may see
+type TeacherView int
+
+const (
+	TeacherViewDirectory TeacherView = iota // other users: name and work contact details
+	TeacherViewOwner                        // the teacher themselves
+	TeacherViewStaff                        // staff managing teachers
+	TeacherViewFull                         // staff cleared to see sensitive fields
+)
+
+// Project reduces the teacher to what the view may see. The directory
+// view keeps only the listed fields, so fields added to Teacher later stay
+// hidden from it until added here. The owner and staff views mask the
+// SSN, and the staff view also hides the date of birth and address.
+func (t *Teacher) Project(view TeacherView) {
+	switch view {
+	case TeacherViewFull:
+	case TeacherViewOwner:
+		t.SSN = MaskSSN(t.SSN)
+	case TeacherViewStaff:
+		t.SSN = MaskSSN(t.SSN)
+		t.DOB = nil
+		t.Address = ""
+	default:
+		*t = Teacher{
+			ID:            t.ID,
+			FirstName:     t.FirstName,
+			LastName:      t.LastName,
+			Email:         t.Email,
+			DistrictID:    t.DistrictID,
+			ProfileStatus: t.ProfileStatus,
+			CreatedAt:     t.CreatedAt,
+		}
+	}
+}
+
+// MaskSSN hides all but the last 3 letters and digits of an SSN, keeping
+// separators, so "000-123-456" becomes "***-***-456". SSNs of 3 characters
+// or fewer are hidden entirely.
+func MaskSSN(ssn string) string {
+	runes := []rune(ssn)
+	visible := 3
+	if len(runes) <= visible {
+		visible = 0
+	}
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if visible > 0 {
+			visible--
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// ValidateTeacher checks the fields of a teacher profile. It is shared by
+// creation and updates.
+func ValidateTeacher(v *validator.Validator, t *Teacher) {
+	v.Check(t.FirstName != "", "first_name", "must be provided")
+	v.Check(len(t.FirstName) <= 100, "first_name", "must not be more than 100 characters long")
+	v.Check(t.LastName != "", "last_name", "must be provided")
+	v.Check(len(t.LastName) <= 100, "last_name", "must not be more than 100 characters long")
+	v.Check(t.Email != "", "email", "must be provided")
+	v.Check(len(t.Email) <= 100, "email", "must not be more than 100 characters long")
+	v.Check(len(t.SSN) <= 15, "ssn", "must not be more than 15 characters long")
+	v.Check(len(t.ProfileStatus) <= 30, "profile_status", "must not be more than 30 characters long")
+}
+
+// Fields sealed by the keyring. The field name and teacher id are bound to
+// the ciphertext, so a value cannot be copied to another column or to
+// another teacher.
+const (
+	teacherFieldSSN     = "teachers.ssn"
+	teacherFieldDOB     = "teachers.dob"
+	teacherFieldAddress = "teachers.address"
+)
+
+var errNoKeyring = errors.New("no field encryption keys configured")
+
+// sealedField names a record's field as associated data for the keyring
+func sealedField(field string, id int) string {
+	return fmt.Sprintf("%s|%d", field, id)
 }
 
 type TeacherModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Scope   DistrictScope
+	Actor   Actor               // recorded in the audit trail for changes
+	Keyring *encryption.Keyring // seals SSNs, dates of birth and addresses
 }
 
-func (m *TeacherModel) Insert(t *Teacher) error {
-	query := `INSERT INTO teachers (user_id, first_name, last_name, gender, dob, ssn, marital_status, email, address, district_id, phone, profile_status) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING teacher_id, created_at`
+// teacherColumns selects a teacher in the order scanTeacher expects. The
+// plaintext ssn, dob and address columns are only set on rows written
+// before encryption that have not been resealed yet.
+const teacherColumns = `t.teacher_id, t.user_id, t.first_name, t.last_name, COALESCE(t.gender, ''), COALESCE(t.marital_status, ''),
+	t.email, t.district_id, COALESCE(t.phone, ''), COALESCE(t.profile_status, ''), t.created_at, t.version,
+	COALESCE(t.ssn_encrypted, ''), COALESCE(t.ssn, ''), COALESCE(t.dob_encrypted, ''), t.dob,
+	COALESCE(t.address_encrypted, ''), COALESCE(t.address, '')`
+
+// scanTeacher reads one teacher row selected with teacherColumns and
+// decrypts its sealed fields
+func (m *TeacherModel) scanTeacher(row rowScanner, prefix ...any) (*Teacher, error) {
+	var t Teacher
+	var userID sql.NullInt64
+	var district sql.NullInt64
+	var ssn, dob, address string
+	var legacyDOB sql.NullTime
+
+	dest := append(prefix,
+		&t.ID,
+		&userID,
+		&t.FirstName,
+		&t.LastName,
+		&t.Gender,
+		&t.MaritalStatus,
+		&t.Email,
+		&district,
+		&t.Phone,
+		&t.ProfileStatus,
+		&t.CreatedAt,
+		&t.Version,
+		&ssn,
+		&t.SSN,
+		&dob,
+		&legacyDOB,
+		&address,
+		&t.Address,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
 
-	var dob interface{}
-	if t.DOB != nil {
-		dob = *t.DOB
-	} else {
-		dob = nil
+	if userID.Valid {
+		t.UserID = int(userID.Int64)
+	}
+	if district.Valid {
+		t.DistrictID = int(district.Int64)
+	}
+	if legacyDOB.Valid {
+		t.DOB = &legacyDOB.Time
 	}
 
-	var userID interface{}
-	if t.UserID > 0 {
-		userID = t.UserID
-	} else {
-		userID = nil
+	if err := m.open(&t, ssn, dob, address); err != nil {
+		return nil, fmt.Errorf("teacher %d: %w", t.ID, err)
 	}
+	return &t, nil
+}
+
+// sealedTeacher holds the encrypted columns of a teacher
+type sealedTeacher struct {
+	ssn      string
+	ssnIndex string
+	dob      string
+	address  string
+}
 
-	var district interface{}
-	if t.DistrictID > 0 {
-		district = t.DistrictID
-	} else {
-		district = nil
+// seal encrypts the teacher's sensitive fields with the primary key. t.ID
+// must already be set.
+func (m *TeacherModel) seal(t *Teacher) (sealedTeacher, error) {
+	if m.Keyring == nil {
+		return sealedTeacher{}, errNoKeyring
 	}
 
-	// Handle SSN - if empty string, convert to NULL
-	var ssn interface{}
-	if t.SSN != "" {
-		ssn = t.SSN
-	} else {
-		ssn = nil
+	var sealed sealedTeacher
+	var err error
+
+	sealed.ssn, err = m.Keyring.Encrypt(sealedField(teacherFieldSSN, t.ID), t.SSN)
+	if err != nil {
+		return sealedTeacher{}, err
 	}
+	sealed.ssnIndex = m.Keyring.BlindIndex(teacherFieldSSN, t.SSN)
 
-	// Handle optional string fields - if empty, convert to NULL
-	var gender interface{}
-	if t.Gender != "" {
-		gender = t.Gender
-	} else {
-		gender = nil
+	var dob string
+	if t.DOB != nil {
+		dob = t.DOB.Format(time.DateOnly)
+	}
+	sealed.dob, err = m.Keyring.Encrypt(sealedField(teacherFieldDOB, t.ID), dob)
+	if err != nil {
+		return sealedTeacher{}, err
 	}
 
-	var maritalStatus interface{}
-	if t.MaritalStatus != "" {
-		maritalStatus = t.MaritalStatus
-	} else {
-		maritalStatus = nil
+	sealed.address, err = m.Keyring.Encrypt(sealedField(teacherFieldAddress, t.ID), t.Address)
+	if err != nil {
+		return sealedTeacher{}, err
 	}
+	return sealed, nil
+}
 
-	var address interface{}
-	if t.Address != "" {
-		address = t.Address
-	} else {
-		address = nil
+// open decrypts sealed columns into t. Empty columns leave t unchanged.
+func (m *TeacherModel) open(t *Teacher, ssn, dob, address string) error {
+	if ssn == "" && dob == "" && address == "" {
+		return nil
+	}
+	if m.Keyring == nil {
+		return errNoKeyring
 	}
 
-	var phone interface{}
-	if t.Phone != "" {
-		phone = t.Phone
-	} else {
-		phone = nil
+	var err error
+	if ssn != "" {
+		if t.SSN, err = m.Keyring.Decrypt(sealedField(teacherFieldSSN, t.ID), ssn); err != nil {
+			return err
+		}
+	}
+	if address != "" {
+		if t.Address, err = m.Keyring.Decrypt(sealedField(teacherFieldAddress, t.ID), address); err != nil {
+			return err
+		}
+	}
+	if dob != "" {
+		plaintext, err := m.Keyring.Decrypt(sealedField(teacherFieldDOB, t.ID), dob)
+		if err != nil {
+			return err
+		}
+		parsed, err := time.Parse(time.DateOnly, plaintext)
+		if err != nil {
+			return err
+		}
+		t.DOB = &parsed
 	}
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// teacherWriteError maps unique constraint violations on teachers
+func teacherWriteError(err error) error {
+	switch {
+	case isUniqueViolation(err, "teachers_email_key"):
+		return ErrDuplicateEmail
+	case isUniqueViolation(err, "teachers_ssn_index_key"):
+		return ErrDuplicateSSN
+	default:
+		return err
+	}
+}
+
+// Insert adds a teacher. The sensitive fields are sealed once the teacher
+// has an id to bind them to, in the same transaction as the insert.
+func (m *TeacherModel) Insert(t *Teacher) error {
+	if m.Keyring == nil {
+		return errNoKeyring
+	}
+
+	query := `
+		INSERT INTO teachers (user_id, first_name, last_name, gender, marital_status, email, district_id, phone, profile_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING teacher_id, created_at, version`
+
+	args := []any{
+		nullInt(t.UserID),
+		t.FirstName,
+		t.LastName,
+		nullString(t.Gender),
+		nullString(t.MaritalStatus),
+		t.Email,
+		nullInt(t.DistrictID),
+		nullString(t.Phone),
+		t.ProfileStatus,
+	}
+
+	seal := `
+		UPDATE teachers
+		SET ssn_encrypted = $1, ssn_index = $2, dob_encrypted = $3, address_encrypted = $4
+		WHERE teacher_id = $5`
 
-	return m.DB.QueryRowContext(ctx, query, userID, t.FirstName, t.LastName, gender, dob, ssn, maritalStatus, t.Email, address, district, phone, t.ProfileStatus).Scan(&t.ID, &t.CreatedAt)
+	return m.Actor.audit(m.DB, auditTeacher, AuditActionCreate, 0, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&t.ID, &t.CreatedAt, &t.Version)
+		if err != nil {
+			return 0, teacherWriteError(err)
+		}
+
+		sealed, err := m.seal(t)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx, seal, nullString(sealed.ssn), nullString(sealed.ssnIndex), nullString(sealed.dob), nullString(sealed.address), t.ID)
+		if err != nil {
+			return 0, teacherWriteError(err)
+		}
+		return int64(t.ID), nil
+	})
 }
 
 func (m *TeacherModel) Get(id int) (*Teacher, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `SELECT teacher_id, user_id, first_name, last_name, gender, dob, ssn, marital_status, email, address, district_id, phone, profile_status, created_at FROM teachers WHERE teacher_id = $1`
-
-	var t Teacher
-	var dob sql.NullTime
-	var userID sql.NullInt64
-	var district sql.NullInt64
+	query := `SELECT ` + teacherColumns + ` FROM teachers t WHERE t.teacher_id = $1 AND t.deleted_at IS NULL`
+	args := []any{id}
+	query += m.Scope.districtCondition("t.district_id", &args)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&t.ID, &userID, &t.FirstName, &t.LastName, &t.Gender, &dob, &t.SSN, &t.MaritalStatus, &t.Email, &t.Address, &district, &t.Phone, &t.ProfileStatus, &t.CreatedAt)
+	t, err := m.scanTeacher(m.DB.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -119,30 +341,18 @@ func (m *TeacherModel) Get(id int) (*Teacher, error) {
 			return nil, err
 		}
 	}
-	if dob.Valid {
-		t.DOB = &dob.Time
-	}
-	if userID.Valid {
-		t.UserID = int(userID.Int64)
-	}
-	if district.Valid {
-		t.DistrictID = int(district.Int64)
-	}
-	return &t, nil
+	return t, nil
 }
 
 func (m *TeacherModel) GetByUserID(userID int) (*Teacher, error) {
-	query := `SELECT teacher_id, user_id, first_name, last_name, gender, dob, ssn, marital_status, email, address, district_id, phone, profile_status, created_at FROM teachers WHERE user_id = $1`
-
-	var t Teacher
-	var dob sql.NullTime
-	var u sql.NullInt64
-	var district sql.NullInt64
+	query := `SELECT ` + teacherColumns + ` FROM teachers t WHERE t.user_id = $1 AND t.deleted_at IS NULL`
+	args := []any{userID}
+	query += m.Scope.districtCondition("t.district_id", &args)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&t.ID, &u, &t.FirstName, &t.LastName, &t.Gender, &dob, &t.SSN, &t.MaritalStatus, &t.Email, &t.Address, &district, &t.Phone, &t.ProfileStatus, &t.CreatedAt)
+	t, err := m.scanTeacher(m.DB.QueryRowContext(ctx, query, args...))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -151,102 +361,312 @@ func (m *TeacherModel) GetByUserID(userID int) (*Teacher, error) {
 			return nil, err
 		}
 	}
-	if dob.Valid {
-		t.DOB = &dob.Time
-	}
-	if u.Valid {
-		t.UserID = int(u.Int64)
+	return t, nil
+}
+
+// Update saves changes to a teacher profile. The version must match the
+// stored version or ErrEditConflict is returned. Sensitive fields are
+// resealed with the primary key and any plaintext left from before
+// encryption is cleared.
+func (m *TeacherModel) Update(t *Teacher) error {
+	query := `
+		UPDATE teachers
+		SET first_name = $1, last_name = $2, gender = $3, marital_status = $4, email = $5,
+		    district_id = $6, phone = $7, profile_status = $8,
+		    ssn_encrypted = $9, ssn_index = $10, dob_encrypted = $11, address_encrypted = $12,
+		    ssn = NULL, dob = NULL, address = NULL, version = version + 1
+		WHERE teacher_id = $13 AND version = $14 AND deleted_at IS NULL`
+
+	sealed, err := m.seal(t)
+	if err != nil {
+		return err
 	}
-	if district.Valid {
-		t.DistrictID = int(district.Int64)
+
+	args := []any{
+		t.FirstName,
+		t.LastName,
+		nullString(t.Gender),
+		nullString(t.MaritalStatus),
+		t.Email,
+		nullInt(t.DistrictID),
+		nullString(t.Phone),
+		t.ProfileStatus,
+		nullString(sealed.ssn),
+		nullString(sealed.ssnIndex),
+		nullString(sealed.dob),
+		nullString(sealed.address),
+		t.ID,
+		t.Version,
 	}
-	return &t, nil
+	query += m.Scope.districtCondition("district_id", &args)
+	query += " RETURNING version"
+
+	return m.Actor.audit(m.DB, auditTeacher, AuditActionUpdate, int64(t.ID), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&t.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return 0, ErrEditConflict
+			default:
+				return 0, teacherWriteError(err)
+			}
+		}
+		return int64(t.ID), nil
+	})
 }
 
+// Delete soft deletes a teacher. Their education, qualifications,
+// documents, applications and licenses are kept, and everything comes
+// back with Restore until the teacher is purged.
 func (m *TeacherModel) Delete(id int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	query := `DELETE FROM teachers WHERE teacher_id = $1`
+	query := `UPDATE teachers SET deleted_at = NOW(), deleted_by = $2 WHERE teacher_id = $1 AND deleted_at IS NULL`
+	args := []any{id, nullInt(int(m.Actor.UserID))}
+	query += m.Scope.districtCondition("district_id", &args)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return m.Actor.audit(m.DB, auditTeacher, AuditActionDelete, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
+}
 
-	res, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
+// GetDeleted returns a page of soft deleted teachers, most recently
+// deleted first by default
+func (m *TeacherModel) GetDeleted(filters Filters) ([]*DeletedRecord, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), teacher_id AS entity_id, first_name || ' ' || last_name AS label, deleted_at, deleted_by
+		FROM teachers
+		WHERE deleted_at IS NOT NULL`
+	args := []any{}
+	query += m.Scope.districtCondition("district_id", &args)
+
+	return listDeleted(m.DB, AuditEntityTeacher, query, args, filters)
+}
+
+// Restore brings back a soft deleted teacher
+func (m *TeacherModel) Restore(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
 	}
-	n, err := res.RowsAffected()
-	if err != nil {
-		return err
+	query := `UPDATE teachers SET deleted_at = NULL, deleted_by = NULL WHERE teacher_id = $1 AND deleted_at IS NOT NULL`
+	args := []any{id}
+	query += m.Scope.districtCondition("district_id", &args)
+
+	return m.Actor.audit(m.DB, auditTeacher, AuditActionRestore, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
+}
+
+// Purge removes a soft deleted teacher from the database for good, and
+// with them their education, qualifications, documents, applications and
+// licenses. It returns the storage keys of the teacher's uploaded files
+// for the caller to remove.
+func (m *TeacherModel) Purge(id int) ([]string, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
 	}
-	if n == 0 {
-		return ErrRecordNotFound
+	query := `DELETE FROM teachers WHERE teacher_id = $1 AND deleted_at IS NOT NULL`
+	args := []any{id}
+	query += m.Scope.districtCondition("district_id", &args)
+
+	var files []string
+	err := m.Actor.audit(m.DB, auditTeacher, AuditActionPurge, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		var err error
+		files, err = storedFiles(ctx, tx, `SELECT file_path FROM documents WHERE teacher_id = $1 AND sha256 IS NOT NULL`, id)
+		if err != nil {
+			return 0, err
+		}
+		return int64(id), changeOne(ctx, tx, query, args...)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return files, nil
+}
+
+// TeacherCriteria narrows a teacher listing. Zero values match everything.
+type TeacherCriteria struct {
+	DistrictID    int
+	ProfileStatus string
+	Gender        string
+	InstitutionID int    // attended, according to their education records
+	LicenseStatus string // effective status of any license the teacher holds
+	Search        string // matched against first name, last name and email
+	SSN           string // matched exactly through the blind index
+}
+
+// teacherSortColumns maps the sort values accepted for teachers to columns.
+var teacherSortColumns = sortColumns{
+	"teacher_id":     "t.teacher_id",
+	"first_name":     "t.first_name",
+	"last_name":      "t.last_name",
+	"email":          "t.email",
+	"district_id":    "t.district_id",
+	"profile_status": "t.profile_status",
+	"created_at":     "t.created_at",
 }
 
-// GetAll retrieves all teachers from the database
-func (m *TeacherModel) GetAll() ([]*Teacher, error) {
+// TeacherSortSafelist lists the sort values accepted for teachers
+var TeacherSortSafelist = teacherSortColumns.safelist()
+
+// GetAll retrieves a page of teachers matching the criteria
+func (m *TeacherModel) GetAll(criteria TeacherCriteria, filters Filters) ([]*Teacher, Metadata, error) {
 	query := `
-		SELECT teacher_id, user_id, first_name, last_name, gender, dob, ssn, 
-		       marital_status, email, address, district_id, phone, profile_status, created_at 
-		FROM teachers 
-		ORDER BY created_at DESC`
+		SELECT count(*) OVER(), ` + teacherColumns + `
+		FROM teachers t
+		WHERE t.deleted_at IS NULL`
+
+	args := []any{}
+
+	if criteria.DistrictID > 0 {
+		args = append(args, criteria.DistrictID)
+		query += fmt.Sprintf(" AND t.district_id = $%d", len(args))
+	}
+	if criteria.ProfileStatus != "" {
+		args = append(args, criteria.ProfileStatus)
+		query += fmt.Sprintf(" AND t.profile_status = $%d", len(args))
+	}
+	if criteria.Gender != "" {
+		args = append(args, criteria.Gender)
+		query += fmt.Sprintf(" AND LOWER(t.gender) = LOWER($%d)", len(args))
+	}
+	if criteria.InstitutionID > 0 {
+		args = append(args, criteria.InstitutionID)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM education e WHERE e.teacher_id = t.teacher_id AND e.institution_id = $%d)", len(args))
+	}
+	if criteria.LicenseStatus != "" {
+		args = append(args, criteria.LicenseStatus)
+		query += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM licenses l WHERE l.teacher_id = t.teacher_id AND "+
+			"CASE WHEN l.status = 'active' AND l.expiry_date < CURRENT_DATE THEN 'expired' ELSE l.status END = $%d)", len(args))
+	}
+	if criteria.Search != "" {
+		args = append(args, "%"+escapeLike(criteria.Search)+"%")
+		query += fmt.Sprintf(" AND (t.first_name ILIKE $%[1]d OR t.last_name ILIKE $%[1]d OR t.email ILIKE $%[1]d)", len(args))
+	}
+	if criteria.SSN != "" {
+		if m.Keyring == nil {
+			return nil, Metadata{}, errNoKeyring
+		}
+		args = append(args, m.Keyring.BlindIndex(teacherFieldSSN, criteria.SSN))
+		query += fmt.Sprintf(" AND t.ssn_index = $%d", len(args))
+	}
+
+	sortColumn, err := filters.sortColumn(teacherSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query += m.Scope.districtCondition("t.district_id", &args)
+	query += fmt.Sprintf(" ORDER BY %s %s, t.teacher_id ASC", sortColumn, filters.sortDirection())
+
+	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	teachers := []*Teacher{}
 
 	for rows.Next() {
-		var t Teacher
-		var dob sql.NullTime
-		var userID sql.NullInt64
-		var district sql.NullInt64
-
-		err := rows.Scan(
-			&t.ID,
-			&userID,
-			&t.FirstName,
-			&t.LastName,
-			&t.Gender,
-			&dob,
-			&t.SSN,
-			&t.MaritalStatus,
-			&t.Email,
-			&t.Address,
-			&district,
-			&t.Phone,
-			&t.ProfileStatus,
-			&t.CreatedAt,
-		)
+		t, err := m.scanTeacher(rows, &totalRecords)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
+		teachers = append(teachers, t)
+	}
 
-		if dob.Valid {
-			t.DOB = &dob.Time
-		}
-		if userID.Valid {
-			t.UserID = int(userID.Int64)
-		}
-		if district.Valid {
-			t.DistrictID = int(district.Int64)
-		}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return teachers, metadata, nil
+}
+
+// CountPlaintext returns how many teachers, deleted ones included, still
+// hold an SSN, date of birth or address in plaintext from before
+// encryption
+func (m *TeacherModel) CountPlaintext() (int, error) {
+	query := `
+		SELECT count(*)
+		FROM teachers
+		WHERE ssn IS NOT NULL OR dob IS NOT NULL OR address IS NOT NULL`
 
-		teachers = append(teachers, &t)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
+
+// Reseal encrypts teachers still holding plaintext from before encryption,
+// or sealed with a key other than the primary one, with the primary key.
+// It works through at most limit teachers and returns how many it
+// resealed; call it until it returns 0. Resealing is maintenance rather
+// than a change to the record, so it is not audited and leaves the
+// version alone.
+func (m *TeacherModel) Reseal(limit int) (int, error) {
+	if m.Keyring == nil {
+		return 0, errNoKeyring
 	}
 
+	query := `
+		SELECT ` + teacherColumns + `
+		FROM teachers t
+		WHERE t.ssn IS NOT NULL OR t.dob IS NOT NULL OR t.address IS NOT NULL
+		   OR split_part(t.ssn_encrypted, ':', 1) <> $1
+		   OR split_part(t.dob_encrypted, ':', 1) <> $1
+		   OR split_part(t.address_encrypted, ':', 1) <> $1
+		ORDER BY t.teacher_id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.Keyring.Primary(), limit)
+	if err != nil {
+		return 0, err
+	}
+	teachers := []*Teacher{}
+	for rows.Next() {
+		t, err := m.scanTeacher(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		teachers = append(teachers, t)
+	}
+	rows.Close()
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return teachers, nil
+	update := `
+		UPDATE teachers
+		SET ssn_encrypted = $1, ssn_index = $2, dob_encrypted = $3, address_encrypted = $4,
+		    ssn = NULL, dob = NULL, address = NULL
+		WHERE teacher_id = $5 AND version = $6`
+
+	// A teacher updated in the meantime was resealed by the update, so the
+	// version check skips it rather than writing back stale values
+	for _, t := range teachers {
+		sealed, err := m.seal(t)
+		if err != nil {
+			return 0, err
+		}
+		_, err = m.DB.ExecContext(ctx, update, nullString(sealed.ssn), nullString(sealed.ssnIndex), nullString(sealed.dob), nullString(sealed.address), t.ID, t.Version)
+		if err != nil {
+			return 0, fmt.Errorf("teacher %d: %w", t.ID, teacherWriteError(err))
+		}
+	}
+	return len(teachers), nil
 }
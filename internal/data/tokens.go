@@ -6,7 +6,9 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
 )
@@ -14,6 +16,9 @@ import (
 // Purpose of the token
 const ScopeActivation = "activation"
 const ScopeAuthentication = "authentication"
+const ScopePasswordReset = "password-reset"
+const ScopeTwoFactor = "two-factor"
+const ScopeTwoFactorEnrolment = "two-factor-enrolment"
 
 // Define our token
 type Token struct {
@@ -22,6 +27,8 @@ type Token struct {
     UserID    int64       `json:"-"`
     Expiry    time.Time   `json:"expiry"`
     Scope     string      `json:"-"`
+    IPAddress string      `json:"-"`
+    UserAgent string      `json:"-"`
 }
 
 
@@ -72,13 +79,45 @@ func (t TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession creates an authentication token and records where it was
+// issued so the user can recognise the session later
+func (t TokenModel) NewSession(userID int64, ttl time.Duration, ipAddress, userAgent string) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.IPAddress = ipAddress
+	token.UserAgent = truncateUserAgent(userAgent)
+
+	err = t.Insert(token)
+	return token, err
+}
+
+// maxUserAgentLength is the most bytes of a user agent kept for a session
+const maxUserAgentLength = 512
+
+// truncateUserAgent drops invalid UTF-8, which the database would reject,
+// and shortens the user agent to maxUserAgentLength bytes without splitting
+// a character
+func truncateUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	if len(userAgent) <= maxUserAgentLength {
+		return userAgent
+	}
+	cut := maxUserAgentLength
+	for cut > 0 && !utf8.RuneStart(userAgent[cut]) {
+		cut--
+	}
+	return userAgent[:cut]
+}
+
 // Do the actual insert in to the database table
 func (t TokenModel) Insert(token *Token) error {
     query := `
-              INSERT INTO auth_tokens (token, user_id, expires_at, scope) 
-              VALUES ($1, $2, $3, $4)
+              INSERT INTO auth_tokens (token, user_id, expires_at, scope, ip_address, user_agent) 
+              VALUES ($1, $2, $3, $4, $5, $6)
             `
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, nullString(token.IPAddress), nullString(token.UserAgent)}
 	
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -99,3 +138,127 @@ func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
     _, err := t.DB.ExecContext(ctx, query, scope, userID)
     return err
 }
+
+// Session is an authentication token as shown to its owner. The token
+// itself is never returned.
+type Session struct {
+	ID         int        `json:"session_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	IPAddress  string     `json:"ip_address,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// Touch records that an authentication token was just used. To avoid a
+// write on every request the time is only updated once a minute.
+func (t TokenModel) Touch(tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		UPDATE auth_tokens
+		SET last_used_at = NOW()
+		WHERE token = $1 AND scope = $2
+		AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, tokenHash[:], ScopeAuthentication)
+	return err
+}
+
+// GetSessions lists a user's unexpired authentication tokens, most recently
+// used first. The session for currentPlaintext is flagged as current.
+func (t TokenModel) GetSessions(userID int64, currentPlaintext string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+		SELECT token_id, created_at, expires_at, last_used_at, COALESCE(ip_address, ''), COALESCE(user_agent, ''), token = $3
+		FROM auth_tokens
+		WHERE user_id = $1 AND scope = $2 AND expires_at > NOW()
+		ORDER BY COALESCE(last_used_at, created_at) DESC, token_id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, userID, ScopeAuthentication, currentHash[:])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		var lastUsedAt sql.NullTime
+		err := rows.Scan(&s.ID, &s.CreatedAt, &s.Expiry, &lastUsedAt, &s.IPAddress, &s.UserAgent, &s.Current)
+		if err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			s.LastUsedAt = &lastUsedAt.Time
+		}
+		sessions = append(sessions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteByPlaintext removes a single token, e.g. when the user logs out
+func (t TokenModel) DeleteByPlaintext(scope string, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		DELETE FROM auth_tokens
+		WHERE token = $1 AND scope = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, tokenHash[:], scope)
+	return err
+}
+
+// DeleteOtherSessions revokes every session of the user except the one
+// for currentPlaintext, e.g. after the user changes their password
+func (t TokenModel) DeleteOtherSessions(userID int64, currentPlaintext string) error {
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+		DELETE FROM auth_tokens
+		WHERE user_id = $1 AND scope = $2 AND token <> $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID, ScopeAuthentication, currentHash[:])
+	return err
+}
+
+// DeleteSession revokes one of a user's sessions. ErrRecordNotFound is
+// returned if the session does not belong to the user.
+func (t TokenModel) DeleteSession(userID int64, sessionID int) error {
+	query := `
+		DELETE FROM auth_tokens
+		WHERE token_id = $1 AND user_id = $2 AND scope = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := t.DB.ExecContext(ctx, query, sessionID, userID, ScopeAuthentication)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
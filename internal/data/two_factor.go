@@ -0,0 +1,399 @@
+// Filename: internal/data/two_factor.go
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amilcar-vasquez/impartBelize/internal/encryption"
+	"github.com/amilcar-vasquez/impartBelize/internal/validator"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued at a time
+const RecoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorCodeUsed = errors.New("two-factor code has already been used")
+)
+
+// TwoFactor holds a user's TOTP enrolment. The secret is never returned to
+// clients once enrolment has started.
+type TwoFactor struct {
+	UserID       int64      `json:"user_id"`
+	Secret       string     `json:"-"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Enabled reports whether the user has confirmed their authenticator
+func (tf *TwoFactor) Enabled() bool {
+	return tf != nil && tf.EnabledAt != nil
+}
+
+// ValidateTwoFactorCode checks a TOTP or recovery code supplied by a client
+func ValidateTwoFactorCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 32, "code", "must not be more than 32 characters long")
+}
+
+// twoFactorFieldSecret names the sealed TOTP secret. The user id is bound
+// to the ciphertext, so a secret cannot be copied to another user.
+const twoFactorFieldSecret = "user_two_factor.secret"
+
+// TwoFactorModel wraps a database connection pool
+type TwoFactorModel struct {
+	DB      *sql.DB
+	Keyring *encryption.Keyring // seals TOTP secrets
+}
+
+// twoFactorColumns selects an enrolment in the order scanTwoFactor
+// expects. The plaintext secret column is only set on enrolments started
+// before encryption that have not been resealed yet.
+const twoFactorColumns = `user_id, COALESCE(secret_encrypted, ''), COALESCE(secret, ''), enabled_at, last_used_step, created_at`
+
+// scanTwoFactor reads one row selected with twoFactorColumns and decrypts
+// its secret
+func (m *TwoFactorModel) scanTwoFactor(row rowScanner) (*TwoFactor, error) {
+	var tf TwoFactor
+	var sealed string
+	var enabledAt sql.NullTime
+
+	err := row.Scan(&tf.UserID, &sealed, &tf.Secret, &enabledAt, &tf.LastUsedStep, &tf.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		tf.EnabledAt = &enabledAt.Time
+	}
+
+	if sealed != "" {
+		if m.Keyring == nil {
+			return nil, errNoKeyring
+		}
+		tf.Secret, err = m.Keyring.Decrypt(sealedField(twoFactorFieldSecret, int(tf.UserID)), sealed)
+		if err != nil {
+			return nil, fmt.Errorf("two-factor secret of user %d: %w", tf.UserID, err)
+		}
+	}
+	return &tf, nil
+}
+
+// sealSecret encrypts a user's TOTP secret with the primary key
+func (m *TwoFactorModel) sealSecret(userID int64, secret string) (string, error) {
+	if m.Keyring == nil {
+		return "", errNoKeyring
+	}
+	return m.Keyring.Encrypt(sealedField(twoFactorFieldSecret, int(userID)), secret)
+}
+
+// Get returns a user's enrolment, or ErrRecordNotFound if they have never
+// started one
+func (m *TwoFactorModel) Get(userID int64) (*TwoFactor, error) {
+	query := `
+		SELECT ` + twoFactorColumns + `
+		FROM user_two_factor
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tf, err := m.scanTwoFactor(m.DB.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return tf, nil
+}
+
+// SetSecret starts (or restarts) enrolment with a new secret, sealed with
+// the keyring. It returns ErrTwoFactorEnabled if the user has already
+// finished enrolling.
+func (m *TwoFactorModel) SetSecret(userID int64, secret string) error {
+	sealed, err := m.sealSecret(userID, secret)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_two_factor (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, secret = NULL, last_used_step = 0, created_at = NOW()
+		WHERE user_two_factor.enabled_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, sealed)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// UseStep records that the code for a time step was accepted. A step at or
+// before the last one used returns ErrTwoFactorCodeUsed.
+func (m *TwoFactorModel) UseStep(userID int64, step int64) error {
+	query := `
+		UPDATE user_two_factor
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorCodeUsed
+	}
+	return nil
+}
+
+// Enable completes enrolment and stores a fresh set of recovery codes. Both
+// writes happen in one transaction.
+func (m *TwoFactorModel) Enable(userID int64, step int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE user_two_factor
+		SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL AND last_used_step < $2`
+
+	result, err := tx.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrTwoFactorCodeUsed
+	}
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func (m *TwoFactorModel) ReplaceRecoveryCodes(userID int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, recoveryCodes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		hash := hashRecoveryCode(code)
+		_, err = tx.ExecContext(ctx, `INSERT INTO two_factor_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash[:])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a recovery code as used. It reports false if the
+// code does not exist or was used before.
+func (m *TwoFactorModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+	hash := hashRecoveryCode(code)
+
+	query := `
+		UPDATE two_factor_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// Disable removes a user's enrolment and recovery codes
+func (m *TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_two_factor WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountPlaintext returns how many enrolments still hold their TOTP secret
+// in plaintext from before encryption
+func (m *TwoFactorModel) CountPlaintext() (int, error) {
+	query := `SELECT count(*) FROM user_two_factor WHERE secret IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query).Scan(&count)
+	return count, err
+}
+
+// Reseal encrypts TOTP secrets still stored in plaintext from before
+// encryption, or sealed with a key other than the primary one, with the
+// primary key. It works through at most limit enrolments and returns how
+// many it resealed; call it until it returns 0.
+func (m *TwoFactorModel) Reseal(limit int) (int, error) {
+	if m.Keyring == nil {
+		return 0, errNoKeyring
+	}
+
+	query := `
+		SELECT user_id, COALESCE(secret_encrypted, ''), COALESCE(secret, '')
+		FROM user_two_factor
+		WHERE secret IS NOT NULL OR split_part(secret_encrypted, ':', 1) <> $1
+		ORDER BY user_id
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, m.Keyring.Primary(), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type enrolment struct {
+		userID int64
+		secret string
+		sealed string
+	}
+	enrolments := []enrolment{}
+	for rows.Next() {
+		var e enrolment
+		if err := rows.Scan(&e.userID, &e.sealed, &e.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if e.sealed != "" {
+			e.secret, err = m.Keyring.Decrypt(sealedField(twoFactorFieldSecret, int(e.userID)), e.sealed)
+			if err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("two-factor secret of user %d: %w", e.userID, err)
+			}
+		}
+		enrolments = append(enrolments, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	update := `
+		UPDATE user_two_factor
+		SET secret_encrypted = $1, secret = NULL
+		WHERE user_id = $2 AND COALESCE(secret_encrypted, '') = $3`
+
+	// An enrolment restarted in the meantime already has a new sealed
+	// secret, so the check on the old value skips it
+	for _, e := range enrolments {
+		sealed, err := m.sealSecret(e.userID, e.secret)
+		if err != nil {
+			return 0, err
+		}
+		_, err = m.DB.ExecContext(ctx, update, sealed, e.userID, e.sealed)
+		if err != nil {
+			return 0, fmt.Errorf("two-factor secret of user %d: %w", e.userID, err)
+		}
+	}
+	return len(enrolments), nil
+}
+
+// NewRecoveryCodes generates a set of recovery codes in the form
+// "abcde-fghij". Only their hashes are stored.
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed
+// the way they were printed or not
+func hashRecoveryCode(code string) [32]byte {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return sha256.Sum256([]byte(normalized))
+}
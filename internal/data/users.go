@@ -7,7 +7,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/amilcar-vasquez/impartBelize/internal/validator"
@@ -101,7 +100,8 @@ var ErrDuplicateEmail = errors.New("duplicate email")
 
 // setup the user model struct
 type UserModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Actor Actor // recorded in the audit trail for changes
 }
 
 // Insert a new user record in the database
@@ -148,18 +148,17 @@ func (u *UserModel) Insert(user *User) error {
 		updatedBy,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		// detect duplicate email error
-		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") && strings.Contains(err.Error(), "users_email_key") {
-			return ErrDuplicateEmail
+	return u.Actor.audit(u.DB, auditUser, AuditActionCreate, 0, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			// detect duplicate email error
+			if isUniqueViolation(err, "users_email_key") {
+				return 0, ErrDuplicateEmail
+			}
+			return 0, err
 		}
-		return err
-	}
-	return nil
+		return user.ID, nil
+	})
 }
 
 // Get a user from the database based on their email provided
@@ -167,7 +166,7 @@ func (u *UserModel) GetByEmail(email string) (*User, error) {
 	query := `
 		SELECT user_id, username, email, password_hash, role_id, is_active, is_activated, last_login, created_at, created_by, updated_at, updated_by
 		FROM users
-		WHERE email = $1
+		WHERE email = $1 AND deleted_at IS NULL
 	`
 
 	var user User
@@ -221,7 +220,7 @@ func (m *UserModel) Update(user *User) error {
 		UPDATE users
 		SET username = $1, email = $2, password_hash = $3, role_id = $4,
 			is_active = $5, is_activated = $6, last_login = $7, updated_at = NOW(), updated_by = $8
-		WHERE user_id = $9
+		WHERE user_id = $9 AND deleted_at IS NULL
 		RETURNING updated_at
 	`
 
@@ -251,21 +250,19 @@ func (m *UserModel) Update(user *User) error {
 		user.ID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.UpdatedAt)
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key value violates unique constraint") && strings.Contains(err.Error(), "users_email_key") {
-			return ErrDuplicateEmail
-		}
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrEditConflict
+	return m.Actor.audit(m.DB, auditUser, AuditActionUpdate, user.ID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&user.UpdatedAt)
+		if err != nil {
+			if isUniqueViolation(err, "users_email_key") {
+				return 0, ErrDuplicateEmail
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, ErrEditConflict
+			}
+			return 0, err
 		}
-		return err
-	}
-
-	return nil
+		return user.ID, nil
+	})
 }
 
 // UpdateActivation updates only the is_active field for a user
@@ -278,21 +275,52 @@ func (m *UserModel) UpdateActivation(userID int64, isActive bool, isActivated bo
 		RETURNING updated_at
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return m.Actor.audit(m.DB, auditUser, AuditActionActivate, userID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		var updatedAt time.Time
+		err := tx.QueryRowContext(ctx, query, isActive, isActivated, userID).Scan(&updatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return 0, ErrRecordNotFound
+			default:
+				return 0, err
+			}
+		}
+		return userID, nil
+	})
+}
 
-	var updatedAt time.Time
-	err := m.DB.QueryRowContext(ctx, query, isActive, isActivated, userID).Scan(&updatedAt)
-	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrRecordNotFound
-		default:
-			return err
+// ResetPassword saves the user's new password hash and, in the same
+// transaction, deletes their authentication and password reset tokens so
+// every existing session is signed out and the reset token cannot be reused.
+func (m *UserModel) ResetPassword(user *User) error {
+	return m.Actor.audit(m.DB, auditUser, AuditActionResetPassword, user.ID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		query := `
+			UPDATE users
+			SET password_hash = $1, updated_at = NOW()
+			WHERE user_id = $2
+			RETURNING updated_at
+		`
+		err := tx.QueryRowContext(ctx, query, user.Password.hash, user.ID).Scan(&user.UpdatedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return 0, ErrRecordNotFound
+			default:
+				return 0, err
+			}
 		}
-	}
 
-	return nil
+		query = `
+			DELETE FROM auth_tokens
+			WHERE user_id = $1 AND scope IN ($2, $3)
+		`
+		_, err = tx.ExecContext(ctx, query, user.ID, ScopeAuthentication, ScopePasswordReset)
+		if err != nil {
+			return 0, err
+		}
+		return user.ID, nil
+	})
 }
 
 // Get retrieves a specific user based on its ID
@@ -304,7 +332,7 @@ func (u *UserModel) Get(id int) (*User, error) {
 	query := `
 		SELECT user_id, username, email, password_hash, role_id, is_active, is_activated, last_login, created_at, created_by, updated_at, updated_by
 		FROM users
-		WHERE user_id = $1`
+		WHERE user_id = $1 AND deleted_at IS NULL`
 
 	var user User
 
@@ -351,64 +379,77 @@ func (u *UserModel) Get(id int) (*User, error) {
 	return &user, nil
 }
 
+// UserCriteria narrows a user listing. Zero values match everything.
+type UserCriteria struct {
+	RoleID      int
+	DistrictID  int // assigned to the user, or of their teacher profile
+	IsActive    *bool
+	IsActivated *bool
+	Username    string // matched anywhere in the username
+}
+
+// userSortColumns maps the sort values accepted for users to columns
+var userSortColumns = sortColumns{
+	"id":         "u.user_id",
+	"user_id":    "u.user_id",
+	"username":   "u.username",
+	"email":      "u.email",
+	"role_id":    "u.role_id",
+	"last_login": "u.last_login",
+	"created_at": "u.created_at",
+}
+
+// UserSortSafelist lists the sort values accepted for users
+var UserSortSafelist = userSortColumns.safelist()
+
 // GetAll retrieves all users with filtering and pagination
-func (u *UserModel) GetAll(regionID, formationID, rankID int, isActive *bool, lastName string, username string, filters Filters) ([]*User, Metadata, error) {
+func (u *UserModel) GetAll(criteria UserCriteria, filters Filters) ([]*User, Metadata, error) {
+	sortColumn, err := filters.sortColumn(userSortColumns)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
 	query := `
-		SELECT count(*) OVER(), user_id, username, email, role_id, is_active, is_activated, last_login, created_at, created_by, updated_at, updated_by
-		FROM users
-		WHERE 1=1`
+		SELECT count(*) OVER(), u.user_id, u.username, u.email, u.role_id, u.is_active, u.is_activated, u.last_login,
+		       u.created_at, u.created_by, u.updated_at, u.updated_by
+		FROM users u
+		WHERE u.deleted_at IS NULL`
 
 	args := []interface{}{}
-	argCount := 0
 
 	// Add filters
-	if regionID > 0 {
-		argCount++
-		query += ` AND region_id = $` + fmt.Sprintf("%d", argCount)
-		args = append(args, regionID)
+	if criteria.RoleID > 0 {
+		args = append(args, criteria.RoleID)
+		query += fmt.Sprintf(" AND u.role_id = $%d", len(args))
 	}
 
-	if formationID > 0 {
-		argCount++
-		query += ` AND formation_id = $` + fmt.Sprintf("%d", argCount)
-		args = append(args, formationID)
+	if criteria.DistrictID > 0 {
+		args = append(args, criteria.DistrictID)
+		query += fmt.Sprintf(` AND (EXISTS (SELECT 1 FROM user_districts ud WHERE ud.user_id = u.user_id AND ud.district_id = $%[1]d)
+			OR EXISTS (SELECT 1 FROM teachers t WHERE t.user_id = u.user_id AND t.district_id = $%[1]d AND t.deleted_at IS NULL))`, len(args))
 	}
 
-	if rankID > 0 {
-		argCount++
-		query += ` AND rank_id = $` + fmt.Sprintf("%d", argCount)
-		args = append(args, rankID)
+	if criteria.IsActive != nil {
+		args = append(args, *criteria.IsActive)
+		query += fmt.Sprintf(" AND u.is_active = $%d", len(args))
 	}
 
-	if lastName != "" {
-		argCount++
-		query += ` AND last_name ILIKE '%' || $` + fmt.Sprintf("%d", argCount) + ` || '%'`
-		args = append(args, lastName)
+	if criteria.IsActivated != nil {
+		args = append(args, *criteria.IsActivated)
+		query += fmt.Sprintf(" AND u.is_activated = $%d", len(args))
 	}
 
-	if username != "" {
-		argCount++
-		query += ` AND username ILIKE '%' || $` + fmt.Sprintf("%d", argCount) + ` || '%'`
-		args = append(args, username)
-	}
-
-	if isActive != nil {
-		argCount++
-		query += ` AND is_active = $` + fmt.Sprintf("%d", argCount)
-		args = append(args, *isActive)
+	if criteria.Username != "" {
+		args = append(args, "%"+escapeLike(criteria.Username)+"%")
+		query += fmt.Sprintf(" AND u.username ILIKE $%d", len(args))
 	}
 
 	// Add sorting
-	query += fmt.Sprintf(" ORDER BY %s %s", filters.sortColumn(), filters.sortDirection())
+	query += fmt.Sprintf(" ORDER BY %s %s, u.user_id ASC", sortColumn, filters.sortDirection())
 
 	// Add pagination
-	argCount++
-	limitArg := argCount
-	argCount++
-	offsetArg := argCount
-
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", limitArg, offsetArg)
 	args = append(args, filters.limit(), filters.offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -469,34 +510,130 @@ func (u *UserModel) GetAll(regionID, formationID, rankID int, isActive *bool, la
 	return users, metadata, nil
 }
 
-// Delete removes a user record from the database
+// Delete soft deletes a user and signs them out everywhere. Their teacher
+// profile, if they have one, is deleted with them. The account can be
+// brought back with Restore until it is purged.
 func (u *UserModel) Delete(id int) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	query := `
-		DELETE FROM users
-		WHERE user_id = $1`
+	return u.Actor.audit(u.DB, auditUser, AuditActionDelete, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		query := `
+			UPDATE users
+			SET deleted_at = NOW(), deleted_by = $2
+			WHERE user_id = $1 AND deleted_at IS NULL`
+		if err := changeOne(ctx, tx, query, id, nullInt(int(u.Actor.UserID))); err != nil {
+			return 0, err
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+		// NOW() is the same throughout the transaction, so the teacher
+		// shares the user's deleted_at and Restore can tell it apart from
+		// a teacher deleted on its own
+		query = `
+			UPDATE teachers
+			SET deleted_at = NOW(), deleted_by = $2
+			WHERE teacher_id = $1 AND deleted_at IS NULL`
+		err := u.changeLinkedTeacher(ctx, tx, id, `t.deleted_at IS NULL`, AuditActionDelete, query, nullInt(int(u.Actor.UserID)))
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM auth_tokens WHERE user_id = $1`, id)
+		if err != nil {
+			return 0, err
+		}
+		return int64(id), nil
+	})
+}
 
-	result, err := u.DB.ExecContext(ctx, query, id)
+// changeLinkedTeacher runs query, which changes the teacher whose id is
+// its first argument, on the user's teacher profile if condition, over
+// teachers t and users u, holds. The change is audited as action on the
+// teacher.
+func (u *UserModel) changeLinkedTeacher(ctx context.Context, tx *sql.Tx, userID int, condition, action, query string, args ...any) error {
+	var teacherID int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT t.teacher_id
+		FROM teachers t
+		INNER JOIN users u ON u.user_id = t.user_id
+		WHERE t.user_id = $1 AND `+condition, userID).Scan(&teacherID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return err
+	return u.Actor.auditTx(ctx, tx, auditTeacher, action, teacherID, func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		return teacherID, changeOne(ctx, tx, query, append([]any{teacherID}, args...)...)
+	})
+}
+
+// GetDeleted returns a page of soft deleted users, most recently deleted
+// first by default
+func (u *UserModel) GetDeleted(filters Filters) ([]*DeletedRecord, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), user_id AS entity_id, username || ' (' || email || ')' AS label, deleted_at, deleted_by
+		FROM users
+		WHERE deleted_at IS NOT NULL`
+
+	return listDeleted(u.DB, AuditEntityUser, query, []any{}, filters)
+}
+
+// Restore brings back a soft deleted user, and the teacher profile that
+// was deleted with them. A teacher deleted on its own stays deleted. They
+// have to sign in again, as their sessions ended when they were deleted.
+func (u *UserModel) Restore(id int) error {
+	if id < 1 {
+		return ErrRecordNotFound
 	}
 
-	if rowsAffected == 0 {
+	return u.Actor.audit(u.DB, auditUser, AuditActionRestore, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		// Runs first, while the user's deleted_at is still there to match
+		query := `
+			UPDATE teachers
+			SET deleted_at = NULL, deleted_by = NULL
+			WHERE teacher_id = $1 AND deleted_at IS NOT NULL`
+		err := u.changeLinkedTeacher(ctx, tx, id, `t.deleted_at = u.deleted_at`, AuditActionRestore, query)
+		if err != nil {
+			return 0, err
+		}
+
+		query = `
+			UPDATE users
+			SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW()
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+		return int64(id), changeOne(ctx, tx, query, id)
+	})
+}
+
+// Purge removes a soft deleted user from the database for good, along
+// with their notifications and district assignments. ErrInUse is returned
+// while a teacher profile is linked to the account; purge that first.
+func (u *UserModel) Purge(id int) error {
+	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	return u.Actor.audit(u.DB, auditUser, AuditActionPurge, int64(id), func(ctx context.Context, tx *sql.Tx) (int64, error) {
+		var linked bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM teachers WHERE user_id = $1)`, id).Scan(&linked)
+		if err != nil {
+			return 0, err
+		}
+
+		query := `DELETE FROM users WHERE user_id = $1 AND deleted_at IS NOT NULL`
+		if err = changeOne(ctx, tx, query, id); err != nil {
+			return 0, err
+		}
+		// Checked after the delete so a user who is not deleted is reported
+		// as not found; the error rolls the delete back
+		if linked {
+			return 0, ErrInUse
+		}
+		return int64(id), nil
+	})
 }
 
 // Verify token to user. We need to hash the passed in token
@@ -516,6 +653,7 @@ func (u *UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error
         WHERE tokens.token = $1
         AND tokens.scope = $2 
         AND tokens.expires_at > $3
+        AND users.deleted_at IS NULL
        `
 	args := []any{tokenHash[:], tokenScope, time.Now()}
 	var user User
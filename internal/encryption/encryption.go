@@ -0,0 +1,154 @@
+// Filename: internal/encryption/encryption.go
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var ErrDecrypt = errors.New("unable to decrypt value")
+
+// Keyring encrypts individual fields with AES-256-GCM. It holds one or more
+// named keys. Values are always sealed with the primary key and carry the
+// name of the key that sealed them, so values sealed with an older key
+// remain readable after a new primary key is added.
+//
+// The keyring also computes blind indexes: keyed hashes of a value that
+// let sealed fields be looked up and kept unique without decrypting them.
+type Keyring struct {
+	primary  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// New creates a Keyring. keys is a comma separated list of name:key pairs,
+// each key a base64 encoded 32 byte AES key; the first is the primary key.
+// indexKey is a base64 encoded key of at least 32 bytes for blind indexes.
+// It cannot be rotated without recomputing every index.
+func New(keys, indexKey string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+
+	for _, entry := range strings.Split(keys, ",") {
+		name, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || name == "" {
+			return nil, errors.New("encryption keys must be given as name:base64key")
+		}
+		if _, exists := k.keys[name]; exists {
+			return nil, fmt.Errorf("encryption key %q is listed twice", name)
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", name, err)
+		}
+		if len(raw) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes", name)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		k.keys[name] = aead
+		if k.primary == "" {
+			k.primary = name
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w", err)
+	}
+	if len(raw) < 32 {
+		return nil, errors.New("index key must be at least 32 bytes")
+	}
+	k.indexKey = raw
+
+	return k, nil
+}
+
+// Encrypt seals plaintext with the primary key and returns it as
+// name:base64(nonce|ciphertext). field is bound to the result as
+// associated data, so a value cannot be moved to another field. The empty
+// string is returned unchanged.
+func (k *Keyring) Encrypt(field, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	aead := k.keys[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(field))
+	return k.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt for the same field. The empty
+// string is returned unchanged.
+func (k *Keyring) Decrypt(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	name, encoded, found := strings.Cut(value, ":")
+	if !found {
+		return "", ErrDecrypt
+	}
+	aead, ok := k.keys[name]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key %q", ErrDecrypt, name)
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(field))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+// Primary returns the name of the key new values are sealed with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// BlindIndex returns the hex encoded HMAC-SHA256 of value for field. Case,
+// spaces and punctuation are ignored, so "000-123 456" and "000123456"
+// share an index. The empty string is returned unchanged.
+func (k *Keyring) BlindIndex(field, value string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, value)
+	if normalized == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(field + ":" + normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,85 @@
+// Filename: internal/signer/signer.go
+package signer
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCode = errors.New("invalid or tampered verification code")
+
+// Signer produces ed25519-signed verification codes. Anyone holding the
+// public key can check a code offline without contacting the API.
+type Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// New creates a Signer from a base64 encoded 32 byte ed25519 seed. When the
+// seed is empty a random key is generated, which means codes will not
+// survive a restart.
+func New(seed string) (*Signer, error) {
+	if seed == "" {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &Signer{privateKey: privateKey}, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(seed)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != ed25519.SeedSize {
+		return nil, errors.New("signing key must be a 32 byte ed25519 seed")
+	}
+	return &Signer{privateKey: ed25519.NewKeyFromSeed(raw)}, nil
+}
+
+// PublicKey returns the base64 encoded public key used to check codes
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.privateKey.Public().(ed25519.PublicKey))
+}
+
+// Encode signs the payload and returns a code of the form
+// base64url(payload).base64url(signature)
+func (s *Signer) Encode(payload []byte) string {
+	signature := ed25519.Sign(s.privateKey, payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Decode checks the signature on a code and returns its payload
+func (s *Signer) Decode(code string) ([]byte, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(code, ".")
+	if !found {
+		return nil, ErrInvalidCode
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCode
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCode
+	}
+
+	publicKey := s.privateKey.Public().(ed25519.PublicKey)
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return nil, ErrInvalidCode
+	}
+	return payload, nil
+}
+
+// Matches reports whether code carries a valid signature over exactly payload
+func (s *Signer) Matches(code string, payload []byte) bool {
+	decoded, err := s.Decode(code)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(decoded, payload)
+}
@@ -0,0 +1,72 @@
+// Filename: internal/storage/s3.go
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in a bucket on any S3-compatible service, including a
+// local MinIO server
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the endpoint and creates the bucket if it does not exist
+func NewS3(ctx context.Context, endpoint, accessKey, secretKey, bucket, region string, useSSL bool) (*S3, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: region})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3{client: client, bucket: bucket}, nil
+}
+
+// streamPartSize is the part size used when the length of an upload is not
+// known up front. The client buffers a whole part in memory and would
+// otherwise size parts for the largest possible object.
+const streamPartSize = 16 << 20
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	opts := minio.PutObjectOptions{ContentType: contentType}
+	if size < 0 {
+		opts.PartSize = streamPartSize
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, opts)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// check the object exists first; GetObject only fails on the first read
+	_, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,22 @@
+// Filename: internal/storage/storage.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrObjectNotFound = errors.New("stored object not found")
+
+// Storage is a place uploaded files can be streamed to and read back from.
+// Keys are generated by the API and use forward slashes.
+type Storage interface {
+	// Put stores everything read from r under key. size is -1 when the
+	// length is not known up front.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+}
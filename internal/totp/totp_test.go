@@ -0,0 +1,115 @@
+// Filename: internal/totp/totp_test.go
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed from RFC 6238 appendix B, the ASCII string
+// "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The RFC 6238 appendix B SHA-1 test vectors. The RFC lists eight digit
+// codes; six digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, tt := range rfcVectors {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("at %d: expected %s. Got %s", tt.unix, tt.code, got)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err != ErrInvalidSecret {
+		t.Errorf("expected ErrInvalidSecret, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range rfcVectors {
+		step, ok := Validate(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !ok || step != Step(time.Unix(tt.unix, 0)) {
+			t.Errorf("at %d: expected %s to be valid for its own step", tt.unix, tt.code)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name  string
+		code  string
+		valid bool
+		step  int64
+	}{
+		{name: "Previous step", code: codeAt(current - 1), valid: true, step: current - 1},
+		{name: "Next step", code: codeAt(current + 1), valid: true, step: current + 1},
+		{name: "Two steps behind", code: codeAt(current - 2), valid: false},
+		{name: "Two steps ahead", code: codeAt(current + 2), valid: false},
+		{name: "Wrong code", code: "000000", valid: false},
+		{name: "Too short", code: "05924", valid: false},
+		{name: "Too long", code: "0059240", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now)
+			if ok != tt.valid {
+				t.Fatalf("expected valid %v. Got %v", tt.valid, ok)
+			}
+			if ok && step != tt.step {
+				t.Errorf("expected step %d. Got %d", tt.step, step)
+			}
+		})
+	}
+}
+
+// Validate accepts a code for as long as its step is in the window, so
+// callers stop replays by refusing steps at or before the last one used.
+// The step it returns must identify the code, however late it is reused.
+func TestValidateReplay(t *testing.T) {
+	issued := time.Unix(1111111109, 0)
+	code, err := Code(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("expected the code to be valid when issued")
+	}
+
+	// Replayed within the window: the same step comes back, which the
+	// caller has already used
+	replayed, ok := Validate(rfcSecret, code, issued.Add(Period*time.Second))
+	if !ok || replayed != first {
+		t.Errorf("expected a replay to report step %d. Got %d (valid %v)", first, replayed, ok)
+	}
+
+	// Once the window has passed the code is refused outright
+	if _, ok := Validate(rfcSecret, code, issued.Add(2*Period*time.Second)); ok {
+		t.Error("expected the code to expire after the skew window")
+	}
+}
@@ -45,6 +45,18 @@ func PermittedValue(value string, permittedValues ...string) bool {
 	return slices.Contains(permittedValues, value)
 }
 
+// Unique reports whether every value in the slice is different
+func Unique(values []string) bool {
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
 // Regex to check if an email is valid
 var EmailRX = regexp.MustCompile(
 	"^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
@@ -0,0 +1,7 @@
+-- Drop applications and license_types tables
+DROP INDEX IF EXISTS idx_documents_application_id;
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_application_id_fkey;
+DROP INDEX IF EXISTS idx_applications_status;
+DROP INDEX IF EXISTS idx_applications_teacher_id;
+DROP TABLE IF EXISTS applications CASCADE;
+DROP TABLE IF EXISTS license_types CASCADE;
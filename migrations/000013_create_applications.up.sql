@@ -0,0 +1,42 @@
+-- Create license_types table
+CREATE TABLE IF NOT EXISTS license_types (
+    license_type_id SERIAL PRIMARY KEY,
+    license_class VARCHAR(20) UNIQUE NOT NULL CHECK (license_class IN ('provisional', 'trained', 'full')),
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT,
+    validity_years INT NOT NULL DEFAULT 5
+);
+
+INSERT INTO license_types (license_class, name, description, validity_years) VALUES
+('provisional', 'Provisional Teaching License', 'Issued to untrained teachers while they complete teacher training', 2),
+('trained', 'Trained Teacher License', 'Issued to teachers who have completed an approved teacher training programme', 5),
+('full', 'Full Teaching License', 'Issued to trained teachers with the required years of satisfactory service', 10)
+ON CONFLICT (license_class) DO NOTHING;
+
+-- Create applications table
+CREATE TABLE IF NOT EXISTS applications (
+    application_id SERIAL PRIMARY KEY,
+    teacher_id INT NOT NULL REFERENCES teachers(teacher_id) ON DELETE CASCADE,
+    license_type_id INT NOT NULL REFERENCES license_types(license_type_id),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'submitted', 'under_review', 'approved', 'rejected', 'withdrawn')),
+    remarks TEXT,
+    submitted_at TIMESTAMP,
+    decided_at TIMESTAMP,
+    reviewed_by INT REFERENCES users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_applications_teacher_id ON applications(teacher_id);
+CREATE INDEX IF NOT EXISTS idx_applications_status ON applications(status);
+
+-- documents.application_id was created without a foreign key; clear any
+-- dangling references before adding the constraint
+UPDATE documents SET application_id = NULL
+WHERE application_id IS NOT NULL
+AND application_id NOT IN (SELECT application_id FROM applications);
+
+ALTER TABLE documents
+ADD CONSTRAINT documents_application_id_fkey
+FOREIGN KEY (application_id) REFERENCES applications(application_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_documents_application_id ON documents(application_id);
@@ -0,0 +1,4 @@
+-- Drop application_transitions table
+DROP INDEX IF EXISTS idx_application_transitions_application_id;
+DROP TABLE IF EXISTS application_transitions CASCADE;
+ALTER TABLE applications DROP COLUMN IF EXISTS review_stage;
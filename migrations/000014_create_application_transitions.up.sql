@@ -0,0 +1,19 @@
+-- Track which approval stage (DEC -> TSC -> CEO) an application under review is at
+ALTER TABLE applications
+ADD COLUMN review_stage VARCHAR(10) CHECK (review_stage IN ('dec', 'tsc', 'ceo'));
+
+-- Create application_transitions table (history of every workflow step)
+CREATE TABLE IF NOT EXISTS application_transitions (
+    transition_id SERIAL PRIMARY KEY,
+    application_id INT NOT NULL REFERENCES applications(application_id) ON DELETE CASCADE,
+    action VARCHAR(30) NOT NULL,
+    from_status VARCHAR(20) NOT NULL,
+    from_stage VARCHAR(10),
+    to_status VARCHAR(20) NOT NULL,
+    to_stage VARCHAR(10),
+    actor_id INT REFERENCES users(user_id) ON DELETE SET NULL,
+    actor_role VARCHAR(50) NOT NULL,
+    comment TEXT,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_application_transitions_application_id ON application_transitions(application_id);
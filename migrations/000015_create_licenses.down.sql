@@ -0,0 +1,7 @@
+-- Drop licenses tables
+DROP INDEX IF EXISTS idx_license_events_license_id;
+DROP TABLE IF EXISTS license_events CASCADE;
+DROP INDEX IF EXISTS idx_licenses_teacher_id;
+DROP TABLE IF EXISTS licenses CASCADE;
+DROP TABLE IF EXISTS license_sequences CASCADE;
+ALTER TABLE districts DROP COLUMN IF EXISTS code;
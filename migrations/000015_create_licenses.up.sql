@@ -0,0 +1,50 @@
+-- District codes are used to prefix license numbers
+ALTER TABLE districts ADD COLUMN code VARCHAR(5) UNIQUE;
+
+UPDATE districts SET code = 'CZL' WHERE name = 'Corozal';
+UPDATE districts SET code = 'OWK' WHERE name = 'Orange Walk';
+UPDATE districts SET code = 'BZE' WHERE name = 'Belize';
+UPDATE districts SET code = 'CYO' WHERE name = 'Cayo';
+UPDATE districts SET code = 'SCR' WHERE name = 'Stann Creek';
+UPDATE districts SET code = 'TOL' WHERE name = 'Toledo';
+
+-- Create license_sequences table (last license number issued per prefix and year)
+CREATE TABLE IF NOT EXISTS license_sequences (
+    prefix VARCHAR(5) NOT NULL,
+    year INT NOT NULL,
+    last_number INT NOT NULL,
+    PRIMARY KEY (prefix, year)
+);
+
+-- Create licenses table
+CREATE TABLE IF NOT EXISTS licenses (
+    license_id SERIAL PRIMARY KEY,
+    license_number VARCHAR(30) UNIQUE NOT NULL,
+    teacher_id INT NOT NULL REFERENCES teachers(teacher_id) ON DELETE CASCADE,
+    application_id INT UNIQUE REFERENCES applications(application_id) ON DELETE SET NULL,
+    license_class VARCHAR(20) NOT NULL CHECK (license_class IN ('provisional', 'trained', 'full')),
+    level VARCHAR(20) NOT NULL CHECK (level IN ('preschool', 'primary', 'secondary')),
+    issue_date DATE NOT NULL,
+    expiry_date DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'expired', 'suspended', 'revoked')),
+    issued_by INT REFERENCES users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    version INT NOT NULL DEFAULT 1,
+    CHECK (expiry_date > issue_date)
+);
+CREATE INDEX IF NOT EXISTS idx_licenses_teacher_id ON licenses(teacher_id);
+
+-- Create license_events table (issue, renew, suspend, reinstate and revoke history)
+CREATE TABLE IF NOT EXISTS license_events (
+    event_id SERIAL PRIMARY KEY,
+    license_id INT NOT NULL REFERENCES licenses(license_id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    expiry_date DATE NOT NULL,
+    reason TEXT NOT NULL,
+    actor_id INT REFERENCES users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_license_events_license_id ON license_events(license_id);
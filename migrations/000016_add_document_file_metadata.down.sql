@@ -0,0 +1,5 @@
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS sha256,
+    DROP COLUMN IF EXISTS file_size,
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS file_name;
@@ -0,0 +1,7 @@
+-- Uploaded files are kept in a storage backend; file_path holds the storage
+-- key. Documents created before uploads existed have no metadata.
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS file_name TEXT,
+    ADD COLUMN IF NOT EXISTS content_type VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS file_size BIGINT CHECK (file_size >= 0),
+    ADD COLUMN IF NOT EXISTS sha256 CHAR(64);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_documents_verification_status;
+
+ALTER TABLE documents
+    DROP COLUMN IF EXISTS verified_at,
+    DROP COLUMN IF EXISTS verification_status;
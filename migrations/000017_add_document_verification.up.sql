@@ -0,0 +1,9 @@
+-- Documents are reviewed by DEC/TSC staff and either verified or rejected
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS verification_status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (verification_status IN ('pending', 'verified', 'rejected')),
+    ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+
+UPDATE documents SET verification_status = 'verified' WHERE verified = TRUE;
+
+CREATE INDEX IF NOT EXISTS idx_documents_verification_status ON documents(verification_status);
@@ -0,0 +1,3 @@
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_doc_type_fkey;
+DROP TABLE IF EXISTS license_type_documents;
+DROP TABLE IF EXISTS document_types;
@@ -0,0 +1,50 @@
+-- Reference list of the documents teachers can upload
+CREATE TABLE IF NOT EXISTS document_types (
+    document_type_id SERIAL PRIMARY KEY,
+    code VARCHAR(100) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    allowed_mime_types TEXT[] NOT NULL DEFAULT ARRAY['application/pdf', 'image/jpeg', 'image/png'],
+    max_size_bytes BIGINT NOT NULL DEFAULT 10485760 CHECK (max_size_bytes > 0)
+);
+
+INSERT INTO document_types (code, name, description) VALUES
+    ('birth_certificate', 'Birth Certificate', 'Certified copy of the applicant''s birth certificate'),
+    ('identification', 'Identification', 'Social security card, passport or other government issued ID'),
+    ('police_record', 'Police Record', 'Police record issued within the last six months'),
+    ('medical_certificate', 'Medical Certificate', 'Certificate of good health from a registered physician'),
+    ('academic_transcript', 'Academic Transcript', 'Official transcript of the highest qualification held'),
+    ('teacher_certification', 'Teacher Certification', 'Certificate of completion of a recognised teacher training programme'),
+    ('degree_certificate', 'Degree Certificate', 'Associate, bachelor''s or higher degree certificate')
+ON CONFLICT (code) DO NOTHING;
+
+-- Which document types each license type requires
+CREATE TABLE IF NOT EXISTS license_type_documents (
+    license_type_id INT NOT NULL REFERENCES license_types(license_type_id) ON DELETE CASCADE,
+    document_type_id INT NOT NULL REFERENCES document_types(document_type_id) ON DELETE CASCADE,
+    PRIMARY KEY (license_type_id, document_type_id)
+);
+
+INSERT INTO license_type_documents (license_type_id, document_type_id)
+SELECT lt.license_type_id, dt.document_type_id
+FROM license_types lt
+JOIN document_types dt ON
+    (lt.license_class = 'provisional' AND dt.code IN ('birth_certificate', 'identification', 'police_record', 'medical_certificate', 'academic_transcript'))
+    OR (lt.license_class = 'trained' AND dt.code IN ('birth_certificate', 'identification', 'police_record', 'medical_certificate', 'academic_transcript', 'teacher_certification'))
+    OR (lt.license_class = 'full' AND dt.code IN ('birth_certificate', 'identification', 'police_record', 'medical_certificate', 'academic_transcript', 'teacher_certification', 'degree_certificate'))
+ON CONFLICT DO NOTHING;
+
+-- Fold free text variations into the registered codes where they can be
+-- recognised
+UPDATE documents SET doc_type = LOWER(REGEXP_REPLACE(TRIM(doc_type), '[^A-Za-z0-9]+', '_', 'g'))
+WHERE doc_type NOT IN (SELECT code FROM document_types);
+
+UPDATE documents SET doc_type = 'degree_certificate' WHERE doc_type IN ('degree', 'degree_cert', 'degree_certificates', 'diploma');
+UPDATE documents SET doc_type = 'teacher_certification' WHERE doc_type IN ('teacher_cert', 'teaching_certificate', 'teacher_certificate', 'certification');
+UPDATE documents SET doc_type = 'academic_transcript' WHERE doc_type IN ('transcript', 'transcripts');
+UPDATE documents SET doc_type = 'police_record' WHERE doc_type IN ('police_report', 'police_clearance');
+
+-- Enforce the registry for new documents. Legacy values that could not be
+-- recognised are left in place (NOT VALID skips checking existing rows).
+ALTER TABLE documents
+    ADD CONSTRAINT documents_doc_type_fkey FOREIGN KEY (doc_type) REFERENCES document_types(code) ON UPDATE CASCADE NOT VALID;
@@ -0,0 +1,5 @@
+-- Authentication tokens double as login sessions the user can review and revoke
+ALTER TABLE auth_tokens
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45),
+    ADD COLUMN IF NOT EXISTS user_agent TEXT;
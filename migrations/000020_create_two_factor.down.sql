@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS user_two_factor;
+ALTER TABLE roles DROP COLUMN IF EXISTS requires_two_factor;
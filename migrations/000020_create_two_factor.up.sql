@@ -0,0 +1,24 @@
+-- Roles whose users must use two-factor authentication to log in
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS requires_two_factor BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- TOTP secret for each enrolled user. enabled_at stays NULL until the
+-- user has proven their authenticator works. last_used_step stops a code
+-- being replayed within its validity window.
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_id INT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP(0) WITH TIME ZONE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Single use recovery codes, stored as SHA-256 hashes
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+    code_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_two_factor_recovery_codes_user_id ON two_factor_recovery_codes(user_id);
@@ -0,0 +1,17 @@
+-- Failed login tracking for per-account throttling and lockout
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMP(0) WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP(0) WITH TIME ZONE;
+
+-- Create account_events table (lock and unlock history)
+CREATE TABLE IF NOT EXISTS account_events (
+    event_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    action VARCHAR(20) NOT NULL,
+    detail TEXT,
+    ip_address VARCHAR(45),
+    actor_id INT REFERENCES users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_account_events_user_id ON account_events(user_id);
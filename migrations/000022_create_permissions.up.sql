@@ -0,0 +1,45 @@
+-- Named permissions that can be granted to roles
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_id SERIAL PRIMARY KEY,
+    code VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INT NOT NULL REFERENCES roles(role_id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(permission_id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (code, description) VALUES
+    ('users:read', 'View any user account'),
+    ('users:update', 'Update any user account'),
+    ('users:manage', 'Change roles and activation, delete and unlock users, revoke their tokens'),
+    ('roles:manage', 'Create, update and delete roles and their permissions'),
+    ('districts:create', 'Create districts'),
+    ('districts:delete', 'Delete districts'),
+    ('institutions:create', 'Create institutions'),
+    ('institutions:delete', 'Delete institutions'),
+    ('teachers:create', 'Create teacher records'),
+    ('teachers:delete', 'Delete teacher records'),
+    ('documents:verify', 'Verify and reject documents and view the verification queue'),
+    ('document_types:manage', 'Create and update document types'),
+    ('applications:read', 'List all license applications'),
+    ('applications:delete', 'Delete license applications'),
+    ('licenses:read', 'List licenses and view their history'),
+    ('licenses:issue', 'Issue and renew licenses'),
+    ('licenses:suspend', 'Suspend, reinstate and revoke licenses'),
+    ('notifications:create', 'Send notifications')
+ON CONFLICT (code) DO NOTHING;
+
+-- Grant the seeded roles the access they had before permissions existed
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON
+    r.name = 'Admin'
+    OR (r.name = 'CEO' AND p.code IN ('users:read', 'users:update', 'districts:create', 'districts:delete', 'institutions:create', 'institutions:delete', 'teachers:create', 'teachers:delete', 'applications:read', 'applications:delete', 'licenses:read', 'licenses:issue', 'licenses:suspend', 'notifications:create'))
+    OR (r.name = 'TSC' AND p.code IN ('users:read', 'institutions:create', 'teachers:create', 'teachers:delete', 'documents:verify', 'applications:read', 'applications:delete', 'licenses:read', 'licenses:suspend'))
+    OR (r.name = 'DEC' AND p.code IN ('users:read', 'users:update', 'districts:create', 'institutions:create', 'teachers:create', 'documents:verify', 'applications:read', 'licenses:read'))
+    OR (r.name = 'Secretary' AND p.code IN ('notifications:create'))
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE roles DROP COLUMN IF EXISTS district_scoped;
+DROP TABLE IF EXISTS user_districts;
@@ -0,0 +1,13 @@
+-- Districts a user works in. Users whose role has district_scoped set
+-- only see teachers, documents and applications in these. The flag is
+-- part of the role rather than a permission, so replacing a role's
+-- permissions cannot silently widen it.
+CREATE TABLE IF NOT EXISTS user_districts (
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    district_id INT NOT NULL REFERENCES districts(district_id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, district_id)
+);
+
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS district_scoped BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE roles SET district_scoped = TRUE WHERE name = 'DEC';
@@ -0,0 +1,12 @@
+-- Staff may act on any teacher's education, qualifications, documents and
+-- applications. Everyone else only on the records of their own teacher profile.
+INSERT INTO permissions (code, description) VALUES
+    ('teachers:manage', 'Manage any teacher''s education, qualifications, documents and applications')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON p.code = 'teachers:manage'
+WHERE r.name IN ('Admin', 'CEO', 'DEC', 'TSC')
+ON CONFLICT DO NOTHING;
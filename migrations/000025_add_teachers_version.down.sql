@@ -0,0 +1 @@
+ALTER TABLE teachers DROP COLUMN IF EXISTS version;
@@ -0,0 +1,2 @@
+-- Teacher profiles can be edited; the version guards against lost updates
+ALTER TABLE teachers ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,13 @@
+-- Districts and institutions can be edited by whoever may create them
+INSERT INTO permissions (code, description) VALUES
+    ('districts:update', 'Rename districts'),
+    ('institutions:update', 'Update institutions')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT rp.role_id, p.permission_id
+FROM role_permissions rp
+JOIN permissions c ON c.permission_id = rp.permission_id
+JOIN permissions p ON p.code = REPLACE(c.code, ':create', ':update')
+WHERE c.code IN ('districts:create', 'institutions:create')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,44 @@
+-- Append-only record of changes to users, teachers, documents and roles.
+-- Rows are written in the same transaction as the change they describe.
+-- actor_id is not a foreign key so the history survives deleted users.
+CREATE TABLE IF NOT EXISTS audit_events (
+    audit_event_id BIGSERIAL PRIMARY KEY,
+    actor_id INT,
+    ip_address VARCHAR(45),
+    entity_type VARCHAR(30) NOT NULL,
+    entity_id INT NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_entity ON audit_events(entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (code, description) VALUES
+    ('audit:read', 'Read the audit trail')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON p.code = 'audit:read'
+WHERE r.name IN ('Admin', 'CEO')
+ON CONFLICT DO NOTHING;
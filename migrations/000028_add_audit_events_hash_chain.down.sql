@@ -0,0 +1,3 @@
+ALTER TABLE audit_events
+    DROP COLUMN IF EXISTS prev_hash,
+    DROP COLUMN IF EXISTS hash;
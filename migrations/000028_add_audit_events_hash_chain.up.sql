@@ -0,0 +1,6 @@
+-- Each audit event carries the SHA-256 of its contents and of the event
+-- before it, so edits to history break the chain. Events written before
+-- this migration have no hash and are skipped by verification.
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS prev_hash CHAR(64),
+    ADD COLUMN IF NOT EXISTS hash CHAR(64);
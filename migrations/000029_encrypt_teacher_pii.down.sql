@@ -0,0 +1,9 @@
+-- SQL cannot decrypt the sealed columns, so values written since the up
+-- migration are lost with them.
+DELETE FROM permissions WHERE code = 'teachers:read_pii';
+DROP INDEX IF EXISTS teachers_ssn_index_key;
+ALTER TABLE teachers
+    DROP COLUMN IF EXISTS ssn_encrypted,
+    DROP COLUMN IF EXISTS ssn_index,
+    DROP COLUMN IF EXISTS dob_encrypted,
+    DROP COLUMN IF EXISTS address_encrypted;
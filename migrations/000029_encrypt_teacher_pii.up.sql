@@ -0,0 +1,21 @@
+-- Teachers' SSN, date of birth and address are sealed with AES-GCM by the
+-- application. ssn_index is a keyed hash of the SSN for lookups and
+-- uniqueness. The plaintext columns are emptied by cmd/rekey and by any
+-- update to the teacher.
+ALTER TABLE teachers
+    ADD COLUMN IF NOT EXISTS ssn_encrypted TEXT,
+    ADD COLUMN IF NOT EXISTS ssn_index CHAR(64),
+    ADD COLUMN IF NOT EXISTS dob_encrypted TEXT,
+    ADD COLUMN IF NOT EXISTS address_encrypted TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS teachers_ssn_index_key ON teachers(ssn_index);
+
+INSERT INTO permissions (code, description) VALUES
+    ('teachers:read_pii', 'View teachers'' SSN, date of birth and address')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON p.code = 'teachers:read_pii'
+WHERE r.name IN ('Admin', 'CEO', 'TSC')
+ON CONFLICT DO NOTHING;
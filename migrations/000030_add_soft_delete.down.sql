@@ -0,0 +1,13 @@
+-- Soft deleted rows would reappear once the columns are gone, so they are
+-- removed for good first
+DELETE FROM documents WHERE deleted_at IS NOT NULL;
+DELETE FROM teachers WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DELETE FROM permissions WHERE code IN ('records:restore', 'records:purge');
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_teachers_deleted_at;
+DROP INDEX IF EXISTS idx_documents_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE teachers DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE documents DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS deleted_by;
@@ -0,0 +1,31 @@
+-- Users, teachers and documents are soft deleted: deleted_at marks them as
+-- gone and queries skip them, but the rows and everything that references
+-- them stay until purged. deleted_by has no foreign key so purging the
+-- user who deleted a record leaves it alone.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by INT;
+ALTER TABLE teachers
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by INT;
+ALTER TABLE documents
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by INT;
+
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_teachers_deleted_at ON teachers(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Purging is deliberately not granted to any role; it has to be given
+-- to a role explicitly
+INSERT INTO permissions (code, description) VALUES
+    ('records:restore', 'List and restore deleted users, teachers and documents'),
+    ('records:purge', 'Permanently remove deleted users, teachers and documents')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON p.code = 'records:restore'
+WHERE r.name = 'Admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,6 @@
+-- SQL cannot decrypt the sealed secrets, so enrolments started since the
+-- up migration are lost with them.
+DELETE FROM user_two_factor WHERE secret IS NULL;
+ALTER TABLE user_two_factor
+    DROP COLUMN IF EXISTS secret_encrypted,
+    ALTER COLUMN secret SET NOT NULL;
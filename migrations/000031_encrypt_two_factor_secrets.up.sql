@@ -0,0 +1,6 @@
+-- TOTP secrets are sealed with AES-GCM by the application, like teachers'
+-- sensitive fields. The plaintext secret column is emptied by cmd/rekey
+-- and whenever enrolment restarts.
+ALTER TABLE user_two_factor
+    ADD COLUMN IF NOT EXISTS secret_encrypted TEXT,
+    ALTER COLUMN secret DROP NOT NULL;
@@ -0,0 +1 @@
+DELETE FROM permissions WHERE code IN ('applications:submit', 'applications:withdraw', 'applications:review_dec', 'applications:review_tsc', 'applications:approve');
@@ -0,0 +1,20 @@
+-- Each step of the application workflow is granted by a permission rather
+-- than tied to a role name. The grants match the bodies that own each
+-- stage; Admin holds none of them, so it cannot act for DEC, TSC or CEO.
+INSERT INTO permissions (code, description) VALUES
+    ('applications:submit', 'Submit draft license applications for review'),
+    ('applications:withdraw', 'Withdraw license applications before a decision'),
+    ('applications:review_dec', 'Review applications at the District Education Center stage'),
+    ('applications:review_tsc', 'Review applications at the Teacher Service Commission stage'),
+    ('applications:approve', 'Approve, reject or return applications at the final CEO stage')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.role_id, p.permission_id
+FROM roles r
+JOIN permissions p ON
+    (r.name = 'Teacher' AND p.code IN ('applications:submit', 'applications:withdraw'))
+    OR (r.name = 'DEC' AND p.code IN ('applications:submit', 'applications:review_dec'))
+    OR (r.name = 'TSC' AND p.code = 'applications:review_tsc')
+    OR (r.name = 'CEO' AND p.code = 'applications:approve')
+ON CONFLICT DO NOTHING;